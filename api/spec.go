@@ -0,0 +1,9 @@
+// Package api embeds the OpenAPI spec of the rcond HTTP API.
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI document in rcond.yaml.
+//
+//go:embed rcond.yaml
+var Spec []byte
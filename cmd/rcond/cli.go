@@ -0,0 +1,803 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/client"
+	"github.com/0x1d/rcond/pkg/job"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultTargetURL = "http://localhost:8080"
+
+// target is the rcond API the command line client talks to.
+// It is read from ~/.config/rcond/config.yaml, overridden by environment variables and flags.
+type target struct {
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token"`
+	Socket   string `yaml:"socket"`
+	CAFile   string `yaml:"ca_file"`
+	Insecure bool   `yaml:"insecure"`
+	Output   string `yaml:"output"`
+}
+
+// command is a subcommand of the command line client.
+type command struct {
+	args  string
+	short string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]map[string]command{
+	"network": {
+		"list": {"", "List connection profiles", networkList},
+		"sta":  {"--ssid <ssid> [--password <password>] [--interface <interface>] [--autoconnect]", "Connect to a WiFi access point", networkSTA},
+		"ap":   {"--ssid <ssid> [--password <password>] [--interface <interface>] [--autoconnect]", "Create a WiFi access point", networkAP},
+		"up":   {"[--async] <interface> <uuid>", "Activate a connection on an interface", networkUp},
+		"down": {"<interface>", "Deactivate the connection of an interface", networkDown},
+		"rm":   {"<uuid>", "Remove a connection profile", networkRemove},
+	},
+	"hostname": {
+		"get": {"", "Get the hostname", hostnameGet},
+		"set": {"<hostname>", "Set the hostname", hostnameSet},
+	},
+	"keys": {
+		"add": {"<user> <pubkey | file | ->", "Add an authorized SSH key", keysAdd},
+		"rm":  {"<user> <fingerprint>", "Remove an authorized SSH key", keysRemove},
+	},
+	"file": {
+		"put": {"<local file | -> <remote path>", "Upload a file", filePut},
+	},
+	"cluster": {
+		"members": {"[--status <status>] [--tag key=value]", "List the cluster members", clusterMembers},
+		"join":    {"<addr>...", "Join cluster nodes", clusterJoin},
+		"leave":   {"", "Leave the cluster", clusterLeave},
+		"event":   {"<name> [payload]", "Send a cluster event with a JSON payload", clusterEvent},
+	},
+	"jobs": {
+		"list":   {"[--type <type>] [--status <status>]", "List jobs", jobsList},
+		"get":    {"<id>", "Show the progress and result of a job", jobsGet},
+		"cancel": {"<id>", "Cancel a running job", jobsCancel},
+	},
+	"units": {
+		"list":    {"", "List the systemd units of the allowlist", unitsList},
+		"get":     {"<unit>", "Show the state of a unit", unitsGet},
+		"start":   {"<unit>", "Start a unit", unitAction(api.UnitStart)},
+		"stop":    {"<unit>", "Stop a unit", unitAction(api.UnitStop)},
+		"restart": {"<unit>", "Restart a unit", unitAction(api.UnitRestart)},
+		"reload":  {"<unit>", "Reload a unit", unitAction(api.UnitReload)},
+		"enable":  {"<unit>", "Enable a unit", unitAction(api.UnitEnable)},
+		"disable": {"<unit>", "Disable a unit", unitAction(api.UnitDisable)},
+	},
+	"system": {
+		"info":     {"", "Show the host and rcond version", systemInfo},
+		"health":   {"", "Show the health checks", systemHealth},
+		"logs":     {"[--unit <unit>] [--priority <priority>] [--since <duration>] [--limit <n>]", "Show the journal", systemLogs},
+		"restart":  {"[--delay <duration> | --at <time>] [--force]", "Restart the system", powerAction(api.PowerReboot)},
+		"shutdown": {"[--delay <duration> | --at <time>] [--force]", "Shutdown the system", powerAction(api.PowerPoweroff)},
+		"power":    {"", "List pending restarts and shutdowns", systemPower},
+		"cancel":   {"[<id>]", "Cancel a pending restart or shutdown, or all", systemCancel},
+	},
+}
+
+// isCommand reports whether the arguments start with a client command instead of daemon flags.
+func isCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := commands[args[0]]
+	return ok || args[0] == "help"
+}
+
+// runCLI runs a client command and returns the exit code.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	group, ok := commands[args[0]]
+	if !ok || len(args) < 2 {
+		cliUsage(stderr, args[0])
+		if args[0] == "help" {
+			return 0
+		}
+		return 2
+	}
+	cmd, ok := group[args[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command: %s %s\n\n", args[0], args[1])
+		cliUsage(stderr, args[0])
+		return 2
+	}
+	c := &cli{name: args[0] + " " + args[1], args: cmd.args, out: stdout, stderr: stderr}
+	if err := c.loadTarget(); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := cmd.run(c, args[2:]); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func cliUsage(w io.Writer, name string) {
+	fmt.Fprintln(w, "Usage: rcond <command> <subcommand> [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for group := range commands {
+		if _, ok := commands[name]; !ok || group == name {
+			names = append(names, group)
+		}
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, group := range names {
+		subs := make([]string, 0, len(commands[group]))
+		for sub := range commands[group] {
+			subs = append(subs, sub)
+		}
+		sort.Strings(subs)
+		for _, sub := range subs {
+			cmd := commands[group][sub]
+			fmt.Fprintf(tw, "  %s %s %s\t%s\n", group, sub, cmd.args, cmd.short)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nTarget flags, also read from RCOND_URL, RCOND_TOKEN, RCOND_SOCKET, RCOND_CA_FILE,")
+	fmt.Fprintln(w, "RCOND_INSECURE, RCOND_OUTPUT and ~/.config/rcond/config.yaml:")
+	fs := flag.NewFlagSet("rcond", flag.ContinueOnError)
+	fs.SetOutput(w)
+	(&cli{}).targetFlags(fs)
+	fs.PrintDefaults()
+}
+
+// cli holds the target and output of a client command.
+type cli struct {
+	name   string
+	args   string
+	target target
+	client *client.Client
+	out    io.Writer
+	stderr io.Writer
+}
+
+// loadTarget reads the target from the config file and the environment.
+func (c *cli) loadTarget() error {
+	c.target = target{URL: defaultTargetURL, Output: "table"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		data, err := os.ReadFile(filepath.Join(dir, "rcond", "config.yaml"))
+		if err == nil {
+			if err := yaml.Unmarshal(data, &c.target); err != nil {
+				return fmt.Errorf("invalid client config: %v", err)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	env := map[string]*string{
+		"RCOND_URL":     &c.target.URL,
+		"RCOND_TOKEN":   &c.target.Token,
+		"RCOND_SOCKET":  &c.target.Socket,
+		"RCOND_CA_FILE": &c.target.CAFile,
+		"RCOND_OUTPUT":  &c.target.Output,
+	}
+	for name, field := range env {
+		if v, ok := os.LookupEnv(name); ok {
+			*field = v
+		}
+	}
+	if v, ok := os.LookupEnv("RCOND_INSECURE"); ok {
+		c.target.Insecure, _ = strconv.ParseBool(v)
+	}
+	return nil
+}
+
+func (c *cli) targetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.target.URL, "url", c.target.URL, "URL of the rcond API")
+	fs.StringVar(&c.target.Token, "token", c.target.Token, "API token")
+	fs.StringVar(&c.target.Socket, "socket", c.target.Socket, "Unix socket of the rcond API, used instead of the URL")
+	fs.StringVar(&c.target.CAFile, "ca-file", c.target.CAFile, "CA certificate to verify the server")
+	fs.BoolVar(&c.target.Insecure, "insecure", c.target.Insecure, "Skip verification of the server certificate")
+	fs.StringVar(&c.target.Output, "output", c.target.Output, "Output format: table or json")
+	fs.StringVar(&c.target.Output, "o", c.target.Output, "Output format: table or json (shorthand)")
+}
+
+// flags returns the flag set of the command with the target flags.
+func (c *cli) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("rcond "+c.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	c.targetFlags(fs)
+	return fs
+}
+
+// parse parses flags placed anywhere between the arguments, checks the number of
+// positional arguments and creates the API client.
+func (c *cli) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		return nil, fmt.Errorf("usage: rcond %s %s", c.name, c.args)
+	}
+	if c.target.Output != "table" && c.target.Output != "json" {
+		return nil, fmt.Errorf("invalid output format %q", c.target.Output)
+	}
+	cl, err := client.New(client.Config{
+		URL:                c.target.URL,
+		Socket:             c.target.Socket,
+		Token:              c.target.Token,
+		CAFile:             c.target.CAFile,
+		InsecureSkipVerify: c.target.Insecure,
+		MaxRetries:         2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.client = cl
+	return positional, nil
+}
+
+func (c *cli) ctx() context.Context {
+	return context.Background()
+}
+
+// print writes the result as JSON or, in table mode, calls table.
+func (c *cli) print(result interface{}, table func(w *tabwriter.Writer)) error {
+	if c.target.Output == "json" {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// printStatus prints the result of an action, like the status response of the API.
+func (c *cli) printStatus(err error) error {
+	if err != nil {
+		return err
+	}
+	result := api.StatusResponse{Status: api.StatusSuccess}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, result.Status)
+	})
+}
+
+func networkList(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	connections, err := c.client.ListConnections(c.ctx())
+	if err != nil {
+		return err
+	}
+	return c.print(connections, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "UUID\tNAME\tTYPE\tSSID\tINTERFACE\tACTIVE\tAUTOCONNECT")
+		for _, conn := range connections {
+			iface := conn.Device
+			if iface == "" {
+				iface = conn.Interface
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%t\n", conn.UUID, conn.ID, conn.Type, conn.SSID, iface, conn.Active, conn.AutoConnect)
+		}
+	})
+}
+
+func networkSTA(c *cli, args []string) error {
+	return networkConfigure(c, args, func(ctx context.Context, req api.ConfigureSTARequest) (string, error) {
+		return c.client.ConfigureSTA(ctx, req)
+	})
+}
+
+func networkAP(c *cli, args []string) error {
+	return networkConfigure(c, args, func(ctx context.Context, req api.ConfigureSTARequest) (string, error) {
+		return c.client.ConfigureAP(ctx, api.ConfigureAPRequest(req))
+	})
+}
+
+func networkConfigure(c *cli, args []string, configure func(context.Context, api.ConfigureSTARequest) (string, error)) error {
+	var req api.ConfigureSTARequest
+	fs := c.flags()
+	fs.StringVar(&req.Interface, "interface", "wlan0", "Network interface")
+	fs.StringVar(&req.SSID, "ssid", "", "SSID of the network")
+	fs.StringVar(&req.Password, "password", "", "Password of the network")
+	fs.BoolVar(&req.Autoconnect, "autoconnect", false, "Connect automatically")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if req.SSID == "" {
+		return fmt.Errorf("--ssid is required")
+	}
+	uuid, err := configure(c.ctx(), req)
+	if err != nil {
+		return err
+	}
+	result := api.ConnectionResponse{UUID: uuid}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, result.UUID)
+	})
+}
+
+func networkUp(c *cli, args []string) error {
+	fs := c.flags()
+	async := fs.Bool("async", false, "Run as a job and print it instead of waiting for the connection")
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if !*async {
+		return c.printStatus(c.client.NetworkUp(c.ctx(), args[0], args[1]))
+	}
+	j, err := c.client.NetworkUpAsync(c.ctx(), args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return c.printJobs([]job.Job{*j})
+}
+
+func networkDown(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return c.printStatus(c.client.NetworkDown(c.ctx(), args[0]))
+}
+
+func networkRemove(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return c.printStatus(c.client.RemoveConnection(c.ctx(), args[0]))
+}
+
+func hostnameGet(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	hostname, err := c.client.Hostname(c.ctx())
+	if err != nil {
+		return err
+	}
+	result := api.HostnameResponse{Hostname: hostname}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, result.Hostname)
+	})
+}
+
+func hostnameSet(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return c.printStatus(c.client.SetHostname(c.ctx(), args[0]))
+}
+
+func keysAdd(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	if _, err := os.Stat(key); key == "-" || err == nil {
+		data, err := readInput(key)
+		if err != nil {
+			return err
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	fingerprint, err := c.client.AddAuthorizedKey(c.ctx(), args[0], key)
+	if err != nil {
+		return err
+	}
+	result := api.AuthorizedKeyResponse{Fingerprint: fingerprint}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, result.Fingerprint)
+	})
+}
+
+func keysRemove(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return c.printStatus(c.client.RemoveAuthorizedKey(c.ctx(), args[0], args[1]))
+}
+
+func filePut(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	data, err := readInput(args[0])
+	if err != nil {
+		return err
+	}
+	return c.printStatus(c.client.UploadFile(c.ctx(), args[1], data))
+}
+
+func jobsList(c *cli, args []string) error {
+	fs := c.flags()
+	kind := fs.String("type", "", "Only jobs of the type, like network-up")
+	status := fs.String("status", "", "Only jobs with the status: running, succeeded, failed or canceled")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	jobs, err := c.client.Jobs(c.ctx(), *kind, *status)
+	if err != nil {
+		return err
+	}
+	return c.printJobs(jobs)
+}
+
+func jobsGet(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	j, err := c.client.Job(c.ctx(), args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(j, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ID:\t%s\n", j.ID)
+		fmt.Fprintf(w, "TYPE:\t%s\n", j.Type)
+		fmt.Fprintf(w, "STATUS:\t%s\n", j.Status)
+		fmt.Fprintf(w, "PROGRESS:\t%d/%d %s\n", j.Progress.Done, j.Progress.Total, j.Progress.Message)
+		if j.Error != "" {
+			fmt.Fprintf(w, "ERROR:\t%s\n", j.Error)
+		}
+		if j.Result != nil {
+			result, _ := json.Marshal(j.Result)
+			fmt.Fprintf(w, "RESULT:\t%s\n", result)
+		}
+	})
+}
+
+func jobsCancel(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	j, err := c.client.CancelJob(c.ctx(), args[0])
+	if err != nil {
+		return err
+	}
+	return c.printJobs([]job.Job{*j})
+}
+
+func (c *cli) printJobs(jobs []job.Job) error {
+	return c.print(jobs, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tPROGRESS\tCREATED")
+		for _, j := range jobs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n", j.ID, j.Type, j.Status, j.Progress.Done, j.Progress.Total, j.CreatedAt.Local().Format(time.RFC3339))
+		}
+	})
+}
+
+func clusterMembers(c *cli, args []string) error {
+	filter := api.MemberFilter{Tags: map[string]string{}}
+	fs := c.flags()
+	fs.StringVar(&filter.Status, "status", "", "Only members with the status: alive, leaving, left or failed")
+	fs.Var(tagFlags(filter.Tags), "tag", "Only members with the tag key=value, can be repeated")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	members, err := c.client.Members(c.ctx(), filter)
+	if err != nil {
+		return err
+	}
+	return c.print(members, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tADDRESS\tSTATUS\tTAGS")
+		for _, m := range members {
+			fmt.Fprintf(w, "%s\t%s:%d\t%s\t%s\n", m.Name, m.Addr, m.Port, m.Status, formatTags(m.Tags))
+		}
+	})
+}
+
+func clusterJoin(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	joined, err := c.client.Join(c.ctx(), args...)
+	if err != nil {
+		return err
+	}
+	result := api.ClusterJoinResponse{Joined: joined}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "joined %d nodes\n", result.Joined)
+	})
+}
+
+func clusterLeave(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	return c.printStatus(c.client.Leave(c.ctx()))
+}
+
+func clusterEvent(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 2)
+	if err != nil {
+		return err
+	}
+	var payload interface{}
+	if len(args) == 2 {
+		if !json.Valid([]byte(args[1])) {
+			return fmt.Errorf("payload is not valid JSON")
+		}
+		payload = json.RawMessage(args[1])
+	}
+	return c.printStatus(c.client.SendEvent(c.ctx(), args[0], payload))
+}
+
+func systemInfo(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	info, err := c.client.SystemInfo(c.ctx())
+	if err != nil {
+		return err
+	}
+	return c.print(info, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "HOSTNAME\t%s\n", info.Hostname)
+		fmt.Fprintf(w, "OS\t%s\n", info.OS.PrettyName)
+		fmt.Fprintf(w, "KERNEL\t%s (%s)\n", info.Kernel, info.Arch)
+		fmt.Fprintf(w, "CPU\t%s, %d cores\n", info.CPU.Model, info.CPU.Cores)
+		fmt.Fprintf(w, "MEMORY\t%d MiB available of %d MiB\n", info.Memory.Available>>20, info.Memory.Total>>20)
+		for _, disk := range info.Disks {
+			fmt.Fprintf(w, "DISK %s\t%.1f%% used of %d MiB\n", disk.Path, disk.UsedPercent, disk.Total>>20)
+		}
+		fmt.Fprintf(w, "UPTIME\t%s\n", time.Duration(info.Uptime)*time.Second)
+		if info.Board != nil {
+			fmt.Fprintf(w, "BOARD\t%s %s\n", info.Board.Model, info.Board.Serial)
+		}
+		fmt.Fprintf(w, "RCOND\t%s %s\n", info.Rcond.Version, info.Rcond.Commit)
+	})
+}
+
+// systemHealth prints the checks, also of an unhealthy node, and fails if the node is unhealthy.
+func systemHealth(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	health, err := c.client.Health(c.ctx())
+	if health == nil {
+		return err
+	}
+	if printErr := c.print(health, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "STATUS\t%s\n\n", health.Status)
+		fmt.Fprintln(w, "CHECK\tSTATUS\tREASON")
+		for _, check := range health.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, check.Reason)
+		}
+	}); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func unitsList(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	units, err := c.client.Units(c.ctx())
+	if err != nil {
+		return err
+	}
+	return c.printUnits(units, units)
+}
+
+func unitsGet(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	unit, err := c.client.Unit(c.ctx(), args[0])
+	if err != nil {
+		return err
+	}
+	return c.printUnits(unit, []api.Unit{*unit})
+}
+
+// unitAction returns the command that runs the action on a unit.
+func unitAction(action string) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		args, err := c.parse(c.flags(), args, 1, 1)
+		if err != nil {
+			return err
+		}
+		unit, err := c.client.UnitAction(c.ctx(), args[0], action)
+		if err != nil {
+			return err
+		}
+		return c.printUnits(unit, []api.Unit{*unit})
+	}
+}
+
+// printUnits prints the result, a unit or a list of units, as a table of the units.
+func (c *cli) printUnits(result interface{}, units []api.Unit) error {
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "UNIT\tLOAD\tACTIVE\tSUB\tENABLED\tDESCRIPTION")
+		for _, u := range units {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.Name, u.LoadState, u.ActiveState, u.SubState, u.UnitFileState, u.Description)
+		}
+	})
+}
+
+func systemLogs(c *cli, args []string) error {
+	var filter api.LogFilter
+	fs := c.flags()
+	fs.Var((*listFlags)(&filter.Units), "unit", "Only entries of the unit, rcond for rcond itself, can be repeated")
+	fs.StringVar(&filter.Priority, "priority", "", "Only entries with the priority or higher, like err")
+	since := fs.Duration("since", 0, "Only entries of the last duration, like 1h")
+	fs.IntVar(&filter.Limit, "limit", 0, "Number of the newest entries")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+	logs, err := c.client.Logs(c.ctx(), filter)
+	if err != nil {
+		return err
+	}
+	return c.print(logs, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "TIME\tUNIT\tPRIORITY\tMESSAGE")
+		for _, e := range logs.Entries {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", e.Time.Local().Format(time.RFC3339), e.Unit, e.Priority, e.Message)
+		}
+	})
+}
+
+// powerAction returns the command that schedules a restart or shutdown.
+func powerAction(action string) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		var req api.PowerRequest
+		fs := c.flags()
+		fs.StringVar(&req.Delay, "delay", "", "Run after the duration, like 5m")
+		at := fs.String("at", "", "Run at the RFC3339 time")
+		fs.BoolVar(&req.Force, "force", false, "Run even if an inhibitor blocks shutdown")
+		if _, err := c.parse(fs, args, 0, 0); err != nil {
+			return err
+		}
+		if *at != "" {
+			t, err := time.Parse(time.RFC3339, *at)
+			if err != nil {
+				return fmt.Errorf("invalid time %q, expected RFC3339", *at)
+			}
+			req.At = &t
+		}
+		run := c.client.Restart
+		if action == api.PowerPoweroff {
+			run = c.client.Shutdown
+		}
+		scheduled, err := run(c.ctx(), req)
+		if err != nil {
+			return err
+		}
+		return c.printPower(scheduled, []api.PowerAction{*scheduled})
+	}
+}
+
+func systemPower(c *cli, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+	power, err := c.client.Power(c.ctx())
+	if err != nil {
+		return err
+	}
+	return c.print(power, func(w *tabwriter.Writer) {
+		printPowerActions(w, power.Pending)
+		if len(power.Failed) > 0 {
+			fmt.Fprintln(w, "\nFAILED\tACTION\tAT\tCREATED BY\tERROR")
+			for _, a := range power.Failed {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.ID, a.Action, a.At.Local().Format(time.RFC3339), a.CreatedBy, a.Error)
+			}
+		}
+		if len(power.Inhibitors) > 0 {
+			fmt.Fprintln(w, "\nINHIBITOR\tWHAT\tMODE\tWHY")
+			for _, i := range power.Inhibitors {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", i.Who, i.What, i.Mode, i.Why)
+			}
+		}
+	})
+}
+
+func systemCancel(c *cli, args []string) error {
+	args, err := c.parse(c.flags(), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+	canceled, err := c.client.CancelPower(c.ctx(), id)
+	if err != nil {
+		return err
+	}
+	return c.printPower(canceled, canceled)
+}
+
+// printPower prints the result, a power action or a list of actions, as a table of the actions.
+func (c *cli) printPower(result interface{}, actions []api.PowerAction) error {
+	return c.print(result, func(w *tabwriter.Writer) {
+		printPowerActions(w, actions)
+	})
+}
+
+func printPowerActions(w *tabwriter.Writer, actions []api.PowerAction) {
+	fmt.Fprintln(w, "ID\tACTION\tAT\tCREATED BY\tINHIBITED")
+	for _, a := range actions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", a.ID, a.Action, a.At.Local().Format(time.RFC3339), a.CreatedBy, len(a.InhibitedBy) > 0)
+	}
+}
+
+// readInput reads a file, or stdin if the name is "-".
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// tagFlags collects repeated key=value flags.
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	return formatTags(t)
+}
+
+func (t tagFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value")
+	}
+	t[key] = val
+	return nil
+}
+
+// listFlags collects repeated flags.
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
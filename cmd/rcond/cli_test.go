@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCLI(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(api.Envelope{Error: &api.Error{Code: api.CodeUnauthorized, Message: "unauthorized"}})
+			return
+		}
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/hostname":
+			json.NewEncoder(w).Encode(api.Envelope{Data: json.RawMessage(`{"hostname": "rpi-test"}`)})
+		case "/v1/network/sta":
+			json.NewEncoder(w).Encode(api.Envelope{Data: json.RawMessage(`{"uuid": "7d1c6d8e"}`)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("RCOND_URL", srv.URL)
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, _, stderr := run("hostname", "get")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unauthorized")
+
+	t.Setenv("RCOND_TOKEN", "secret")
+	code, stdout, _ := run("hostname", "get")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "rpi-test\n", stdout)
+
+	code, stdout, _ = run("hostname", "get", "-o", "json")
+	require.Equal(t, 0, code)
+	assert.JSONEq(t, `{"hostname": "rpi-test"}`, stdout)
+
+	code, stdout, _ = run("network", "sta", "--ssid", "HomeWiFi", "--password", "secret123")
+	require.Equal(t, 0, code)
+	assert.Equal(t, "7d1c6d8e\n", stdout)
+	assert.Equal(t, "HomeWiFi", body["ssid"])
+	assert.Equal(t, "wlan0", body["interface"])
+
+	code, _, stderr = run("hostname", "set")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "usage: rcond hostname set <hostname>")
+
+	code, _, _ = run("hostname", "get", "--token", "wrong")
+	assert.Equal(t, 1, code, "flags override the environment")
+
+	code, _, _ = run("network", "unknown")
+	assert.Equal(t, 2, code)
+}
@@ -1,4 +1,4 @@
-// Usage: rcond <address> <api-token>
+// Usage: rcond [flags] starts the daemon, rcond <command> <subcommand> calls the API of a daemon.
 
 package main
 
@@ -9,14 +9,20 @@ import (
 
 	"github.com/0x1d/rcond/pkg/config"
 	"github.com/0x1d/rcond/pkg/rcond"
+	"github.com/0x1d/rcond/pkg/version"
 )
 
 func usage() {
 	fmt.Println("Usage: rcond <flags>")
 	flag.PrintDefaults()
+	fmt.Println("\nRun rcond help to list the client commands.")
 }
 
 func main() {
+	if isCommand(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	appConfig, err := loadConfig()
 	if err != nil {
 		usage()
@@ -33,11 +39,19 @@ func loadConfig() (*config.Config, error) {
 	configPath := "/etc/rcond/config.yaml"
 	appConfig := &config.Config{}
 	help := false
+	showVersion := false
 
 	flag.StringVar(&configPath, "config", configPath, "Path to the configuration file")
 	flag.BoolVar(&help, "help", false, "Show help")
+	flag.BoolVar(&showVersion, "version", false, "Show the version")
 	flag.Parse()
 
+	if showVersion {
+		v := version.Get()
+		fmt.Printf("rcond %s %s %s %s\n", v.Version, v.Commit, v.BuildDate, v.GoVersion)
+		os.Exit(0)
+	}
+
 	if help {
 		usage()
 		os.Exit(0)
@@ -54,11 +68,13 @@ func loadConfig() (*config.Config, error) {
 
 	// Validate required fields
 	if err := validateRequiredFields(map[string]*string{
-		"addr":  &appConfig.Rcond.Addr,
-		"token": &appConfig.Rcond.ApiToken,
+		"addr": &appConfig.Rcond.Addr,
 	}); err != nil {
 		return nil, err
 	}
+	if appConfig.Rcond.ApiToken == "" && len(appConfig.Rcond.Tokens) == 0 && len(appConfig.Rcond.TLS.Clients) == 0 && !appConfig.Rcond.JWT.Enabled && !(appConfig.Rcond.Socket.Enabled && len(appConfig.Rcond.Socket.Peers) > 0) {
+		return nil, fmt.Errorf("token, tokens, tls clients, jwt or socket peers are required")
+	}
 
 	return appConfig, nil
 }
@@ -0,0 +1,190 @@
+// Package api holds the request and response bodies of the rcond HTTP API
+// that are shared by the server in pkg/http and the client in pkg/client.
+// The types are plain wire structs, so the client does not depend on the packages of the daemon.
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Version is the prefix of the current API version, see Envelope.
+const Version = "/v1"
+
+// Error codes of failed requests
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeDBusUnavailable  = "dbus_unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// Envelope is the body of every JSON response of the versioned API.
+// Data holds the response body of a successful request, Error describes a failed one.
+// Failed requests that respond with a body of their own, like GET /health of an unhealthy node, carry both.
+type Envelope struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *Error          `json:"error,omitempty"`
+}
+
+// Error describes a failed request of the versioned API.
+// Fields lists the invalid fields of a request that failed validation.
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// ErrorResponse is the body of error responses of the deprecated unversioned routes.
+type ErrorResponse struct {
+	Error  string       `json:"error"`
+	Code   string       `json:"code,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes an invalid field of a request body, Field is empty for errors of the whole body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// StatusResponse is the body of actions that return no data.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// StatusSuccess is the status of a successful action.
+const StatusSuccess = "success"
+
+// JobResult is the result of an operation that was run as a job with ?async=true.
+// It holds the status code and the body the operation would have responded with.
+type JobResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Health statuses of a node and of its checks
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthResponse is the body of GET /health. Status is the worst status of the checks.
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of a health check, Reason explains a status other than healthy.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ConfigureAPRequest is the body of POST /network/ap.
+type ConfigureAPRequest struct {
+	Interface   string `json:"interface"`
+	SSID        string `json:"ssid"`
+	Password    string `json:"password"`
+	Autoconnect bool   `json:"autoconnect"`
+}
+
+// ConfigureSTARequest is the body of POST /network/sta.
+type ConfigureSTARequest struct {
+	Interface   string `json:"interface"`
+	SSID        string `json:"ssid"`
+	Password    string `json:"password"`
+	Autoconnect bool   `json:"autoconnect"`
+}
+
+// Connection is a NetworkManager connection profile, returned by GET /network/connections.
+type Connection struct {
+	UUID        string `json:"uuid"`
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Interface   string `json:"interface,omitempty"`
+	AutoConnect bool   `json:"autoconnect"`
+	SSID        string `json:"ssid,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+	Active      bool   `json:"active"`
+	Device      string `json:"device,omitempty"`
+}
+
+// ConnectionResponse returns the UUID of a created connection.
+type ConnectionResponse struct {
+	UUID string `json:"uuid"`
+}
+
+// NetworkUpRequest is the body of PUT /network/interface/{interface}.
+type NetworkUpRequest struct {
+	UUID string `json:"uuid"`
+}
+
+// HostnameRequest is the body of POST /hostname.
+type HostnameRequest struct {
+	Hostname string `json:"hostname"`
+}
+
+// HostnameResponse is the body of GET /hostname.
+type HostnameResponse struct {
+	Hostname string `json:"hostname"`
+}
+
+// AuthorizedKeyRequest is the body of POST /users/{user}/keys.
+type AuthorizedKeyRequest struct {
+	User   string `json:"user,omitempty"`
+	PubKey string `json:"pubkey"`
+}
+
+// AuthorizedKeyResponse returns the fingerprint of an added key.
+type AuthorizedKeyResponse struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// FileUploadRequest is the body of POST /system/file, the content is base64 encoded.
+type FileUploadRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// CertificateInfo describes the certificate served by the API.
+type CertificateInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	IPAddresses []string  `json:"ip_addresses,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	SelfSigned  bool      `json:"self_signed"`
+	Fingerprint string    `json:"fingerprint_sha256"`
+}
+
+// CreateTokenRequest is the body of POST /tokens.
+type CreateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Token is a named API token without its secret, returned by GET /tokens.
+// Source is config for tokens of the configuration file and api for tokens created through the API.
+type Token struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Source    string     `json:"source"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// CreateTokenResponse returns the token secret once, it can not be retrieved later.
+type CreateTokenResponse struct {
+	Token
+	Secret string `json:"token"`
+}
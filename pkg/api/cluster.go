@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Member is a cluster member, returned by GET /cluster/members.
+type Member struct {
+	Name        string            `json:"name"`
+	Addr        string            `json:"addr"`
+	Port        uint16            `json:"port"`
+	Tags        map[string]string `json:"tags"`
+	Status      string            `json:"status"`
+	ProtocolMin uint8             `json:"protocol_min"`
+	ProtocolMax uint8             `json:"protocol_max"`
+	ProtocolCur uint8             `json:"protocol_cur"`
+	DelegateMin uint8             `json:"delegate_min"`
+	DelegateMax uint8             `json:"delegate_max"`
+	DelegateCur uint8             `json:"delegate_cur"`
+	// StatusChangedAt is the time the node received the last member event of the member,
+	// like its join or failure, nil if it received none since it started.
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	RTT             *float64   `json:"rtt_ms,omitempty"`
+}
+
+// MemberFilter selects members of the cluster.
+// Zero values match everything, all tags must match.
+type MemberFilter struct {
+	Status string
+	Tags   map[string]string
+}
+
+// ClusterJoinRequest is the body of POST /cluster/join.
+type ClusterJoinRequest struct {
+	Join []string `json:"join"`
+}
+
+// ClusterJoinResponse returns the number of joined nodes.
+type ClusterJoinResponse struct {
+	Joined int `json:"joined"`
+}
+
+// ClusterEventRequest is the body of POST /cluster/event.
+type ClusterEventRequest struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// EventType describes a cluster event and the JSON schema of its payload, returned by GET /cluster/events.
+type EventType struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// HistoryEntry is a cluster event received by the node, returned by GET /cluster/history.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Name    string    `json:"name,omitempty"`
+	LTime   uint64    `json:"ltime,omitempty"`
+	Sender  string    `json:"sender,omitempty"`
+	Members []string  `json:"members,omitempty"`
+	Outcome string    `json:"outcome,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// HistoryFilter selects entries from the history.
+// Zero values match everything.
+type HistoryFilter struct {
+	Type  string
+	Name  string
+	Node  string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// LeaderInfo is the body of GET /cluster/leader.
+type LeaderInfo struct {
+	Leader       string    `json:"leader"`
+	IsLeader     bool      `json:"is_leader"`
+	LeaseExpires time.Time `json:"lease_expires,omitempty"`
+}
+
+// ClusterKeyRequest is the body of POST and DELETE /cluster/keys.
+type ClusterKeyRequest struct {
+	Key     string `json:"key"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// KeyResponse is the result of a keyring operation across the cluster.
+type KeyResponse struct {
+	Keys        map[string]int    `json:"keys"`
+	PrimaryKeys map[string]int    `json:"primary_keys"`
+	NumNodes    int               `json:"num_nodes"`
+	NumResp     int               `json:"num_resp"`
+	NumErr      int               `json:"num_err"`
+	Messages    map[string]string `json:"messages,omitempty"`
+}
+
+// Selector scopes a document or a rolling restart to a set of nodes.
+// An empty selector matches every node, otherwise the node must be listed
+// in Nodes (if set) and have all Tags (if set).
+type Selector struct {
+	Nodes []string          `json:"nodes,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// Document is a versioned piece of desired state, returned by /cluster/state.
+type Document struct {
+	Key       string          `json:"key"`
+	Kind      string          `json:"kind"`
+	Version   uint64          `json:"version"`
+	Selector  Selector        `json:"selector"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	UpdatedBy string          `json:"updated_by"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ClusterStateRequest is the body of PUT /cluster/state/{key}.
+type ClusterStateRequest struct {
+	Kind     string          `json:"kind"`
+	Selector Selector        `json:"selector"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// RollingRestartRequest is the body of POST /cluster/rolling-restart.
+type RollingRestartRequest struct {
+	Selector       Selector `json:"selector"`
+	BatchSize      int      `json:"batch_size,omitempty"`
+	WaitHealthy    bool     `json:"wait_healthy"`
+	AbortOnFailure bool     `json:"abort_on_failure"`
+	Timeout        string   `json:"timeout,omitempty"`
+}
+
+// RolloutNode is the progress of a single node in a rolling restart, the result of its job lists every node.
+type RolloutNode struct {
+	Name       string     `json:"name"`
+	Batch      int        `json:"batch"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
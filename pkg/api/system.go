@@ -0,0 +1,158 @@
+package api
+
+import (
+	"time"
+
+	"github.com/0x1d/rcond/pkg/version"
+)
+
+// Actions of systemd units, see POST /system/units/{unit}/{action}
+const (
+	UnitStart   = "start"
+	UnitStop    = "stop"
+	UnitRestart = "restart"
+	UnitReload  = "reload"
+	UnitEnable  = "enable"
+	UnitDisable = "disable"
+)
+
+// Power actions
+const (
+	PowerReboot   = "reboot"
+	PowerPoweroff = "poweroff"
+)
+
+// SystemInfo is the body of GET /system/info.
+type SystemInfo struct {
+	Hostname string    `json:"hostname"`
+	OS       OSRelease `json:"os"`
+	Kernel   string    `json:"kernel"`
+	Arch     string    `json:"arch"`
+	CPU      CPU       `json:"cpu"`
+	Memory   Memory    `json:"memory"`
+	Disks    []Disk    `json:"disks"`
+	// Uptime is the time since the host booted in seconds.
+	Uptime float64 `json:"uptime_seconds"`
+	// Board is read from the device tree, it is nil on hosts without one.
+	Board *Board       `json:"board,omitempty"`
+	Rcond version.Info `json:"rcond"`
+}
+
+// OSRelease describes the operating system of the host.
+type OSRelease struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	VersionID  string `json:"version_id,omitempty"`
+	PrettyName string `json:"pretty_name"`
+}
+
+// CPU describes the processor of the host.
+type CPU struct {
+	Model string `json:"model"`
+	Cores int    `json:"cores"`
+}
+
+// Memory is the memory of the host in bytes.
+type Memory struct {
+	Total     uint64 `json:"total"`
+	Available uint64 `json:"available"`
+	Free      uint64 `json:"free"`
+}
+
+// Disk is the usage of a filesystem in bytes.
+type Disk struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Available   uint64  `json:"available"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Board describes the hardware of single-board computers.
+type Board struct {
+	Model  string `json:"model"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// Unit is the state of a systemd unit, returned by /system/units.
+type Unit struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	LoadState     string `json:"load_state"`
+	ActiveState   string `json:"active_state"`
+	SubState      string `json:"sub_state"`
+	UnitFileState string `json:"unit_file_state,omitempty"`
+}
+
+// LogFilter selects journal entries, see GET /system/logs.
+// Zero values match everything.
+type LogFilter struct {
+	Units    []string
+	Priority string
+	Since    time.Time
+	Until    time.Time
+	Cursor   string
+	Limit    int
+}
+
+// LogEntry is a journal entry.
+type LogEntry struct {
+	Time       time.Time `json:"time"`
+	Cursor     string    `json:"cursor"`
+	Unit       string    `json:"unit,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	PID        int       `json:"pid,omitempty"`
+	Priority   int       `json:"priority"`
+	Message    string    `json:"message"`
+}
+
+// LogsResponse is the body of GET /system/logs. Cursor is the cursor of the last entry,
+// it is passed as cursor to read the entries that follow. Truncated is set if entries were left out
+// to stay within the size limits of the server.
+type LogsResponse struct {
+	Entries   []LogEntry `json:"entries"`
+	Cursor    string     `json:"cursor,omitempty"`
+	Truncated bool       `json:"truncated"`
+}
+
+// PowerRequest is the optional body of POST /system/restart and /system/shutdown.
+// Delay is a duration like 5m and At a time, they are mutually exclusive. Without either, with a delay of zero
+// or a time in the past, the action runs shortly after the response and is rejected while an inhibitor blocks
+// shutdown. Force runs the action even if an inhibitor blocks shutdown.
+// Pending actions are only kept in memory by the node, they are dropped if rcond stops or restarts.
+type PowerRequest struct {
+	Delay string     `json:"delay,omitempty"`
+	At    *time.Time `json:"at,omitempty"`
+	Force bool       `json:"force,omitempty"`
+}
+
+// PowerAction is a scheduled reboot or poweroff.
+// Failed actions carry the error and the inhibitors that blocked them.
+type PowerAction struct {
+	ID          string      `json:"id"`
+	Action      string      `json:"action"`
+	At          time.Time   `json:"at"`
+	Force       bool        `json:"force,omitempty"`
+	CreatedBy   string      `json:"created_by,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	InhibitedBy []Inhibitor `json:"inhibited_by,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// Inhibitor is a lock held with logind that delays or blocks shutdown.
+type Inhibitor struct {
+	What string `json:"what"`
+	Who  string `json:"who"`
+	Why  string `json:"why"`
+	Mode string `json:"mode"`
+	UID  uint32 `json:"uid"`
+	PID  uint32 `json:"pid"`
+}
+
+// PowerResponse is the body of GET /system/power.
+type PowerResponse struct {
+	Pending    []PowerAction `json:"pending"`
+	Failed     []PowerAction `json:"failed"`
+	Inhibitors []Inhibitor   `json:"inhibitors"`
+}
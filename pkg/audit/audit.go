@@ -0,0 +1,297 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// Defaults for the audit log
+const (
+	defaultFile       = "/var/log/rcond/audit.log"
+	defaultMaxSize    = 10
+	defaultMaxBackups = 5
+	// readChunkSize is the size of the blocks in which queries read the log files.
+	readChunkSize = 64 * 1024
+)
+
+// Record is a single audited API call.
+type Record struct {
+	Time       time.Time       `json:"time"`
+	ClientIP   string          `json:"client_ip"`
+	Identity   string          `json:"identity,omitempty"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"`
+	Path       string          `json:"path"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Status     int             `json:"status"`
+	DurationMS float64         `json:"duration_ms"`
+}
+
+// Filter selects audit records. Zero values match everything.
+type Filter struct {
+	Identity string
+	Method   string
+	Route    string
+	Status   int
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+func (f Filter) matches(r Record) bool {
+	if f.Identity != "" && r.Identity != f.Identity {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(r.Method, f.Method) {
+		return false
+	}
+	if f.Route != "" && !strings.HasPrefix(r.Route, f.Route) {
+		return false
+	}
+	if f.Status != 0 && r.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log writes audit records to a rotating file and optionally to journald.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	journal    *journal
+}
+
+// NewLog opens the audit log file of the configuration.
+func NewLog(cfg *config.AuditConfig) (*Log, error) {
+	l := &Log{
+		path:       cfg.File,
+		maxSize:    int64(cfg.MaxSize) * 1024 * 1024,
+		maxBackups: cfg.MaxBackups,
+	}
+	if l.path == "" {
+		l.path = defaultFile
+	}
+	if l.maxSize <= 0 {
+		l.maxSize = defaultMaxSize * 1024 * 1024
+	}
+	if l.maxBackups <= 0 {
+		l.maxBackups = defaultMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if cfg.Journald {
+		j, err := newJournal()
+		if err != nil {
+			log.Printf("[WARN] Audit records are not sent to journald: %v", err)
+		} else {
+			l.journal = j
+		}
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Record writes a record to the audit log.
+// Errors are logged, an audit failure does not fail the API call.
+func (l *Log) Record(record Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("[ERROR] Failed to encode audit record: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size+int64(len(data)) > l.maxSize && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			log.Printf("[ERROR] Failed to rotate audit log: %v", err)
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("[ERROR] Failed to write audit record: %v", err)
+	}
+	if l.journal != nil {
+		if err := l.journal.send(record, data[:len(data)-1]); err != nil {
+			log.Printf("[ERROR] Failed to send audit record to journald: %v", err)
+		}
+	}
+}
+
+// rotate renames the log file to .1, shifting older backups and removing the oldest one.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(l.backup(l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		os.Rename(l.backup(i), l.backup(i+1))
+	}
+	if err := os.Rename(l.path, l.backup(1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *Log) backup(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// Query returns the records matching the filter from the log file and its backups, newest first.
+// The files are opened while the log is locked, so a concurrent rotation does not move records between them,
+// and are read backwards afterwards without blocking the writers.
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	files, err := l.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	result := []Record{}
+	for _, f := range files {
+		done := false
+		err := readLinesBackwards(f.file, f.size, func(line []byte) bool {
+			var record Record
+			if err := json.Unmarshal(line, &record); err != nil || !filter.matches(record) {
+				return true
+			}
+			result = append(result, record)
+			done = filter.Limit > 0 && len(result) >= filter.Limit
+			return !done
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %v", err)
+		}
+		if done {
+			break
+		}
+	}
+	return result, nil
+}
+
+// logFile is an opened log file and the size of its complete records.
+type logFile struct {
+	file *os.File
+	size int64
+}
+
+// openFiles opens the log file and its backups, newest first.
+func (l *Log) openFiles() ([]logFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var files []logFile
+	for i := 0; i <= l.maxBackups; i++ {
+		path := l.path
+		if i > 0 {
+			path = l.backup(i)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("failed to open audit log: %v", err)
+		}
+		size := l.size
+		if i > 0 {
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				closeFiles(files)
+				return nil, fmt.Errorf("failed to open audit log: %v", err)
+			}
+			size = info.Size()
+		}
+		files = append(files, logFile{file: f, size: size})
+	}
+	return files, nil
+}
+
+func closeFiles(files []logFile) {
+	for _, f := range files {
+		f.file.Close()
+	}
+}
+
+// readLinesBackwards calls fn for the lines of the first size bytes of f, the last line first,
+// until fn returns false. The file is read in chunks, so only a chunk and the current line are held in memory.
+func readLinesBackwards(f *os.File, size int64, fn func(line []byte) bool) error {
+	buf := make([]byte, readChunkSize)
+	var partial []byte
+	for offset := size; offset > 0; {
+		n := int64(len(buf))
+		if n > offset {
+			n = offset
+		}
+		offset -= n
+		if _, err := f.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return err
+		}
+		chunk := append(buf[:n:n], partial...)
+		for {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			if line := chunk[i+1:]; len(line) > 0 && !fn(line) {
+				return nil
+			}
+			chunk = chunk[:i]
+		}
+		partial = append([]byte(nil), chunk...)
+	}
+	if len(partial) > 0 {
+		fn(partial)
+	}
+	return nil
+}
+
+// Close closes the audit log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.journal != nil {
+		l.journal.close()
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	body := `{"ssid":"lab","password":"secret","value":{"connections":[{"PSK":"secret"}]},"file":"` + strings.Repeat("x", 300) + `"}`
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(Sanitize([]byte(body)), &got))
+	assert.Equal(t, "lab", got["ssid"])
+	assert.Equal(t, Redacted, got["password"])
+	assert.Equal(t, Redacted, got["value"].(map[string]interface{})["connections"].([]interface{})[0].(map[string]interface{})["PSK"])
+	assert.Len(t, got["file"], maxValueLength+3)
+
+	assert.JSONEq(t, `"<8 bytes>"`, string(Sanitize([]byte("not json"))))
+	assert.Nil(t, Sanitize(nil))
+}
+
+func TestLogRotateAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := NewLog(&config.AuditConfig{File: path, MaxBackups: 2})
+	require.NoError(t, err)
+	defer l.Close()
+	// rotate after every record
+	l.maxSize = 1
+
+	start := time.Now().UTC()
+	for i, identity := range []string{"a", "b", "a", "c"} {
+		l.Record(Record{Time: start.Add(time.Duration(i) * time.Second), Identity: identity, Method: "POST", Route: "/hostname", Status: 200})
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	records, err := l.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "c", records[0].Identity)
+
+	records, err = l.Query(Filter{Identity: "a"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, start.Add(2*time.Second), records[0].Time)
+
+	records, err = l.Query(Filter{Limit: 1, Since: start.Add(time.Second)})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestReadLinesBackwards(t *testing.T) {
+	long := strings.Repeat("x", 2*readChunkSize)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"+long+"\nlast\nincomplete"), 0640))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []string
+	size := int64(len("first\n" + long + "\nlast\n"))
+	require.NoError(t, readLinesBackwards(f, size, func(line []byte) bool {
+		lines = append(lines, string(line))
+		return true
+	}))
+	assert.Equal(t, []string{"last", long, "first"}, lines)
+
+	lines = nil
+	require.NoError(t, readLinesBackwards(f, size, func(line []byte) bool {
+		lines = append(lines, string(line))
+		return len(lines) < 2
+	}))
+	assert.Equal(t, []string{"last", long}, lines)
+}
+
+func TestWriteJournalField(t *testing.T) {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", "hello")
+	assert.Equal(t, "MESSAGE=hello\n", buf.String())
+
+	buf.Reset()
+	writeJournalField(&buf, "MESSAGE", "a\nb")
+	assert.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", buf.String())
+}
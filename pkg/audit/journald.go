@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is the socket of the systemd journal native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journal sends audit records to journald using its native protocol.
+type journal struct {
+	conn *net.UnixConn
+}
+
+func newJournal() (*journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journal{conn: conn}, nil
+}
+
+// send writes the record as journal entry with the JSON record as message
+// and the main attributes as separate fields.
+func (j *journal) send(record Record, message []byte) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", string(message))
+	writeJournalField(&buf, "PRIORITY", "6")
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", "rcond-audit")
+	writeJournalField(&buf, "RCOND_IDENTITY", record.Identity)
+	writeJournalField(&buf, "RCOND_CLIENT_IP", record.ClientIP)
+	writeJournalField(&buf, "RCOND_METHOD", record.Method)
+	writeJournalField(&buf, "RCOND_ROUTE", record.Route)
+	writeJournalField(&buf, "RCOND_STATUS", strconv.Itoa(record.Status))
+	if _, err := j.conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write to journal: %v", err)
+	}
+	return nil
+}
+
+// writeJournalField encodes a field, values containing newlines use the binary length-prefixed format.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (j *journal) close() {
+	j.conn.Close()
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Redacted replaces sensitive values in audit records.
+const Redacted = "[REDACTED]"
+
+// maxValueLength is the length of string values kept in audit records, longer values are truncated.
+const maxValueLength = 256
+
+// sensitiveFields are the JSON fields whose values are never written to the audit log.
+var sensitiveFields = map[string]bool{
+	"password":    true,
+	"psk":         true,
+	"key":         true,
+	"pubkey":      true,
+	"secret":      true,
+	"secret_key":  true,
+	"private_key": true,
+	"token":       true,
+	"content":     true,
+}
+
+// Sanitize returns a copy of a JSON request body with sensitive fields redacted
+// and long strings truncated. Bodies that are not JSON are replaced by their size.
+func Sanitize(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		data, _ := json.Marshal(fmt.Sprintf("<%d bytes>", len(body)))
+		return data
+	}
+	data, err := json.Marshal(sanitizeValue(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func sanitizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = sanitizeValue(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = sanitizeValue(item)
+		}
+		return v
+	case string:
+		if len(v) > maxValueLength {
+			return v[:maxValueLength] + "..."
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// CertMapper maps verified client certificates to identities.
+type CertMapper struct {
+	clients map[string][]string
+}
+
+// NewCertMapper creates a mapper from the configured TLS clients.
+func NewCertMapper(clients []config.TLSClientConfig) (*CertMapper, error) {
+	m := &CertMapper{clients: make(map[string][]string)}
+	for _, client := range clients {
+		if client.Name == "" {
+			return nil, fmt.Errorf("tls client name is required")
+		}
+		if err := ValidateScopes(client.Scopes); err != nil {
+			return nil, fmt.Errorf("tls client %s: %v", client.Name, err)
+		}
+		m.clients[client.Name] = client.Scopes
+	}
+	return m, nil
+}
+
+// Identify returns the identity of a client certificate.
+// The common name is matched first, then the DNS names and email addresses.
+// Returns false if no configured client matches the certificate.
+func (m *CertMapper) Identify(cert *x509.Certificate) (*Identity, bool) {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, name := range names {
+		if scopes, ok := m.clients[name]; ok && name != "" {
+			return &Identity{Name: name, Scopes: scopes}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertMapperIdentify(t *testing.T) {
+	mapper, err := NewCertMapper([]config.TLSClientConfig{
+		{Name: "ci", Scopes: []string{ScopeFilesWrite}},
+		{Name: "ops@example.com", Scopes: []string{ScopeAll}},
+	})
+	require.NoError(t, err)
+
+	identity, ok := mapper.Identify(&x509.Certificate{Subject: pkix.Name{CommonName: "ci"}})
+	require.True(t, ok)
+	assert.Equal(t, "ci", identity.Name)
+	assert.Equal(t, []string{ScopeFilesWrite}, identity.Scopes)
+
+	identity, ok = mapper.Identify(&x509.Certificate{EmailAddresses: []string{"ops@example.com"}})
+	require.True(t, ok)
+	assert.Equal(t, "ops@example.com", identity.Name)
+
+	_, ok = mapper.Identify(&x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}})
+	assert.False(t, ok)
+
+	_, err = NewCertMapper([]config.TLSClientConfig{{Name: "ci", Scopes: []string{"root"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,442 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// ErrInvalidToken is returned when a JWT can not be verified.
+var ErrInvalidToken = errors.New("invalid token")
+
+const (
+	defaultJWKSRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits how often keys are fetched for tokens with an unknown key ID.
+	jwksMinRefreshInterval = time.Minute
+	// jwtLeeway tolerates clock skew between the issuer and the node.
+	jwtLeeway         = time.Minute
+	defaultNameClaim  = "sub"
+	defaultScopeClaim = "scope"
+)
+
+// JWTVerifier verifies JWT bearer tokens and maps their claims to scopes.
+type JWTVerifier struct {
+	cfg    config.JWTConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        []publicKey
+	lastFetch   time.Time
+	fileModTime time.Time
+	refreshing  bool
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// NewJWTVerifier creates a verifier and loads the key set.
+// If keys are fetched from the issuer and it is unreachable, the cached key set is used.
+func NewJWTVerifier(cfg *config.JWTConfig) (*JWTVerifier, error) {
+	for _, claim := range cfg.Claims {
+		if err := ValidateScopes(claim.Scopes); err != nil {
+			return nil, fmt.Errorf("jwt claim %s: %v", claim.Claim, err)
+		}
+	}
+	v := &JWTVerifier{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if v.cfg.NameClaim == "" {
+		v.cfg.NameClaim = defaultNameClaim
+	}
+	if v.cfg.ScopeClaim == "" {
+		v.cfg.ScopeClaim = defaultScopeClaim
+	}
+	if v.cfg.RefreshInterval <= 0 {
+		v.cfg.RefreshInterval = defaultJWKSRefreshInterval
+	}
+
+	if v.cfg.JWKSFile != "" {
+		if err := v.loadFile(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if v.cfg.CacheFile != "" {
+		if data, err := os.ReadFile(v.cfg.CacheFile); err == nil {
+			if keys, err := parseJWKS(data); err == nil {
+				v.keys = keys
+			}
+		}
+	}
+	if err := v.fetch(); err != nil {
+		if len(v.keys) == 0 {
+			log.Printf("[WARN] Failed to fetch JWKS, JWT authentication is unavailable until it succeeds: %v", err)
+		} else {
+			log.Printf("[WARN] Failed to fetch JWKS, using cached keys: %v", err)
+		}
+	}
+	return v, nil
+}
+
+// Watch refreshes the key set periodically until done is closed.
+func (v *JWTVerifier) Watch(done <-chan struct{}) {
+	ticker := time.NewTicker(v.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := v.refresh(); err != nil {
+				log.Printf("[WARN] Failed to refresh JWKS: %v", err)
+			}
+		}
+	}
+}
+
+func (v *JWTVerifier) refresh() error {
+	if v.cfg.JWKSFile != "" {
+		info, err := os.Stat(v.cfg.JWKSFile)
+		if err != nil {
+			return err
+		}
+		v.mu.RLock()
+		unchanged := info.ModTime().Equal(v.fileModTime)
+		v.mu.RUnlock()
+		if unchanged {
+			return nil
+		}
+		return v.loadFile()
+	}
+	return v.fetch()
+}
+
+func (v *JWTVerifier) loadFile() error {
+	info, err := os.Stat(v.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %v", err)
+	}
+	data, err := os.ReadFile(v.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %v", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.fileModTime = info.ModTime()
+	v.mu.Unlock()
+	return nil
+}
+
+// fetch downloads the key set from the JWKS URL or the issuer's discovery document
+// and writes it to the cache file.
+func (v *JWTVerifier) fetch() error {
+	v.mu.Lock()
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+
+	url := v.cfg.JWKSURL
+	if url == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		data, err := v.get(strings.TrimSuffix(v.cfg.Issuer, "/") + "/.well-known/openid-configuration")
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &discovery); err != nil || discovery.JWKSURI == "" {
+			return fmt.Errorf("invalid discovery document of %s", v.cfg.Issuer)
+		}
+		url = discovery.JWKSURI
+	}
+	data, err := v.get(url)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+
+	if v.cfg.CacheFile != "" {
+		if err := writeCache(v.cfg.CacheFile, data); err != nil {
+			log.Printf("[WARN] Failed to cache JWKS: %v", err)
+		}
+	}
+	return nil
+}
+
+func (v *JWTVerifier) get(url string) ([]byte, error) {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func writeCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Verify checks the signature and the registered claims of a token
+// and returns the identity with the scopes mapped from its claims.
+func (v *JWTVerifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	if err := v.verifySignature(header, signed, signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(parts[1])))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	name, _ := claims[v.cfg.NameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.cfg.NameClaim)
+	}
+	return &Identity{Name: name, Scopes: v.scopes(claims)}, nil
+}
+
+// verifySignature verifies the signature with the keys matching the key ID of the header.
+// Unknown key IDs are rejected right away and trigger a refresh of remote key sets in the background,
+// rate limited by jwksMinRefreshInterval, so tokens signed with a rotated key pass once it finished.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed, signature []byte) error {
+	if _, ok := signatureHashes[header.Alg]; !ok && header.Alg != "EdDSA" {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	keys := v.keysFor(header)
+	if len(keys) == 0 && header.Kid != "" && v.cfg.JWKSFile == "" {
+		v.refreshInBackground()
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: no key found for kid %q", ErrInvalidToken, header.Kid)
+	}
+	for _, key := range keys {
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verify(header.Alg, key.key, signed, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// refreshInBackground fetches the key set unless a fetch is running or the last one is too recent.
+func (v *JWTVerifier) refreshInBackground() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.refreshing || time.Since(v.lastFetch) <= jwksMinRefreshInterval {
+		return
+	}
+	v.refreshing = true
+	go func() {
+		if err := v.fetch(); err != nil {
+			log.Printf("[WARN] Failed to fetch JWKS: %v", err)
+		}
+		v.mu.Lock()
+		v.refreshing = false
+		v.mu.Unlock()
+	}()
+}
+
+func (v *JWTVerifier) keysFor(header jwtHeader) []publicKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var keys []publicKey
+	for _, key := range v.keys {
+		if header.Kid == "" || key.kid == header.Kid {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(exp.Add(jwtLeeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(jwtLeeway).Before(nbf) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(v.cfg.Issuer, "/") {
+			return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+		}
+	}
+	if v.cfg.Audience != "" && !containsString(claimValues(claims["aud"]), v.cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// scopes returns the known scopes of the scope claim and the scopes of matching claim mappings.
+func (v *JWTVerifier) scopes(claims map[string]interface{}) []string {
+	granted := []string{}
+	add := func(scope string) {
+		if _, ok := scopes[scope]; ok && !containsString(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	for _, value := range claimValues(claims[v.cfg.ScopeClaim]) {
+		for _, scope := range strings.Fields(value) {
+			add(scope)
+		}
+	}
+	for _, mapping := range v.cfg.Claims {
+		if containsString(claimValues(claims[mapping.Claim]), mapping.Value) {
+			for _, scope := range mapping.Scopes {
+				add(scope)
+			}
+		}
+	}
+	return granted
+}
+
+// signatureHashes maps the supported RSA and ECDSA algorithms to their hash.
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+func verify(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signed, signature)
+	}
+	hash := signatureHashes[alg]
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// claimValues returns the string values of a claim that is a string or an array of strings.
+func claimValues(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func testJWKS(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	return data
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, testJWKS(rsaKey, ecKey), 0644))
+
+	v, err := NewJWTVerifier(&config.JWTConfig{
+		Issuer:   "https://id.example.com",
+		Audience: "rcond",
+		JWKSFile: jwksFile,
+		Claims:   []config.JWTClaimConfig{{Claim: "groups", Value: "ops", Scopes: []string{ScopeSystemPower}}},
+	})
+	require.NoError(t, err)
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":    "alice",
+			"iss":    "https://id.example.com",
+			"aud":    []string{"rcond", "other"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"scope":  "openid network:read unknown:scope",
+			"groups": []string{"ops"},
+		}
+		for k, val := range changes {
+			c[k] = val
+		}
+		return c
+	}
+
+	identity, err := v.Verify(signJWT(t, "RS256", "rsa", rsaKey, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Name)
+	assert.Equal(t, []string{ScopeNetworkRead, ScopeSystemPower}, identity.Scopes)
+
+	_, err = v.Verify(signJWT(t, "ES256", "ec", ecKey, claims(nil)))
+	assert.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"expired":       signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"issuer":        signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"audience":      signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})),
+		"missing exp":   signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})),
+		"wrong key":     signJWT(t, "RS256", "ec", rsaKey, claims(nil)),
+		"unknown kid":   signJWT(t, "RS256", "other", rsaKey, claims(nil)),
+		"alg none":      b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".",
+		"malformed":     "abc",
+		"tampered body": signJWT(t, "RS256", "rsa", rsaKey, claims(nil))[:10] + "x",
+	} {
+		_, err := v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+}
+
+func TestJWTVerifierIssuerCache(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer": %q, "jwks_uri": %q}`, issuer, issuer+"/keys")
+		case "/keys":
+			w.Write(testJWKS(rsaKey, ecKey))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	issuer = srv.URL
+	cache := filepath.Join(t.TempDir(), "jwks-cache.json")
+	cfg := &config.JWTConfig{Issuer: issuer, CacheFile: cache}
+
+	v, err := NewJWTVerifier(cfg)
+	require.NoError(t, err)
+	token := signJWT(t, "RS256", "rsa", rsaKey, map[string]interface{}{"sub": "bob", "iss": issuer, "exp": time.Now().Add(time.Hour).Unix()})
+	_, err = v.Verify(token)
+	require.NoError(t, err)
+	assert.FileExists(t, cache)
+
+	// the cached key set is used while the issuer is unreachable
+	srv.Close()
+	v, err = NewJWTVerifier(cfg)
+	require.NoError(t, err)
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", identity.Name)
+	assert.Empty(t, identity.Scopes)
+}
+
+func TestJWTVerifierUnknownKid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rotatedJWKS, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rotated", "n": b64(rotated.N.Bytes()), "e": b64(big.NewInt(int64(rotated.E)).Bytes())},
+	}})
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			w.Write(testJWKS(rsaKey, ecKey))
+			return
+		}
+		// the issuer is slow to answer the refresh
+		<-release
+		w.Write(rotatedJWKS)
+	}))
+	defer srv.Close()
+	v, err := NewJWTVerifier(&config.JWTConfig{Issuer: srv.URL, JWKSURL: srv.URL + "/keys"})
+	require.NoError(t, err)
+	v.mu.Lock()
+	v.lastFetch = time.Now().Add(-time.Hour)
+	v.mu.Unlock()
+
+	token := signJWT(t, "RS256", "rotated", rotated, map[string]interface{}{"sub": "carol", "iss": srv.URL, "exp": time.Now().Add(time.Hour).Unix()})
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(token)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrInvalidToken, "unknown key IDs are answered from the cached key set")
+	case <-time.After(time.Second):
+		t.Fatal("verification waited for the key set to be fetched")
+	}
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		_, err := v.Verify(token)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), fetches.Load(), "a single refresh is started")
+}
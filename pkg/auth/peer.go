@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// PeerMapper maps the credentials of Unix socket clients to identities.
+type PeerMapper struct {
+	users  map[uint32][]string
+	groups map[uint32][]string
+}
+
+// NewPeerMapper creates a mapper from the configured socket peers.
+// User and group names are resolved to IDs once.
+func NewPeerMapper(peers []config.SocketPeerConfig) (*PeerMapper, error) {
+	m := &PeerMapper{users: make(map[uint32][]string), groups: make(map[uint32][]string)}
+	for _, peer := range peers {
+		if err := ValidateScopes(peer.Scopes); err != nil {
+			return nil, fmt.Errorf("socket peer %s%s: %v", peer.User, peer.Group, err)
+		}
+		if peer.User != "" {
+			uid, err := lookupUID(peer.User)
+			if err != nil {
+				return nil, err
+			}
+			m.users[uid] = append(m.users[uid], peer.Scopes...)
+		}
+		if peer.Group != "" {
+			gid, err := LookupGID(peer.Group)
+			if err != nil {
+				return nil, err
+			}
+			m.groups[gid] = append(m.groups[gid], peer.Scopes...)
+		}
+	}
+	return m, nil
+}
+
+// Len returns the number of configured users and groups.
+func (m *PeerMapper) Len() int {
+	return len(m.users) + len(m.groups)
+}
+
+// Identify returns the identity of a socket client running with the uid and gid.
+// The scopes of the user, of its primary group and of its supplementary groups are combined.
+// Returns false if no configured peer matches the client.
+func (m *PeerMapper) Identify(uid, gid uint32) (*Identity, bool) {
+	name := strconv.FormatUint(uint64(uid), 10)
+	gids := []uint32{gid}
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if n, err := strconv.ParseUint(id, 10, 32); err == nil && uint32(n) != gid {
+					gids = append(gids, uint32(n))
+				}
+			}
+		}
+	}
+	scopes, matched := m.users[uid]
+	for _, id := range gids {
+		if groupScopes, ok := m.groups[id]; ok {
+			scopes = append(append([]string(nil), scopes...), groupScopes...)
+			matched = true
+		}
+	}
+	if !matched {
+		return nil, false
+	}
+	return &Identity{Name: "unix:" + name, Scopes: scopes}, true
+}
+
+func lookupUID(name string) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("socket peer user %s: %v", name, err)
+	}
+	id, err := strconv.ParseUint(u.Uid, 10, 32)
+	return uint32(id), err
+}
+
+// LookupGID resolves a group name or numeric ID.
+func LookupGID(name string) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("group %s: %v", name, err)
+	}
+	id, err := strconv.ParseUint(g.Gid, 10, 32)
+	return uint32(id), err
+}
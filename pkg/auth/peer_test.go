@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerMapperIdentify(t *testing.T) {
+	mapper, err := NewPeerMapper([]config.SocketPeerConfig{
+		{User: "54321", Scopes: []string{ScopeNetworkRead}},
+		{Group: "54322", Scopes: []string{ScopeFilesWrite}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, mapper.Len())
+
+	identity, ok := mapper.Identify(54321, 54321)
+	require.True(t, ok)
+	assert.Equal(t, "unix:54321", identity.Name)
+	assert.Equal(t, []string{ScopeNetworkRead}, identity.Scopes)
+
+	identity, ok = mapper.Identify(54321, 54322)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{ScopeNetworkRead, ScopeFilesWrite}, identity.Scopes)
+
+	identity, ok = mapper.Identify(54323, 54322)
+	require.True(t, ok)
+	assert.Equal(t, []string{ScopeFilesWrite}, identity.Scopes)
+
+	_, ok = mapper.Identify(54323, 54323)
+	assert.False(t, ok)
+
+	_, err = NewPeerMapper([]config.SocketPeerConfig{{User: "54321", Scopes: []string{"root"}}})
+	assert.Error(t, err)
+	_, err = NewPeerMapper([]config.SocketPeerConfig{{User: "no-such-user-rcond", Scopes: []string{ScopeAll}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Scopes granted to API clients
+const (
+	ScopeNetworkRead  = "network:read"
+	ScopeNetworkWrite = "network:write"
+	ScopeSystemRead   = "system:read"
+	ScopeSystemPower  = "system:power"
+	ScopeUnitsRead    = "units:read"
+	ScopeUnitsWrite   = "units:write"
+	ScopeLogsRead     = "logs:read"
+	ScopeFilesWrite   = "files:write"
+	ScopeUsersWrite   = "users:write"
+	ScopeClusterRead  = "cluster:read"
+	ScopeClusterAdmin = "cluster:admin"
+	ScopeTokensAdmin  = "tokens:admin"
+	ScopeAuditRead    = "audit:read"
+	ScopeMetricsRead  = "metrics:read"
+	// ScopeAll grants every scope.
+	ScopeAll = "*"
+)
+
+// scopes lists the known scopes and the scopes they imply.
+var scopes = map[string][]string{
+	ScopeNetworkRead:  nil,
+	ScopeNetworkWrite: {ScopeNetworkRead},
+	ScopeSystemRead:   nil,
+	ScopeSystemPower:  nil,
+	ScopeUnitsRead:    nil,
+	ScopeUnitsWrite:   {ScopeUnitsRead},
+	ScopeLogsRead:     nil,
+	ScopeFilesWrite:   nil,
+	ScopeUsersWrite:   nil,
+	ScopeClusterRead:  nil,
+	ScopeClusterAdmin: {ScopeClusterRead},
+	ScopeTokensAdmin:  nil,
+	ScopeAuditRead:    nil,
+	ScopeMetricsRead:  nil,
+	ScopeAll:          nil,
+}
+
+// ValidateScopes returns an error if a scope is unknown.
+func ValidateScopes(values []string) error {
+	for _, scope := range values {
+		if _, ok := scopes[scope]; !ok {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// Identity is an authenticated API client.
+type Identity struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Allows reports whether the identity was granted the scope, directly or implied by another scope.
+func (i *Identity) Allows(scope string) bool {
+	for _, granted := range i.Scopes {
+		if granted == ScopeAll || granted == scope {
+			return true
+		}
+		for _, implied := range scopes[granted] {
+			if implied == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the request, if it was authenticated.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+var (
+	// ErrUnauthorized is returned when a token is missing or unknown.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTokenNotFound is returned when a named token does not exist.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenExists is returned when a token with the same name already exists.
+	ErrTokenExists = errors.New("token already exists")
+	// ErrTokenReadOnly is returned when a token from the configuration file is revoked.
+	ErrTokenReadOnly = errors.New("token is defined in the configuration and can not be revoked")
+)
+
+// DefaultTokenName is the name of the token configured with api_token.
+const DefaultTokenName = "default"
+
+// Token sources
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+var tokenNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Token describes a named API token. The token itself is never stored, only its hash.
+type Token struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Source    string     `json:"source"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	hash []byte
+}
+
+// storedToken is the representation of a token in the token file.
+type storedToken struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenStore authenticates API tokens.
+// Tokens from the configuration are read-only, tokens created at runtime are
+// written to the token file if a path is set.
+type TokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens map[string]*Token
+}
+
+// NewTokenStore creates a token store from the API server configuration.
+// The legacy api_token is added as token "default" with every scope.
+func NewTokenStore(cfg *config.RcondConfig) (*TokenStore, error) {
+	s := &TokenStore{
+		path:   cfg.TokenFile,
+		tokens: make(map[string]*Token),
+	}
+	if cfg.ApiToken != "" {
+		s.tokens[DefaultTokenName] = &Token{
+			Name:   DefaultTokenName,
+			Scopes: []string{ScopeAll},
+			Source: SourceConfig,
+			hash:   hashToken(cfg.ApiToken),
+		}
+	}
+	for _, tc := range cfg.Tokens {
+		if err := ValidateScopes(tc.Scopes); err != nil {
+			return nil, fmt.Errorf("token %s: %v", tc.Name, err)
+		}
+		hash, err := parseHash(tc.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %v", tc.Name, err)
+		}
+		if _, ok := s.tokens[tc.Name]; ok {
+			return nil, fmt.Errorf("token %s: %w", tc.Name, ErrTokenExists)
+		}
+		s.tokens[tc.Name] = &Token{Name: tc.Name, Scopes: tc.Scopes, Source: SourceConfig, hash: hash}
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Len returns the number of known tokens.
+func (s *TokenStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokens)
+}
+
+// Authenticate returns the identity of the token.
+// The hash of the token is compared in constant time against every known token.
+func (s *TokenStore) Authenticate(secret string) (*Identity, error) {
+	if secret == "" {
+		return nil, ErrUnauthorized
+	}
+	hash := hashToken(secret)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var match *Token
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, token.hash) == 1 {
+			match = token
+		}
+	}
+	if match == nil {
+		return nil, ErrUnauthorized
+	}
+	return &Identity{Name: match.Name, Scopes: match.Scopes}, nil
+}
+
+// List returns all tokens sorted by name.
+func (s *TokenStore) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, *token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens
+}
+
+// Create generates a new token with the given name and scopes.
+// Returns the token secret, which is not retrievable afterwards.
+func (s *TokenStore) Create(name string, scopes []string) (string, *Token, error) {
+	if !tokenNamePattern.MatchString(name) {
+		return "", nil, fmt.Errorf("invalid token name %q", name)
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+	secret := hex.EncodeToString(b)
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[name]; ok {
+		return "", nil, ErrTokenExists
+	}
+	token := &Token{Name: name, Scopes: scopes, Source: SourceAPI, CreatedAt: &now, hash: hashToken(secret)}
+	s.tokens[name] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, name)
+		return "", nil, fmt.Errorf("failed to save tokens: %v", err)
+	}
+	return secret, token, nil
+}
+
+// Revoke removes a token created through the API.
+func (s *TokenStore) Revoke(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[name]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	if token.Source == SourceConfig {
+		return ErrTokenReadOnly
+	}
+	delete(s.tokens, name)
+	if err := s.save(); err != nil {
+		s.tokens[name] = token
+		return fmt.Errorf("failed to save tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *TokenStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %v", err)
+	}
+	var stored []storedToken
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("invalid token file %s: %v", s.path, err)
+	}
+	for _, st := range stored {
+		hash, err := parseHash(st.Hash)
+		if err != nil {
+			return fmt.Errorf("token %s: %v", st.Name, err)
+		}
+		if _, ok := s.tokens[st.Name]; ok {
+			return fmt.Errorf("token %s: %w", st.Name, ErrTokenExists)
+		}
+		createdAt := st.CreatedAt
+		s.tokens[st.Name] = &Token{Name: st.Name, Scopes: st.Scopes, Source: SourceAPI, CreatedAt: &createdAt, hash: hash}
+	}
+	return nil
+}
+
+// save writes the tokens created through the API to the token file. The caller must hold the lock.
+func (s *TokenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	stored := []storedToken{}
+	for _, token := range s.tokens {
+		if token.Source != SourceAPI {
+			continue
+		}
+		stored = append(stored, storedToken{
+			Name:      token.Name,
+			Hash:      "sha256:" + hex.EncodeToString(token.hash),
+			Scopes:    token.Scopes,
+			CreatedAt: *token.CreatedAt,
+		})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Name < stored[j].Name })
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// HashToken returns the hash of a token as stored in the configuration.
+func HashToken(secret string) string {
+	return "sha256:" + hex.EncodeToString(hashToken(secret))
+}
+
+func hashToken(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+func parseHash(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, "sha256:") {
+		return nil, errors.New("hash must be formatted as sha256:<hex>")
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(value, "sha256:"))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, errors.New("hash must be formatted as sha256:<hex>")
+	}
+	return hash, nil
+}
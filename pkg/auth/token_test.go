@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityAllows(t *testing.T) {
+	identity := &Identity{Scopes: []string{ScopeNetworkWrite, ScopeClusterAdmin}}
+	assert.True(t, identity.Allows(ScopeNetworkWrite))
+	assert.True(t, identity.Allows(ScopeNetworkRead))
+	assert.True(t, identity.Allows(ScopeClusterRead))
+	assert.False(t, identity.Allows(ScopeSystemPower))
+	assert.True(t, (&Identity{Scopes: []string{ScopeAll}}).Allows(ScopeSystemPower))
+	assert.False(t, (&Identity{Scopes: []string{ScopeNetworkRead}}).Allows(ScopeNetworkWrite))
+}
+
+func TestTokenStoreAuthenticate(t *testing.T) {
+	store, err := NewTokenStore(&config.RcondConfig{
+		ApiToken: "legacy",
+		Tokens: []config.TokenConfig{
+			{Name: "monitor", Hash: HashToken("secret"), Scopes: []string{ScopeNetworkRead}},
+		},
+	})
+	require.NoError(t, err)
+
+	identity, err := store.Authenticate("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "monitor", identity.Name)
+	assert.Equal(t, []string{ScopeNetworkRead}, identity.Scopes)
+
+	identity, err = store.Authenticate("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTokenName, identity.Name)
+
+	_, err = store.Authenticate("wrong")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = store.Authenticate("")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = NewTokenStore(&config.RcondConfig{Tokens: []config.TokenConfig{{Name: "x", Hash: HashToken("x"), Scopes: []string{"root"}}}})
+	assert.Error(t, err)
+}
+
+func TestTokenStoreCreateRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewTokenStore(&config.RcondConfig{ApiToken: "legacy", TokenFile: path})
+	require.NoError(t, err)
+
+	secret, token, err := store.Create("ci", []string{ScopeFilesWrite})
+	require.NoError(t, err)
+	assert.Equal(t, SourceAPI, token.Source)
+	_, _, err = store.Create("ci", []string{ScopeFilesWrite})
+	assert.ErrorIs(t, err, ErrTokenExists)
+	_, _, err = store.Create("bad name", []string{ScopeFilesWrite})
+	assert.Error(t, err)
+	_, _, err = store.Create("empty", nil)
+	assert.Error(t, err)
+
+	// created tokens survive a restart
+	reloaded, err := NewTokenStore(&config.RcondConfig{ApiToken: "legacy", TokenFile: path})
+	require.NoError(t, err)
+	identity, err := reloaded.Authenticate(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", identity.Name)
+	assert.Len(t, reloaded.List(), 2)
+
+	assert.ErrorIs(t, reloaded.Revoke(DefaultTokenName), ErrTokenReadOnly)
+	assert.ErrorIs(t, reloaded.Revoke("missing"), ErrTokenNotFound)
+	require.NoError(t, reloaded.Revoke("ci"))
+	_, err = reloaded.Authenticate(secret)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	reloaded, err = NewTokenStore(&config.RcondConfig{TokenFile: path})
+	require.NoError(t, err)
+	assert.Equal(t, 0, reloaded.Len())
+}
@@ -0,0 +1,319 @@
+// Package client is a Go client for the rcond HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+)
+
+// Defaults for the client configuration
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryWait        = 30 * time.Second
+	// socketBaseURL is the URL of requests sent over a Unix socket, the host is ignored.
+	socketBaseURL = "http://rcond"
+)
+
+// Errors matched by errors.Is against an *Error returned by the client.
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooLarge        = errors.New("request body too large")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServer          = errors.New("server error")
+)
+
+// Error is an error response of the API.
+// Code is the machine-readable error code, like api.CodeNotFound,
+// Fields lists the invalid fields of a request that failed validation.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Fields     []api.FieldError
+	// Data is the body of failed requests that respond with data, like the checks of an unhealthy node.
+	Data json.RawMessage
+	// RetryAfter is the time to wait before retrying a request rejected with 429.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rcond: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is matches the error against the Err* errors by status code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrTooLarge:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	case ErrTooManyRequests:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// Config configures a client.
+// Socket selects a Unix socket instead of the URL. Token is sent in the X-API-Token header,
+// BearerToken, like a JWT of an identity provider, in the Authorization header.
+// Failed requests are retried up to MaxRetries times, see Client.
+type Config struct {
+	URL         string
+	Socket      string
+	Token       string
+	BearerToken string
+
+	// TLSConfig is used as is if set, otherwise it is built from the files.
+	TLSConfig          *tls.Config
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// HTTPClient replaces the client built from the configuration.
+	HTTPClient *http.Client
+}
+
+// Client calls the versioned rcond API and unwraps the data of its response envelopes.
+// Requests are retried on connection errors, 502, 503 and 504 if they are idempotent,
+// and on 429 after the time in the Retry-After header. The backoff doubles with every retry.
+type Client struct {
+	baseURL      string
+	token        string
+	bearerToken  string
+	http         *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// New creates a client from the configuration.
+func New(cfg Config) (*Client, error) {
+	c := &Client{
+		baseURL:      strings.TrimRight(cfg.URL, "/"),
+		token:        cfg.Token,
+		bearerToken:  cfg.BearerToken,
+		http:         cfg.HTTPClient,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+	}
+	if c.retryBackoff <= 0 {
+		c.retryBackoff = defaultRetryBackoff
+	}
+	if cfg.Socket != "" {
+		c.baseURL = socketBaseURL
+	} else if c.baseURL == "" {
+		return nil, fmt.Errorf("url or socket is required")
+	} else if _, err := url.Parse(c.baseURL); err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if c.http != nil {
+		return c, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Socket != "" {
+		socket := cfg.Socket
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	}
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	c.http = &http.Client{Transport: transport, Timeout: timeout}
+	return c, nil
+}
+
+func buildTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSConfig != nil {
+		return cfg.TLSConfig, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// do sends the body as JSON and decodes the JSON response into result.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	target := c.baseURL + api.Version + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, target, data, result)
+		if attempt >= c.maxRetries || !retryable(method, err) {
+			return err
+		}
+		wait := backoff
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		if wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+		backoff *= 2
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, data []byte, result interface{}) error {
+	var reader io.Reader
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-API-Token", c.token)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return decodeError(resp, respBody)
+	}
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+	var env api.Envelope
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	if len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, result); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// decodeError returns the error of a response, decoded from an api.Envelope
+// or the plain text body, like the error pages of a proxy.
+func decodeError(resp *http.Response, body []byte) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	var env api.Envelope
+	if json.Unmarshal(body, &env) == nil && env.Error != nil {
+		apiErr.Code = env.Error.Code
+		apiErr.Message = env.Error.Message
+		apiErr.Fields = env.Error.Fields
+		apiErr.Data = env.Data
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// retryable reports whether a failed request can be sent again.
+// Requests rejected with 429 were not processed and are always retried.
+func retryable(method string, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent(method)
+		}
+		return false
+	}
+	return idempotent(method)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeData writes v as the data of an api.Envelope.
+func writeData(w http.ResponseWriter, v interface{}) {
+	data, _ := json.Marshal(v)
+	json.NewEncoder(w).Encode(api.Envelope{Data: data})
+}
+
+func TestClientRequests(t *testing.T) {
+	var got *http.Request
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/network/sta":
+			writeData(w, api.ConnectionResponse{UUID: "7d1c6d8e"})
+		case "/v1/cluster/members":
+			writeData(w, []api.Member{{Name: "rpi-1", Status: "alive"}})
+		case "/v1/system/restart":
+			writeData(w, api.PowerAction{ID: "9a8b7c6d", Action: api.PowerReboot})
+		case "/v1/system/logs":
+			writeData(w, api.LogsResponse{Entries: []api.LogEntry{{Cursor: "s=1;i=2", Message: "started"}}, Cursor: "s=1;i=2"})
+		case "/v1/network/interface/wlan0":
+			w.WriteHeader(http.StatusAccepted)
+			writeData(w, job.Job{ID: "5f2b9c1e", Type: "network-up", Status: job.StatusRunning})
+		default:
+			writeData(w, api.StatusResponse{Status: api.StatusSuccess})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{URL: srv.URL + "/", Token: "secret"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	uuid, err := c.ConfigureSTA(ctx, api.ConfigureSTARequest{Interface: "wlan0", SSID: "HomeWiFi", Password: "secret123"})
+	require.NoError(t, err)
+	assert.Equal(t, "7d1c6d8e", uuid)
+	assert.Equal(t, "secret", got.Header.Get("X-API-Token"))
+	assert.Equal(t, "HomeWiFi", body["ssid"])
+
+	members, err := c.Members(ctx, api.MemberFilter{Status: "alive", Tags: map[string]string{"site": "lab"}})
+	require.NoError(t, err)
+	assert.Equal(t, "rpi-1", members[0].Name)
+	assert.Equal(t, "alive", got.URL.Query().Get("status"))
+	assert.Equal(t, "site=lab", got.URL.Query().Get("tag"))
+
+	require.NoError(t, c.RemoveAuthorizedKey(ctx, "pi", "SHA256:abc"))
+	assert.Equal(t, "/v1/users/pi/keys/U0hBMjU2OmFiYw", got.URL.Path)
+
+	require.NoError(t, c.DeleteState(ctx, "hostname/rpi 1"))
+	assert.Equal(t, "/v1/cluster/state/hostname/rpi%201", got.URL.EscapedPath())
+
+	logs, err := c.Logs(ctx, api.LogFilter{Units: []string{"rcond", "nginx"}, Priority: "err", Limit: 20})
+	require.NoError(t, err)
+	assert.Equal(t, "started", logs.Entries[0].Message)
+	assert.Equal(t, []string{"rcond", "nginx"}, got.URL.Query()["unit"])
+	assert.Equal(t, "err", got.URL.Query().Get("priority"))
+	assert.Equal(t, "20", got.URL.Query().Get("limit"))
+
+	reboot, err := c.Restart(ctx, api.PowerRequest{Delay: "5m"})
+	require.NoError(t, err)
+	assert.Equal(t, "9a8b7c6d", reboot.ID)
+	assert.Equal(t, "5m", body["delay"])
+
+	j, err := c.NetworkUpAsync(ctx, "wlan0", "7d1c6d8e")
+	require.NoError(t, err)
+	assert.Equal(t, "5f2b9c1e", j.ID)
+	assert.Equal(t, "true", got.URL.Query().Get("async"))
+	assert.Equal(t, "7d1c6d8e", body["uuid"])
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/cluster/members/missing":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(api.Envelope{Error: &api.Error{Code: api.CodeNotFound, Message: "member not found"}})
+		case "/v1/hostname":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(api.Envelope{Error: &api.Error{
+				Code:    api.CodeValidationFailed,
+				Message: "validation failed: hostname: is required",
+				Fields:  []api.FieldError{{Field: "hostname", Message: "is required"}},
+			}})
+		case "/v1/health":
+			data, _ := json.Marshal(api.HealthResponse{Status: api.HealthUnhealthy, Checks: []api.HealthCheck{{Name: "dbus", Status: api.HealthUnhealthy, Reason: "system bus is unreachable"}}})
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(api.Envelope{Data: data, Error: &api.Error{Code: api.CodeInternal, Message: "service unavailable"}})
+		default:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	c, err := New(Config{URL: srv.URL})
+	require.NoError(t, err)
+
+	_, err = c.Member(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "member not found", apiErr.Message)
+	assert.Equal(t, api.CodeNotFound, apiErr.Code)
+
+	err = c.SetHostname(context.Background(), "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, api.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []api.FieldError{{Field: "hostname", Message: "is required"}}, apiErr.Fields)
+
+	_, err = c.Leader(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, err.Error(), "Unauthorized")
+
+	health, err := c.Health(context.Background())
+	assert.ErrorIs(t, err, ErrServer)
+	require.NotNil(t, health)
+	assert.Equal(t, api.HealthUnhealthy, health.Status)
+	assert.Equal(t, "dbus", health.Checks[0].Name)
+
+	_, err = New(Config{})
+	assert.Error(t, err)
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch {
+		case r.URL.Path == "/v1/hostname" && n == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/v1/hostname" && n == 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case r.URL.Path == "/v1/hostname":
+			writeData(w, api.HostnameResponse{Hostname: "rpi-test"})
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	c, err := New(Config{URL: srv.URL, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	hostname, err := c.Hostname(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "rpi-test", hostname)
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	_, err = c.Restart(context.Background(), api.PowerRequest{})
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Equal(t, int32(1), calls.Load(), "POST is not retried after 503")
+}
+
+func TestClientDependencies(t *testing.T) {
+	out, err := exec.Command("go", "list", "-deps", ".").Output()
+	require.NoError(t, err)
+	deps := strings.Fields(string(out))
+	for _, pkg := range []string{"github.com/0x1d/rcond/pkg/cluster", "github.com/0x1d/rcond/pkg/system", "github.com/godbus/dbus/v5"} {
+		assert.NotContains(t, deps, pkg, "the client must not depend on the daemon")
+	}
+}
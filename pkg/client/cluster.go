@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/job"
+)
+
+// Members returns the cluster members matching the filter.
+func (c *Client) Members(ctx context.Context, filter api.MemberFilter) ([]api.Member, error) {
+	query := url.Values{}
+	setQuery(query, "status", filter.Status)
+	for key, value := range filter.Tags {
+		query.Add("tag", key+"="+value)
+	}
+	var members []api.Member
+	err := c.do(ctx, http.MethodGet, "/cluster/members", query, nil, &members)
+	return members, err
+}
+
+// Member returns a single cluster member.
+func (c *Client) Member(ctx context.Context, name string) (*api.Member, error) {
+	var member api.Member
+	if err := c.do(ctx, http.MethodGet, "/cluster/members/"+url.PathEscape(name), nil, nil, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Join joins the nodes at the addresses and returns the number of joined nodes.
+func (c *Client) Join(ctx context.Context, addrs ...string) (int, error) {
+	var resp api.ClusterJoinResponse
+	err := c.do(ctx, http.MethodPost, "/cluster/join", nil, api.ClusterJoinRequest{Join: addrs}, &resp)
+	return resp.Joined, err
+}
+
+// Leave leaves the cluster.
+func (c *Client) Leave(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/cluster/leave", nil, nil, nil)
+}
+
+// SendEvent broadcasts a cluster event. The payload is encoded as JSON, nil sends no payload.
+func (c *Client) SendEvent(ctx context.Context, name string, payload interface{}) error {
+	req := api.ClusterEventRequest{Name: name}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		req.Payload = data
+	}
+	return c.do(ctx, http.MethodPost, "/cluster/event", nil, req, nil)
+}
+
+// Events returns the cluster event types known to the node.
+func (c *Client) Events(ctx context.Context) ([]api.EventType, error) {
+	var events []api.EventType
+	err := c.do(ctx, http.MethodGet, "/cluster/events", nil, nil, &events)
+	return events, err
+}
+
+// History returns the cluster events received by the node, newest first.
+func (c *Client) History(ctx context.Context, filter api.HistoryFilter) ([]api.HistoryEntry, error) {
+	query := url.Values{}
+	setQuery(query, "type", filter.Type)
+	setQuery(query, "name", filter.Name)
+	setQuery(query, "node", filter.Node)
+	setTimeQuery(query, filter.Since, filter.Until, filter.Limit)
+	var entries []api.HistoryEntry
+	err := c.do(ctx, http.MethodGet, "/cluster/history", query, nil, &entries)
+	return entries, err
+}
+
+// Leader returns the current cluster leader.
+func (c *Client) Leader(ctx context.Context) (*api.LeaderInfo, error) {
+	var info api.LeaderInfo
+	if err := c.do(ctx, http.MethodGet, "/cluster/leader", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// RollingRestart starts a rolling restart and returns its job.
+func (c *Client) RollingRestart(ctx context.Context, req api.RollingRestartRequest) (*job.Job, error) {
+	var j job.Job
+	if err := c.do(ctx, http.MethodPost, "/cluster/rolling-restart", nil, req, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// RollingRestarts returns the rolling restarts of the node, newest first.
+func (c *Client) RollingRestarts(ctx context.Context) ([]job.Job, error) {
+	var jobs []job.Job
+	err := c.do(ctx, http.MethodGet, "/cluster/rolling-restart", nil, nil, &jobs)
+	return jobs, err
+}
+
+// RollingRestartStatus returns the progress of a rolling restart.
+func (c *Client) RollingRestartStatus(ctx context.Context, id string) (*job.Job, error) {
+	var j job.Job
+	if err := c.do(ctx, http.MethodGet, "/cluster/rolling-restart/"+url.PathEscape(id), nil, nil, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ListKeys returns the cluster encryption keys.
+func (c *Client) ListKeys(ctx context.Context) (*api.KeyResponse, error) {
+	return c.keys(ctx, http.MethodGet, nil)
+}
+
+// InstallKey installs a cluster encryption key, optionally as primary key.
+func (c *Client) InstallKey(ctx context.Context, key string, primary bool) (*api.KeyResponse, error) {
+	return c.keys(ctx, http.MethodPost, &api.ClusterKeyRequest{Key: key, Primary: primary})
+}
+
+// RemoveKey removes a cluster encryption key.
+func (c *Client) RemoveKey(ctx context.Context, key string) (*api.KeyResponse, error) {
+	return c.keys(ctx, http.MethodDelete, &api.ClusterKeyRequest{Key: key})
+}
+
+func (c *Client) keys(ctx context.Context, method string, req *api.ClusterKeyRequest) (*api.KeyResponse, error) {
+	var resp api.KeyResponse
+	var body interface{}
+	if req != nil {
+		body = req
+	}
+	if err := c.do(ctx, method, "/cluster/keys", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListState returns the desired state documents, optionally of a kind.
+func (c *Client) ListState(ctx context.Context, kind string) ([]*api.Document, error) {
+	query := url.Values{}
+	setQuery(query, "kind", kind)
+	var docs []*api.Document
+	err := c.do(ctx, http.MethodGet, "/cluster/state", query, nil, &docs)
+	return docs, err
+}
+
+// GetState returns a desired state document.
+func (c *Client) GetState(ctx context.Context, key string) (*api.Document, error) {
+	var doc api.Document
+	if err := c.do(ctx, http.MethodGet, "/cluster/state/"+escapeKey(key), nil, nil, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// PutState stores a desired state document.
+func (c *Client) PutState(ctx context.Context, key string, req api.ClusterStateRequest) (*api.Document, error) {
+	var doc api.Document
+	if err := c.do(ctx, http.MethodPut, "/cluster/state/"+escapeKey(key), nil, req, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DeleteState deletes a desired state document.
+func (c *Client) DeleteState(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodDelete, "/cluster/state/"+escapeKey(key), nil, nil, nil)
+}
+
+// escapeKey escapes the segments of a state key, which may contain slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
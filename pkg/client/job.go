@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/job"
+)
+
+// asyncQuery asks the API to run an operation as a job.
+var asyncQuery = url.Values{"async": {"true"}}
+
+// Jobs returns the jobs of the node, newest first, optionally filtered by type and status.
+func (c *Client) Jobs(ctx context.Context, kind, status string) ([]job.Job, error) {
+	query := url.Values{}
+	setQuery(query, "type", kind)
+	setQuery(query, "status", status)
+	var jobs []job.Job
+	err := c.do(ctx, http.MethodGet, "/jobs", query, nil, &jobs)
+	return jobs, err
+}
+
+// Job returns the status, progress and result of a job.
+func (c *Client) Job(ctx context.Context, id string) (*job.Job, error) {
+	var j job.Job
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// CancelJob cancels a running job.
+func (c *Client) CancelJob(ctx context.Context, id string) (*job.Job, error) {
+	var j job.Job
+	if err := c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, nil, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// NetworkUpAsync activates the connection with the UUID on the interface in a job,
+// so the result can be fetched after the change interrupted the connection to the node.
+func (c *Client) NetworkUpAsync(ctx context.Context, iface, uuid string) (*job.Job, error) {
+	var j job.Job
+	err := c.do(ctx, http.MethodPut, "/network/interface/"+url.PathEscape(iface), asyncQuery, api.NetworkUpRequest{UUID: uuid}, &j)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/0x1d/rcond/pkg/api"
+)
+
+// ListConnections returns the NetworkManager connection profiles.
+func (c *Client) ListConnections(ctx context.Context) ([]api.Connection, error) {
+	var connections []api.Connection
+	err := c.do(ctx, http.MethodGet, "/network/connections", nil, nil, &connections)
+	return connections, err
+}
+
+// ConfigureSTA creates a WiFi station connection and returns its UUID.
+func (c *Client) ConfigureSTA(ctx context.Context, req api.ConfigureSTARequest) (string, error) {
+	var resp api.ConnectionResponse
+	err := c.do(ctx, http.MethodPost, "/network/sta", nil, req, &resp)
+	return resp.UUID, err
+}
+
+// ConfigureAP creates a WiFi access point connection and returns its UUID.
+func (c *Client) ConfigureAP(ctx context.Context, req api.ConfigureAPRequest) (string, error) {
+	var resp api.ConnectionResponse
+	err := c.do(ctx, http.MethodPost, "/network/ap", nil, req, &resp)
+	return resp.UUID, err
+}
+
+// NetworkUp activates the connection with the UUID on the interface.
+func (c *Client) NetworkUp(ctx context.Context, iface, uuid string) error {
+	return c.do(ctx, http.MethodPut, "/network/interface/"+url.PathEscape(iface), nil, api.NetworkUpRequest{UUID: uuid}, nil)
+}
+
+// NetworkDown deactivates the connection of the interface.
+func (c *Client) NetworkDown(ctx context.Context, iface string) error {
+	return c.do(ctx, http.MethodDelete, "/network/interface/"+url.PathEscape(iface), nil, nil, nil)
+}
+
+// RemoveConnection deletes the connection profile with the UUID.
+func (c *Client) RemoveConnection(ctx context.Context, uuid string) error {
+	return c.do(ctx, http.MethodDelete, "/network/connection/"+url.PathEscape(uuid), nil, nil, nil)
+}
+
+// Hostname returns the hostname of the node.
+func (c *Client) Hostname(ctx context.Context) (string, error) {
+	var resp api.HostnameResponse
+	err := c.do(ctx, http.MethodGet, "/hostname", nil, nil, &resp)
+	return resp.Hostname, err
+}
+
+// SetHostname sets the static hostname of the node.
+func (c *Client) SetHostname(ctx context.Context, hostname string) error {
+	return c.do(ctx, http.MethodPost, "/hostname", nil, api.HostnameRequest{Hostname: hostname}, nil)
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/audit"
+)
+
+// Health returns the health status of the node, with its checks if the client was granted system:read.
+// An unhealthy node responds with 503, the error is returned together with the status.
+func (c *Client) Health(ctx context.Context) (*api.HealthResponse, error) {
+	var resp api.HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/health", nil, nil, &resp); err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && len(apiErr.Data) > 0 && json.Unmarshal(apiErr.Data, &resp) == nil {
+			return &resp, err
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SystemInfo returns the information about the host and the rcond build of the node.
+func (c *Client) SystemInfo(ctx context.Context) (*api.SystemInfo, error) {
+	var resp api.SystemInfo
+	if err := c.do(ctx, http.MethodGet, "/system/info", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TLSCertificate returns the certificate served by the node.
+func (c *Client) TLSCertificate(ctx context.Context) (*api.CertificateInfo, error) {
+	var resp api.CertificateInfo
+	if err := c.do(ctx, http.MethodGet, "/system/tls", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Units returns the systemd units of the allowlist of the node.
+func (c *Client) Units(ctx context.Context) ([]api.Unit, error) {
+	var units []api.Unit
+	err := c.do(ctx, http.MethodGet, "/system/units", nil, nil, &units)
+	return units, err
+}
+
+// Unit returns the state of a systemd unit.
+func (c *Client) Unit(ctx context.Context, name string) (*api.Unit, error) {
+	var unit api.Unit
+	if err := c.do(ctx, http.MethodGet, "/system/units/"+url.PathEscape(name), nil, nil, &unit); err != nil {
+		return nil, err
+	}
+	return &unit, nil
+}
+
+// UnitAction runs an action like api.UnitRestart on a systemd unit and returns its state.
+func (c *Client) UnitAction(ctx context.Context, name, action string) (*api.Unit, error) {
+	var unit api.Unit
+	if err := c.do(ctx, http.MethodPost, "/system/units/"+url.PathEscape(name)+"/"+url.PathEscape(action), nil, nil, &unit); err != nil {
+		return nil, err
+	}
+	return &unit, nil
+}
+
+// UploadFile stores the content in a file on the node.
+func (c *Client) UploadFile(ctx context.Context, path string, content []byte) error {
+	req := api.FileUploadRequest{Path: path, Content: base64.StdEncoding.EncodeToString(content)}
+	return c.do(ctx, http.MethodPost, "/system/file", nil, req, nil)
+}
+
+// Restart schedules a reboot of the node after the delay or at the time of the request,
+// or shortly after the response if neither is set, and returns the pending action.
+func (c *Client) Restart(ctx context.Context, req api.PowerRequest) (*api.PowerAction, error) {
+	return c.powerAction(ctx, "/system/restart", req)
+}
+
+// Shutdown schedules a poweroff of the node like Restart.
+func (c *Client) Shutdown(ctx context.Context, req api.PowerRequest) (*api.PowerAction, error) {
+	return c.powerAction(ctx, "/system/shutdown", req)
+}
+
+func (c *Client) powerAction(ctx context.Context, path string, req api.PowerRequest) (*api.PowerAction, error) {
+	var action api.PowerAction
+	if err := c.do(ctx, http.MethodPost, path, nil, req, &action); err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+// Power returns the pending power actions of the node and the inhibitors held with logind.
+func (c *Client) Power(ctx context.Context) (*api.PowerResponse, error) {
+	var resp api.PowerResponse
+	if err := c.do(ctx, http.MethodGet, "/system/power", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelPower cancels the pending power action with the id, or all pending actions if id is empty,
+// and returns the canceled actions.
+func (c *Client) CancelPower(ctx context.Context, id string) ([]api.PowerAction, error) {
+	if id == "" {
+		var actions []api.PowerAction
+		err := c.do(ctx, http.MethodDelete, "/system/power", nil, nil, &actions)
+		return actions, err
+	}
+	var action api.PowerAction
+	if err := c.do(ctx, http.MethodDelete, "/system/power/"+url.PathEscape(id), nil, nil, &action); err != nil {
+		return nil, err
+	}
+	return []api.PowerAction{action}, nil
+}
+
+// AddAuthorizedKey adds an SSH key for the user and returns its fingerprint.
+func (c *Client) AddAuthorizedKey(ctx context.Context, user, pubKey string) (string, error) {
+	var resp api.AuthorizedKeyResponse
+	err := c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(user)+"/keys", nil, api.AuthorizedKeyRequest{PubKey: pubKey}, &resp)
+	return resp.Fingerprint, err
+}
+
+// RemoveAuthorizedKey removes the SSH key with the fingerprint, like SHA256:..., of the user.
+func (c *Client) RemoveAuthorizedKey(ctx context.Context, user, fingerprint string) error {
+	path := "/users/" + url.PathEscape(user) + "/keys/" + base64.RawURLEncoding.EncodeToString([]byte(fingerprint))
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// Audit returns the audit records matching the filter, newest first.
+func (c *Client) Audit(ctx context.Context, filter audit.Filter) ([]audit.Record, error) {
+	query := url.Values{}
+	setQuery(query, "identity", filter.Identity)
+	setQuery(query, "method", filter.Method)
+	setQuery(query, "route", filter.Route)
+	if filter.Status != 0 {
+		query.Set("status", strconv.Itoa(filter.Status))
+	}
+	setTimeQuery(query, filter.Since, filter.Until, filter.Limit)
+	var records []audit.Record
+	err := c.do(ctx, http.MethodGet, "/audit", query, nil, &records)
+	return records, err
+}
+
+// Logs returns the journal entries of the node matching the filter.
+// With a cursor, the entries after it are returned, pass the cursor of the response to read the next entries.
+func (c *Client) Logs(ctx context.Context, filter api.LogFilter) (*api.LogsResponse, error) {
+	query := url.Values{"unit": filter.Units}
+	setQuery(query, "priority", filter.Priority)
+	setQuery(query, "cursor", filter.Cursor)
+	setTimeQuery(query, filter.Since, filter.Until, filter.Limit)
+	var resp api.LogsResponse
+	if err := c.do(ctx, http.MethodGet, "/system/logs", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+// setTimeQuery sets the since, until and limit parameters shared by the query endpoints.
+func setTimeQuery(query url.Values, since, until time.Time, limit int) {
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		query.Set("until", until.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+}
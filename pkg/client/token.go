@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/0x1d/rcond/pkg/api"
+)
+
+// ListTokens returns the named API tokens without their secrets.
+func (c *Client) ListTokens(ctx context.Context) ([]*api.Token, error) {
+	var tokens []*api.Token
+	err := c.do(ctx, http.MethodGet, "/tokens", nil, nil, &tokens)
+	return tokens, err
+}
+
+// CreateToken creates a named token. The secret is only returned by this call.
+func (c *Client) CreateToken(ctx context.Context, name string, scopes []string) (*api.CreateTokenResponse, error) {
+	var resp api.CreateTokenResponse
+	if err := c.do(ctx, http.MethodPost, "/tokens", nil, api.CreateTokenRequest{Name: name, Scopes: scopes}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RevokeToken revokes a token created through the API.
+func (c *Client) RevokeToken(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/tokens/"+url.PathEscape(name), nil, nil, nil)
+}
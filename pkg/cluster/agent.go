@@ -1,28 +1,73 @@
 package cluster
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/system"
 	"github.com/hashicorp/logutils"
 	"github.com/hashicorp/serf/serf"
 )
 
+const (
+	// eventHandlerTimeout limits how long a single event handler may run.
+	eventHandlerTimeout = time.Minute
+	// eventQueueSize is the number of user events waiting for their handler,
+	// further events are rejected until the handlers caught up.
+	eventQueueSize = 64
+)
+
 // Agent represents a Serf cluster agent.
 type Agent struct {
-	Serf *serf.Serf
+	Serf    *serf.Serf
+	Events  *EventRegistry
+	History *History
+	State   *Store
+	Leader  *Election
+
+	power          *system.Power
+	healthClient   *http.Client
+	rollouts       chan rolloutTask
+	rolloutRunning atomic.Bool
+	statusChanges  *statusChanges
+	queries        *queryHandlers
+	userEvents     chan serf.UserEvent
+	discoverers    []Discoverer
+	ctx            context.Context
+	cancel         context.CancelFunc
 }
 
 // ClusterEvent represents a custom event that will be sent to the Serf cluster.
 type ClusterEvent struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// eventMessage is the wire format of a user event payload.
+type eventMessage struct {
+	Sender  string          `json:"sender"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// legacyEventMessage is the wire format of nodes that send events without the sender.
+type legacyEventMessage struct {
 	Name string
 	Data []byte
 }
 
-// NewAgent creates a new Serf cluster agent with the given configuration and event handlers.
-func NewAgent(clusterConfig *config.ClusterConfig, clusterEvents map[string]func([]byte)) (*Agent, error) {
+// NewAgent creates a new Serf cluster agent with the given configuration and event registry.
+// Restarts of rolling restarts are scheduled with power.
+func NewAgent(clusterConfig *config.ClusterConfig, tlsConfig *config.TLSConfig, events *EventRegistry, power *system.Power) (*Agent, error) {
 	config := serf.DefaultConfig()
 	config.Init()
 	logFilter := &logutils.LevelFilter{
@@ -33,48 +78,168 @@ func NewAgent(clusterConfig *config.ClusterConfig, clusterEvents map[string]func
 	config.LogOutput = logFilter
 	config.MemberlistConfig.LogOutput = logFilter
 	config.NodeName = clusterConfig.NodeName
+	config.Tags = clusterConfig.Tags
 	config.ProtocolVersion = serf.ProtocolVersionMax
-	config.MemberlistConfig.SecretKey = []byte(clusterConfig.SecretKey)
 	config.MemberlistConfig.AdvertiseAddr = clusterConfig.AdvertiseAddr
 	config.MemberlistConfig.AdvertisePort = clusterConfig.AdvertisePort
 	config.MemberlistConfig.BindAddr = clusterConfig.BindAddr
 	config.MemberlistConfig.BindPort = clusterConfig.BindPort
+	config.DisableCoordinates = clusterConfig.DisableCoordinates
+	config.RejoinAfterLeave = clusterConfig.RejoinAfterLeave
+	if clusterConfig.DataDir != "" {
+		if err := os.MkdirAll(clusterConfig.DataDir, 0755); err != nil {
+			return nil, err
+		}
+		// persist known members so the node can rejoin them after a restart
+		config.SnapshotPath = filepath.Join(clusterConfig.DataDir, "serf.snapshot")
+	}
+	if err := setupKeyring(config, clusterConfig); err != nil {
+		return nil, err
+	}
+
+	historyPath := ""
+	if clusterConfig.DataDir != "" {
+		historyPath = filepath.Join(clusterConfig.DataDir, "cluster-history.jsonl")
+	}
+	history, err := NewHistory(historyPath, clusterConfig.HistorySize)
+	if err != nil {
+		return nil, err
+	}
+
+	healthClient, err := newHealthClient(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	agent := &Agent{
+		Events:        events,
+		History:       history,
+		power:         power,
+		healthClient:  healthClient,
+		rollouts:      make(chan rolloutTask),
+		statusChanges: newStatusChanges(),
+		queries:       newQueryHandlers(),
+		userEvents:    make(chan serf.UserEvent, eventQueueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	agent.Leader = newElection(agent)
+	agent.Leader.RegisterWorker(rolloutWorker, agent.runRollouts)
+	agent.RegisterQuery(restartQuery, agent.handleRestart)
+
+	statePath := ""
+	if clusterConfig.DataDir != "" {
+		statePath = filepath.Join(clusterConfig.DataDir, "state.json")
+	}
+	agent.State, err = NewStore(agent, statePath)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
 
 	// Setup event channel
 	eventCh := make(chan serf.Event, 10)
 	config.EventCh = eventCh
-	go handleEvents(eventCh, clusterEvents)
+	go agent.handleEvents(eventCh)
+	go agent.runEventHandlers()
 
 	// Start Serf
 	serf, err := serf.Create(config)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+	agent.Serf = serf
 
-	return &Agent{Serf: serf}, nil
+	return agent, nil
 }
 
-func Up(clusterConfig *config.ClusterConfig) (*Agent, error) {
+// setupKeyring configures message encryption.
+// If a keyring file exists in the data directory, its keys take precedence over the secret key.
+// Otherwise the secret key is used and written to a new keyring file, so rotated keys survive restarts.
+func setupKeyring(serfConfig *serf.Config, clusterConfig *config.ClusterConfig) error {
+	secretKey, raw, err := clusterConfig.SecretKeyBytes()
+	if err != nil {
+		return err
+	}
+	// the key is not logged, rcond never writes secrets to the log
+	switch n := len(clusterConfig.SecretKey); {
+	case !raw && (n == 16 || n == 24 || n == 32):
+		log.Printf("[WARN] cluster secret_key is decoded as base64. If it is a key of an earlier version used as raw characters, configure the output of: printf %%s '<secret_key>' | base64")
+	case raw:
+		log.Printf("[WARN] cluster secret_key is not base64 encoded, its characters are used as key bytes. Configure the output of: printf %%s '<secret_key>' | base64")
+	}
+	if clusterConfig.DataDir == "" {
+		serfConfig.MemberlistConfig.SecretKey = secretKey
+		return nil
+	}
+	serfConfig.KeyringFile = filepath.Join(clusterConfig.DataDir, keyringFile)
+	if _, err := os.Stat(serfConfig.KeyringFile); err == nil {
+		keyring, err := loadKeyring(serfConfig.KeyringFile)
+		if err != nil {
+			return err
+		}
+		if secretKey != nil && !bytes.Equal(keyring.GetPrimaryKey(), secretKey) {
+			log.Printf("[WARN] Keyring %s overrides the configured secret_key, rotate keys with /cluster/keys or remove the keyring file to use secret_key", serfConfig.KeyringFile)
+		}
+		serfConfig.MemberlistConfig.Keyring = keyring
+		return nil
+	}
+	if secretKey == nil {
+		return nil
+	}
+	serfConfig.MemberlistConfig.SecretKey = secretKey
+	return writeKeyring(serfConfig.KeyringFile, secretKey)
+}
+
+// Up starts the cluster agent if the cluster is enabled.
+// Power actions requested through the cluster are scheduled with power, shared with the API.
+func Up(clusterConfig *config.ClusterConfig, tlsConfig *config.TLSConfig, power *system.Power) (*Agent, error) {
 	if clusterConfig.Enabled {
 		log.Printf("[INFO] Starting cluster agent on %s:%d", clusterConfig.BindAddr, clusterConfig.BindPort)
-		clusterAgent, err := NewAgent(clusterConfig, ClusterEventsMap())
+		clusterAgent, err := NewAgent(clusterConfig, tlsConfig, DefaultEventRegistry(power), power)
 		if err != nil {
 			log.Print(err)
 			return nil, err
 		}
 		// join nodes in the cluster if the join addresses are provided
-		if len(clusterConfig.Join) > 0 {
-			clusterAgent.Join(clusterConfig.Join, true)
+		go clusterAgent.RetryJoin(clusterConfig.Join, clusterConfig.RetryJoinInterval, clusterConfig.RetryJoinMaxInterval, clusterConfig.RetryJoinMax)
+		// converge to the desired state replicated in the cluster
+		clusterAgent.State.Start(clusterConfig.StateSyncInterval)
+		// elect a leader for singleton tasks
+		clusterAgent.Leader.Start()
+		// join nodes found by the discovery providers
+		discoverers, err := NewDiscoverers(&clusterConfig.Discover, clusterConfig.BindPort)
+		if err != nil {
+			log.Printf("[ERROR] Failed to setup discovery: %v", err)
 		}
+		clusterAgent.StartDiscovery(discoverers, clusterConfig.Discover.Interval)
 		return clusterAgent, nil
 	}
 	return nil, nil
 }
 
 // Event sends a custom event to the Serf cluster.
-// It marshals the provided ClusterEvent into JSON and then uses Serf's UserEvent method to send the event.
+// The event must be registered and not internal, and its payload must match the registered schema.
+// The payload is wrapped together with the name of this node and sent using Serf's UserEvent method.
 func (a *Agent) Event(event ClusterEvent) error {
-	eventData, err := json.Marshal(event)
+	if registered, ok := a.Events.Get(event.Name); ok && registered.Internal {
+		return fmt.Errorf("%w: %s is internal", ErrUnknownEvent, event.Name)
+	}
+	return a.sendEvent(event)
+}
+
+// sendEvent sends an event like Event, including internal events.
+func (a *Agent) sendEvent(event ClusterEvent) error {
+	if err := a.Events.Validate(event.Name, event.Payload); err != nil {
+		return err
+	}
+	eventData, err := json.Marshal(eventMessage{
+		Sender:  a.Serf.LocalMember().Name,
+		Payload: event.Payload,
+	})
 	if err != nil {
 		return err
 	}
@@ -84,12 +249,6 @@ func (a *Agent) Event(event ClusterEvent) error {
 	return nil
 }
 
-// Members returns a list of members in the Serf cluster.
-func (a *Agent) Members() ([]serf.Member, error) {
-	log.Printf("[INFO] Getting members of the cluster")
-	return a.Serf.Members(), nil
-}
-
 // Join attempts to join the Serf cluster with the given addresses, optionally ignoring old nodes.
 func (a *Agent) Join(addrs []string, ignoreOld bool) (int, error) {
 	log.Printf("[INFO] Joining nodes in the cluster: %v", addrs)
@@ -110,23 +269,142 @@ func (a *Agent) Leave() error {
 // Shutdown shuts down the Serf cluster agent.
 func (a *Agent) Shutdown() error {
 	log.Printf("[INFO] Shutting down cluster agent")
+	a.cancel()
+	a.stopDiscovery()
 	return a.Serf.Shutdown()
 }
 
-// handleEvents handles Serf events received on the event channel.
-func handleEvents(eventCh chan serf.Event, clusterEvents map[string]func([]byte)) {
-	eventHandlers := clusterEvents
+// handleEvents handles Serf events received on the event channel
+// and records them in the history.
+func (a *Agent) handleEvents(eventCh chan serf.Event) {
 	for event := range eventCh {
-		switch event.EventType() {
-		case serf.EventUser:
-			userEvent := event.(serf.UserEvent)
-			if handler, ok := eventHandlers[userEvent.Name]; ok {
-				handler(userEvent.Payload)
-			} else {
-				log.Printf("[INFO] No event handler found for event: %s", userEvent.Name)
+		switch e := event.(type) {
+		case serf.UserEvent:
+			// handlers run on their own goroutine, so a slow handler does not hold up member updates and queries
+			select {
+			case a.userEvents <- e:
+			default:
+				log.Printf("[ERROR] (ClusterEvent:%s) rejected: event queue is full", e.Name)
+				eventsReceived.Inc(e.Name, OutcomeRejected)
+				a.History.Record(HistoryEntry{
+					Type:    HistoryUser,
+					Name:    e.Name,
+					LTime:   uint64(e.LTime),
+					Outcome: OutcomeRejected,
+					Error:   "event queue is full",
+				})
+			}
+		case *serf.Query:
+			entry := a.handleQuery(e)
+			if !strings.HasPrefix(e.Name, internalQueryPrefix) {
+				a.History.Record(entry)
+			}
+		case serf.MemberEvent:
+			log.Printf("[INFO] Received event: %s", e.EventType())
+			a.statusChanges.update(e.Members, time.Now().UTC())
+			members := make([]string, 0, len(e.Members))
+			for _, member := range e.Members {
+				members = append(members, member.Name)
 			}
+			a.History.Record(HistoryEntry{
+				Type:    memberHistoryType(e.Type),
+				Members: members,
+			})
 		default:
 			log.Printf("[INFO] Received event: %s\n", event.EventType())
 		}
 	}
 }
+
+// runEventHandlers runs the handlers of the queued user events one at a time until the agent shuts down.
+func (a *Agent) runEventHandlers() {
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case e := <-a.userEvents:
+			a.handleUserEvent(e)
+		}
+	}
+}
+
+// handleUserEvent decodes a user event and dispatches it to the registered handler.
+// The event is recorded in the history before its handler runs, so events like restart that do not
+// return are recorded too, and the entry is updated with the outcome of the handler.
+func (a *Agent) handleUserEvent(userEvent serf.UserEvent) {
+	entry := HistoryEntry{
+		Type:  HistoryUser,
+		Name:  userEvent.Name,
+		LTime: uint64(userEvent.LTime),
+	}
+	msg := decodeEventMessage(userEvent.Payload)
+	entry.Sender = msg.Sender
+
+	if err := a.Events.Validate(userEvent.Name, msg.Payload); err != nil {
+		log.Printf("[ERROR] (ClusterEvent:%s) rejected: %s", userEvent.Name, err)
+		entry.Outcome = OutcomeRejected
+		entry.Error = err.Error()
+		eventsReceived.Inc(userEvent.Name, entry.Outcome)
+		a.History.Record(entry)
+		return
+	}
+	entry.Outcome = OutcomeReceived
+	entry = a.History.Record(entry)
+
+	ctx, cancel := context.WithTimeout(a.ctx, eventHandlerTimeout)
+	defer cancel()
+	if err := a.Events.Dispatch(ctx, userEvent.Name, msg.Sender, msg.Payload); err != nil {
+		log.Printf("[ERROR] (ClusterEvent:%s) failed: %s", userEvent.Name, err)
+		entry.Outcome = OutcomeFailed
+		entry.Error = err.Error()
+	} else {
+		entry.Outcome = OutcomeOK
+	}
+	eventsReceived.Inc(userEvent.Name, entry.Outcome)
+	a.History.Update(entry)
+}
+
+// decodeEventMessage decodes the payload of a user event. Events of nodes that do not send the sender yet,
+// and events sent with other Serf clients, are accepted with an unknown sender: their data is used as the payload
+// if it is JSON, otherwise as a JSON string.
+func decodeEventMessage(data []byte) eventMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil {
+		if _, ok := fields["sender"]; ok {
+			var msg eventMessage
+			if json.Unmarshal(data, &msg) == nil {
+				return msg
+			}
+		}
+		if _, ok := fields["Name"]; ok {
+			var legacy legacyEventMessage
+			if json.Unmarshal(data, &legacy) == nil {
+				data = legacy.Data
+			}
+		}
+	}
+	switch {
+	case len(data) == 0:
+		return eventMessage{}
+	case json.Valid(data):
+		return eventMessage{Payload: data}
+	default:
+		payload, _ := json.Marshal(string(data))
+		return eventMessage{Payload: payload}
+	}
+}
+
+func memberHistoryType(t serf.EventType) string {
+	switch t {
+	case serf.EventMemberJoin:
+		return HistoryMemberJoin
+	case serf.EventMemberLeave:
+		return HistoryMemberLeave
+	case serf.EventMemberFailed:
+		return HistoryMemberFailed
+	case serf.EventMemberReap:
+		return HistoryMemberReap
+	default:
+		return HistoryMemberUpdate
+	}
+}
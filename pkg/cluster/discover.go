@@ -0,0 +1,289 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/hashicorp/mdns"
+	"github.com/hashicorp/serf/serf"
+)
+
+// Defaults for peer discovery
+const (
+	defaultDiscoverInterval = time.Minute
+	defaultMDNSService      = "_rcond._udp"
+	defaultMDNSDomain       = "local"
+	mdnsQueryTimeout        = 2 * time.Second
+)
+
+// Discoverer finds the gossip addresses of other nodes.
+type Discoverer interface {
+	Name() string
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// advertiser is implemented by discoverers that announce the local node.
+type advertiser interface {
+	Advertise(name string, addr net.IP, port int) error
+}
+
+// MDNSDiscoverer finds nodes by browsing an mDNS service on the local network
+// and advertises the local node under the same service.
+type MDNSDiscoverer struct {
+	Service   string
+	Domain    string
+	Interface *net.Interface
+
+	server *mdns.Server
+}
+
+// NewMDNSDiscoverer creates an mDNS discoverer from the given configuration.
+func NewMDNSDiscoverer(cfg *config.MDNSConfig) (*MDNSDiscoverer, error) {
+	d := &MDNSDiscoverer{
+		Service: cfg.Service,
+		Domain:  cfg.Domain,
+	}
+	if d.Service == "" {
+		d.Service = defaultMDNSService
+	}
+	if d.Domain == "" {
+		d.Domain = defaultMDNSDomain
+	}
+	if cfg.Interface != "" {
+		iface, err := net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mdns interface %s: %v", cfg.Interface, err)
+		}
+		d.Interface = iface
+	}
+	return d, nil
+}
+
+// Name returns the name of the discoverer.
+func (d *MDNSDiscoverer) Name() string {
+	return "mdns"
+}
+
+// Advertise announces the local node on the mDNS service.
+// If addr is unspecified, the addresses of the hostname are announced.
+func (d *MDNSDiscoverer) Advertise(name string, addr net.IP, port int) error {
+	var ips []net.IP
+	if addr != nil && !addr.IsUnspecified() {
+		ips = []net.IP{addr}
+	}
+	service, err := mdns.NewMDNSService(name, d.Service, d.Domain+".", "", port, ips, []string{"rcond"})
+	if err != nil {
+		return fmt.Errorf("failed to create mdns service: %v", err)
+	}
+	server, err := mdns.NewServer(&mdns.Config{Zone: service, Iface: d.Interface})
+	if err != nil {
+		return fmt.Errorf("failed to start mdns server: %v", err)
+	}
+	d.server = server
+	return nil
+}
+
+// Discover browses the mDNS service and returns the addresses of the announced nodes.
+// The query ends at the deadline of ctx if it is earlier than the query timeout,
+// and Discover returns as soon as ctx is done.
+func (d *MDNSDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	timeout := mdnsQueryTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	// the query drops entries instead of blocking, so it ends on its own once abandoned
+	entries := make(chan *mdns.ServiceEntry, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- mdns.Query(&mdns.QueryParam{
+			Service:     d.Service,
+			Domain:      d.Domain,
+			Timeout:     timeout,
+			Interface:   d.Interface,
+			Entries:     entries,
+			DisableIPv6: true,
+		})
+		close(entries)
+	}()
+
+	var addrs []string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case entry, ok := <-entries:
+			if !ok {
+				if err := <-done; err != nil {
+					return nil, err
+				}
+				return addrs, nil
+			}
+			if entry.AddrV4 == nil {
+				continue
+			}
+			addrs = append(addrs, net.JoinHostPort(entry.AddrV4.String(), strconv.Itoa(entry.Port)))
+		}
+	}
+}
+
+// Close stops advertising the local node.
+func (d *MDNSDiscoverer) Close() error {
+	if d.server == nil {
+		return nil
+	}
+	return d.server.Shutdown()
+}
+
+// DNSDiscoverer finds nodes by resolving DNS names.
+// Each name is first resolved as SRV record, falling back to A/AAAA records combined with Port.
+type DNSDiscoverer struct {
+	Names    []string
+	Port     int
+	Resolver *net.Resolver
+}
+
+// NewDNSDiscoverer creates a DNS discoverer from the given configuration.
+// defaultPort is used for A/AAAA records if no port is configured.
+func NewDNSDiscoverer(cfg *config.DNSConfig, defaultPort int) *DNSDiscoverer {
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return &DNSDiscoverer{
+		Names:    cfg.Names,
+		Port:     port,
+		Resolver: net.DefaultResolver,
+	}
+}
+
+// Name returns the name of the discoverer.
+func (d *DNSDiscoverer) Name() string {
+	return "dns"
+}
+
+// Discover resolves the configured names and returns the found addresses.
+func (d *DNSDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	var addrs []string
+	var lastErr error
+	for _, name := range d.Names {
+		if _, srvs, err := d.Resolver.LookupSRV(ctx, "", "", name); err == nil && len(srvs) > 0 {
+			for _, srv := range srvs {
+				addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+			}
+			continue
+		}
+		hosts, err := d.Resolver.LookupHost(ctx, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, host := range hosts {
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(d.Port)))
+		}
+	}
+	if len(addrs) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return addrs, nil
+}
+
+// NewDiscoverers creates the discoverers enabled in the configuration.
+func NewDiscoverers(cfg *config.DiscoverConfig, defaultPort int) ([]Discoverer, error) {
+	var discoverers []Discoverer
+	if cfg.MDNS.Enabled {
+		d, err := NewMDNSDiscoverer(&cfg.MDNS)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, d)
+	}
+	if cfg.DNS.Enabled {
+		discoverers = append(discoverers, NewDNSDiscoverer(&cfg.DNS, defaultPort))
+	}
+	return discoverers, nil
+}
+
+// StartDiscovery advertises the local node and joins the nodes found by the discoverers,
+// once right away and then periodically until the agent is shut down.
+func (a *Agent) StartDiscovery(discoverers []Discoverer, interval time.Duration) {
+	if len(discoverers) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultDiscoverInterval
+	}
+	local := a.Serf.LocalMember()
+	for _, d := range discoverers {
+		if adv, ok := d.(advertiser); ok {
+			if err := adv.Advertise(local.Name, local.Addr, int(local.Port)); err != nil {
+				log.Printf("[ERROR] (Discover:%s) failed to advertise node: %v", d.Name(), err)
+			}
+		}
+	}
+	a.discoverers = discoverers
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			a.discover(discoverers)
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// discover joins all discovered addresses that are not already alive members.
+func (a *Agent) discover(discoverers []Discoverer) {
+	known := map[string]bool{}
+	for _, member := range a.Serf.Members() {
+		if member.Status == serf.StatusAlive {
+			known[net.JoinHostPort(member.Addr.String(), strconv.Itoa(int(member.Port)))] = true
+		}
+	}
+
+	var addrs []string
+	for _, d := range discoverers {
+		ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+		found, err := d.Discover(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("[WARN] (Discover:%s) failed: %v", d.Name(), err)
+			continue
+		}
+		for _, addr := range found {
+			if !known[addr] {
+				known[addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) > 0 {
+		a.Join(addrs, true)
+	}
+}
+
+// stopDiscovery stops advertising the local node.
+func (a *Agent) stopDiscovery() {
+	for _, d := range a.discoverers {
+		if c, ok := d.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiscoverers(t *testing.T) {
+	discoverers, err := NewDiscoverers(&config.DiscoverConfig{}, 7946)
+	assert.NoError(t, err)
+	assert.Empty(t, discoverers)
+
+	discoverers, err = NewDiscoverers(&config.DiscoverConfig{
+		MDNS: config.MDNSConfig{Enabled: true},
+		DNS:  config.DNSConfig{Enabled: true, Names: []string{"rcond.example.com"}},
+	}, 7946)
+	assert.NoError(t, err)
+	assert.Len(t, discoverers, 2)
+
+	mdnsDiscoverer := discoverers[0].(*MDNSDiscoverer)
+	assert.Equal(t, "_rcond._udp", mdnsDiscoverer.Service)
+	assert.Equal(t, "local", mdnsDiscoverer.Domain)
+
+	dnsDiscoverer := discoverers[1].(*DNSDiscoverer)
+	assert.Equal(t, 7946, dnsDiscoverer.Port)
+}
+
+func TestMDNSDiscoverCanceled(t *testing.T) {
+	d := &MDNSDiscoverer{Service: defaultMDNSService, Domain: defaultMDNSDomain}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := d.Discover(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	d.Discover(ctx)
+	assert.Less(t, time.Since(start), mdnsQueryTimeout)
+}
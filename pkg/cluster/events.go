@@ -1,34 +1,168 @@
 package cluster
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/0x1d/rcond/pkg/metrics"
 	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/schema"
 	"github.com/0x1d/rcond/pkg/system"
 )
 
-func ClusterEventsMap() map[string]func([]byte) {
-	return map[string]func([]byte){
-		"printHostname": printHostname,
-		"restart":       restart,
-		"shutdown":      shutdown,
+// ErrUnknownEvent is returned when an event is not registered.
+var ErrUnknownEvent = errors.New("unknown event")
+
+// eventsReceived counts the received cluster events by name and outcome.
+var eventsReceived = metrics.Default.NewCounterVec("rcond_cluster_events_total", "Received cluster events by name and outcome.", "name", "outcome")
+
+// EventHandlerFunc handles a cluster event.
+// It receives the name of the node that sent the event and the raw JSON payload.
+type EventHandlerFunc func(ctx context.Context, sender string, payload json.RawMessage) error
+
+// EventType describes a named cluster event and its payload.
+// If Schema is nil, the event does not accept a payload.
+// Internal events are only sent by rcond itself, Agent.Event rejects them and List leaves them out.
+type EventType struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Schema      *schema.Schema   `json:"schema,omitempty"`
+	Handler     EventHandlerFunc `json:"-"`
+	Internal    bool             `json:"-"`
+}
+
+// EventRegistry holds the event types known to a node.
+type EventRegistry struct {
+	mu     sync.RWMutex
+	events map[string]EventType
+}
+
+// NewEventRegistry creates an empty event registry.
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{events: make(map[string]EventType)}
+}
+
+// DefaultEventRegistry creates an event registry with the built-in events.
+// The restart and shutdown events schedule their action with power.
+func DefaultEventRegistry(power *system.Power) *EventRegistry {
+	r := NewEventRegistry()
+	r.MustRegister(EventType{
+		Name:        "printHostname",
+		Description: "Log the hostname of every node",
+		Handler:     printHostname,
+	})
+	r.MustRegister(EventType{
+		Name:        "restart",
+		Description: "Restart every node",
+		Handler:     powerHandler(power, system.PowerReboot),
+	})
+	r.MustRegister(EventType{
+		Name:        "shutdown",
+		Description: "Shutdown every node",
+		Handler:     powerHandler(power, system.PowerPoweroff),
+	})
+	return r
+}
+
+// Register adds an event type to the registry.
+// Returns an error if the name is empty, the handler is missing or the name is already taken.
+func (r *EventRegistry) Register(event EventType) error {
+	if event.Name == "" {
+		return fmt.Errorf("event name is required")
+	}
+	if event.Handler == nil {
+		return fmt.Errorf("event %s has no handler", event.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.events[event.Name]; ok {
+		return fmt.Errorf("event %s is already registered", event.Name)
+	}
+	r.events[event.Name] = event
+	return nil
+}
+
+// MustRegister adds an event type to the registry and panics on error.
+func (r *EventRegistry) MustRegister(event EventType) {
+	if err := r.Register(event); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the event type with the given name.
+func (r *EventRegistry) Get(name string) (EventType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	event, ok := r.events[name]
+	return event, ok
+}
+
+// List returns the registered event types that are not internal, sorted by name.
+func (r *EventRegistry) List() []EventType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	events := make([]EventType, 0, len(r.events))
+	for _, event := range r.events {
+		if event.Internal {
+			continue
+		}
+		events = append(events, event)
 	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
 }
 
-func restart(payload []byte) {
-	if err := system.Restart(); err != nil {
-		log.Printf("[ERROR] (ClusterEvent:restart) failed: %s", err)
+// Validate checks that the event is registered and the payload matches its schema.
+func (r *EventRegistry) Validate(name string, payload json.RawMessage) error {
+	event, ok := r.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, name)
 	}
+	if event.Schema == nil {
+		if !isEmptyPayload(payload) {
+			return &schema.ValidationError{Errors: []schema.FieldError{{Message: fmt.Sprintf("event %s does not accept a payload", name)}}}
+		}
+		return nil
+	}
+	return event.Schema.Validate(payload)
 }
 
-func shutdown(payload []byte) {
-	if err := system.Shutdown(); err != nil {
-		log.Printf("[ERROR] (ClusterEvent:shutdown) failed: %s", err)
+// Dispatch runs the handler of the named event.
+// The payload must have been checked with Validate, it is passed to the handler as is.
+func (r *EventRegistry) Dispatch(ctx context.Context, name string, sender string, payload json.RawMessage) error {
+	event, ok := r.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+	}
+	return event.Handler(ctx, sender, payload)
+}
+
+func isEmptyPayload(payload json.RawMessage) bool {
+	return len(payload) == 0 || string(payload) == "null"
+}
+
+// powerHandler schedules the power action on the local node, like POST /system/restart and /system/shutdown.
+// The action is rejected while logind holds a block inhibitor for shutdown.
+func powerHandler(power *system.Power, action string) EventHandlerFunc {
+	return func(ctx context.Context, sender string, payload json.RawMessage) error {
+		log.Printf("[INFO] (ClusterEvent:%s) requested by %s", action, sender)
+		_, err := power.Schedule(action, time.Time{}, false, sender)
+		return err
 	}
 }
 
 // just a sample function to test event functionality
-func printHostname(payload []byte) {
-	hostname, _ := network.GetHostname()
+func printHostname(ctx context.Context, sender string, payload json.RawMessage) error {
+	hostname, err := network.GetHostname()
+	if err != nil {
+		return err
+	}
 	log.Printf("[INFO] (ClusterEvent:printHostname): %s", hostname)
+	return nil
 }
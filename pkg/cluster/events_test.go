@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRegistry(t *testing.T) {
+	var gotSender string
+	var gotPayload json.RawMessage
+	r := NewEventRegistry()
+	err := r.Register(EventType{
+		Name:   "greet",
+		Schema: schema.MustParse(`{"type": "object", "required": ["name"]}`),
+		Handler: func(ctx context.Context, sender string, payload json.RawMessage) error {
+			gotSender = sender
+			gotPayload = payload
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Error(t, r.Register(EventType{Name: "greet", Handler: printHostname}))
+	assert.Error(t, r.Register(EventType{Name: "nohandler"}))
+
+	assert.NoError(t, r.Dispatch(context.Background(), "greet", "node-1", json.RawMessage(`{"name": "pi"}`)))
+	assert.Equal(t, "node-1", gotSender)
+	assert.JSONEq(t, `{"name": "pi"}`, string(gotPayload))
+
+	assert.Error(t, r.Validate("greet", json.RawMessage(`{}`)))
+	assert.True(t, errors.Is(r.Validate("missing", nil), ErrUnknownEvent))
+	assert.True(t, errors.Is(r.Dispatch(context.Background(), "missing", "node-1", nil), ErrUnknownEvent))
+}
+
+func TestDefaultEventRegistry(t *testing.T) {
+	r := DefaultEventRegistry(system.NewPower())
+	names := []string{}
+	for _, event := range r.List() {
+		names = append(names, event.Name)
+	}
+	assert.Equal(t, []string{"printHostname", "restart", "shutdown"}, names)
+	assert.NoError(t, r.Validate("restart", nil))
+	assert.Error(t, r.Validate("restart", json.RawMessage(`"now"`)))
+}
+
+func TestDecodeEventMessage(t *testing.T) {
+	assert.Equal(t, eventMessage{Sender: "node-1", Payload: json.RawMessage(`{"name":"pi"}`)}, decodeEventMessage([]byte(`{"sender":"node-1","payload":{"name":"pi"}}`)))
+	// nodes that do not send the sender yet
+	assert.Equal(t, eventMessage{}, decodeEventMessage([]byte(`{"Name":"restart","Data":null}`)))
+	assert.Equal(t, eventMessage{Payload: json.RawMessage(`{"name":"pi"}`)}, decodeEventMessage([]byte(`{"Name":"greet","Data":"eyJuYW1lIjoicGkifQ=="}`)))
+	// events of other Serf clients
+	assert.Equal(t, eventMessage{Payload: json.RawMessage(`{"name":"pi"}`)}, decodeEventMessage([]byte(`{"name":"pi"}`)))
+	assert.Equal(t, eventMessage{Payload: json.RawMessage(`"hello"`)}, decodeEventMessage([]byte(`hello`)))
+	assert.Equal(t, eventMessage{}, decodeEventMessage(nil))
+}
+
+func TestEventQueue(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	r := NewEventRegistry()
+	r.MustRegister(EventType{Name: "slow", Handler: func(ctx context.Context, sender string, payload json.RawMessage) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+	history, err := NewHistory("", 10)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := &Agent{Events: r, History: history, statusChanges: newStatusChanges(), userEvents: make(chan serf.UserEvent, 1), ctx: ctx}
+	eventCh := make(chan serf.Event)
+	defer close(eventCh)
+	go a.handleEvents(eventCh)
+	go a.runEventHandlers()
+
+	eventCh <- serf.UserEvent{Name: "slow", LTime: 1}
+	<-started
+	eventCh <- serf.UserEvent{Name: "slow", LTime: 2}
+	eventCh <- serf.UserEvent{Name: "slow", LTime: 3}
+	// member events are handled while the handler runs
+	eventCh <- serf.MemberEvent{Type: serf.EventMemberJoin, Members: []serf.Member{{Name: "node-2"}}}
+	assert.Eventually(t, func() bool { return len(history.Query(HistoryFilter{})) == 3 }, time.Second, 5*time.Millisecond)
+	events := history.Query(HistoryFilter{Type: HistoryUser})
+	require.Len(t, events, 2)
+	// the running event is recorded before its handler returns
+	assert.Equal(t, uint64(3), events[0].LTime)
+	assert.Equal(t, OutcomeRejected, events[0].Outcome)
+	assert.Equal(t, uint64(1), events[1].LTime)
+	assert.Equal(t, OutcomeReceived, events[1].Outcome)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		events := history.Query(HistoryFilter{Type: HistoryUser})
+		return len(events) == 3 && events[0].Outcome == OutcomeOK && events[2].Outcome == OutcomeOK
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,264 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultHistorySize is the number of entries kept if no size is configured.
+const defaultHistorySize = 1000
+
+// History entry types
+const (
+	HistoryUser         = "user"
+	HistoryQuery        = "query"
+	HistoryMemberJoin   = "member-join"
+	HistoryMemberLeave  = "member-leave"
+	HistoryMemberFailed = "member-failed"
+	HistoryMemberUpdate = "member-update"
+	HistoryMemberReap   = "member-reap"
+)
+
+// Handler outcomes of a history entry
+const (
+	OutcomeReceived  = "received"
+	OutcomeOK        = "ok"
+	OutcomeFailed    = "failed"
+	OutcomeRejected  = "rejected"
+	OutcomeUnhandled = "unhandled"
+)
+
+// HistoryEntry is a single record of a cluster event received by this node.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Name    string    `json:"name,omitempty"`
+	LTime   uint64    `json:"ltime,omitempty"`
+	Sender  string    `json:"sender,omitempty"`
+	Members []string  `json:"members,omitempty"`
+	Outcome string    `json:"outcome,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// HistoryFilter selects entries from the history.
+// Zero values match everything.
+type HistoryFilter struct {
+	Type  string
+	Name  string
+	Node  string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// History is a bounded log of cluster events.
+// If a path is set, entries are appended to a JSON lines file and survive restarts.
+type History struct {
+	mu        sync.RWMutex
+	path      string
+	size      int
+	entries   []HistoryEntry
+	fileLines int
+}
+
+// NewHistory creates a history that keeps up to size entries.
+// If path is not empty, existing entries are loaded from the file.
+func NewHistory(path string, size int) (*History, error) {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	h := &History{path: path, size: size}
+	if path == "" {
+		return h, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *History) load() error {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history: %v", err)
+	}
+	defer f.Close()
+
+	// updated entries are appended again, the last line of an entry wins
+	index := make(map[historyKey]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.fileLines++
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if i, ok := index[entry.key()]; ok {
+			h.entries[i] = entry
+			continue
+		}
+		index[entry.key()] = len(h.entries)
+		h.entries = append(h.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+	return nil
+}
+
+// historyKey identifies an entry, so its outcome can be updated.
+type historyKey struct {
+	time  time.Time
+	kind  string
+	name  string
+	ltime uint64
+}
+
+func (e HistoryEntry) key() historyKey {
+	return historyKey{e.Time, e.Type, e.Name, e.LTime}
+}
+
+// Record adds an entry to the history and returns it with its time.
+// Errors writing the history file are logged and do not affect the in-memory log.
+func (h *History) Record(entry HistoryEntry) HistoryEntry {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+	h.write(entry)
+	return entry
+}
+
+// Update replaces a recorded entry, like one received before its handler ran, with its outcome.
+// Entries that are no longer kept are not updated.
+func (h *History) Update(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if h.entries[i].key() == entry.key() {
+			h.entries[i] = entry
+			h.write(entry)
+			return
+		}
+	}
+}
+
+func (h *History) write(entry HistoryEntry) {
+	if h.path == "" {
+		return
+	}
+	if err := h.persist(entry); err != nil {
+		log.Printf("[ERROR] Failed to write cluster history: %v", err)
+	}
+}
+
+// persist appends the entry to the history file and compacts the file
+// once it holds twice as many lines as the history keeps.
+func (h *History) persist(entry HistoryEntry) error {
+	if h.fileLines >= 2*h.size {
+		return h.compact()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.fileLines++
+	return nil
+}
+
+func (h *History) compact() error {
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range h.entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	h.fileLines = len(h.entries)
+	return nil
+}
+
+// Query returns the entries matching the filter, newest first.
+func (h *History) Query(filter HistoryFilter) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	result := []HistoryEntry{}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+		if !filter.matches(entry) {
+			continue
+		}
+		result = append(result, entry)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func (f HistoryFilter) matches(entry HistoryEntry) bool {
+	if f.Type != "" && entry.Type != f.Type {
+		return false
+	}
+	if f.Name != "" && entry.Name != f.Name {
+		return false
+	}
+	if f.Node != "" && entry.Sender != f.Node && !contains(entry.Members, f.Node) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	h, err := NewHistory("", 10)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	h.Record(HistoryEntry{Time: now.Add(-2 * time.Hour), Type: HistoryUser, Name: "restart", Sender: "node-1", Outcome: OutcomeOK})
+	h.Record(HistoryEntry{Time: now.Add(-time.Hour), Type: HistoryMemberJoin, Members: []string{"node-2"}})
+	h.Record(HistoryEntry{Time: now, Type: HistoryUser, Name: "printHostname", Sender: "node-2", Outcome: OutcomeFailed})
+
+	assert.Len(t, h.Query(HistoryFilter{}), 3)
+	assert.Equal(t, "printHostname", h.Query(HistoryFilter{})[0].Name)
+	assert.Len(t, h.Query(HistoryFilter{Type: HistoryUser}), 2)
+	assert.Len(t, h.Query(HistoryFilter{Node: "node-2"}), 2)
+	assert.Len(t, h.Query(HistoryFilter{Since: now.Add(-90 * time.Minute)}), 2)
+	assert.Len(t, h.Query(HistoryFilter{Limit: 1}), 1)
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := NewHistory(path, 3)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		h.Record(HistoryEntry{Type: HistoryUser, LTime: uint64(i)})
+	}
+	assert.Len(t, h.Query(HistoryFilter{}), 3)
+
+	reloaded, err := NewHistory(path, 3)
+	assert.NoError(t, err)
+	entries := reloaded.Query(HistoryFilter{})
+	assert.Len(t, entries, 3)
+	assert.Equal(t, uint64(9), entries[0].LTime)
+	assert.LessOrEqual(t, reloaded.fileLines, 6)
+}
+
+func TestHistoryUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := NewHistory(path, 10)
+	require.NoError(t, err)
+	entry := h.Record(HistoryEntry{Type: HistoryUser, Name: "restart", LTime: 4, Outcome: OutcomeReceived})
+	h.Record(HistoryEntry{Type: HistoryMemberJoin, Members: []string{"node-2"}})
+
+	// a node that restarts before the handler returned keeps the received entry
+	reloaded, err := NewHistory(path, 10)
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeReceived, reloaded.Query(HistoryFilter{Type: HistoryUser})[0].Outcome)
+
+	entry.Outcome = OutcomeFailed
+	entry.Error = "no reply"
+	h.Update(entry)
+	assert.Equal(t, OutcomeFailed, h.Query(HistoryFilter{Type: HistoryUser})[0].Outcome)
+
+	reloaded, err = NewHistory(path, 10)
+	require.NoError(t, err)
+	entries := reloaded.Query(HistoryFilter{})
+	require.Len(t, entries, 2)
+	assert.Equal(t, OutcomeFailed, entries[1].Outcome)
+	assert.Equal(t, "no reply", entries[1].Error)
+}
@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"log"
+	"time"
+)
+
+// Defaults for retrying to join the cluster
+const (
+	defaultRetryJoinInterval    = 5 * time.Second
+	defaultRetryJoinMaxInterval = 5 * time.Minute
+)
+
+// RetryJoin tries to join the cluster with the given addresses until at least one node was joined.
+// The interval between attempts doubles after each failure up to maxInterval.
+// maxAttempts limits the number of attempts, 0 retries until the agent is shut down.
+func (a *Agent) RetryJoin(addrs []string, interval, maxInterval time.Duration, maxAttempts int) {
+	if len(addrs) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultRetryJoinInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = defaultRetryJoinMaxInterval
+	}
+
+	for attempt := 1; ; attempt++ {
+		if n, err := a.Join(addrs, true); err == nil && n > 0 {
+			return
+		}
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			log.Printf("[ERROR] Giving up joining the cluster after %d attempts", attempt)
+			return
+		}
+		log.Printf("[WARN] Join attempt %d failed, retrying in %s", attempt, interval)
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		interval = nextBackoff(interval, maxInterval)
+	}
+}
+
+// nextBackoff doubles the interval without exceeding max.
+func nextBackoff(interval, max time.Duration) time.Duration {
+	interval *= 2
+	if interval > max {
+		return max
+	}
+	return interval
+}
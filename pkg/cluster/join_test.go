@@ -0,0 +1,13 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, nextBackoff(5*time.Second, time.Minute))
+	assert.Equal(t, time.Minute, nextBackoff(45*time.Second, time.Minute))
+}
@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/serf/serf"
+)
+
+// keyringFile is the name of the keyring file in the data directory.
+const keyringFile = "serf.keyring"
+
+// ErrInvalidKey is returned when a key is not a base64 encoded 16, 24 or 32 byte key.
+var ErrInvalidKey = errors.New("key must be base64 encoded and 16, 24 or 32 bytes long")
+
+// KeyResponse is the result of a keyring operation across the cluster.
+type KeyResponse struct {
+	Keys        map[string]int    `json:"keys"`
+	PrimaryKeys map[string]int    `json:"primary_keys"`
+	NumNodes    int               `json:"num_nodes"`
+	NumResp     int               `json:"num_resp"`
+	NumErr      int               `json:"num_err"`
+	Messages    map[string]string `json:"messages,omitempty"`
+}
+
+// ListKeys returns the keys installed on the members of the cluster.
+func (a *Agent) ListKeys() (*KeyResponse, error) {
+	resp, err := a.Serf.KeyManager().ListKeys()
+	return toKeyResponse(resp), err
+}
+
+// InstallKey installs a key on all members of the cluster.
+// If primary is true, the key is also used to encrypt messages.
+func (a *Agent) InstallKey(key string, primary bool) (*KeyResponse, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := a.Serf.KeyManager().InstallKey(key)
+	if err != nil || !primary {
+		return toKeyResponse(resp), err
+	}
+	resp, err = a.Serf.KeyManager().UseKey(key)
+	return toKeyResponse(resp), err
+}
+
+// RemoveKey removes a key from all members of the cluster.
+// The primary key can not be removed.
+func (a *Agent) RemoveKey(key string) (*KeyResponse, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := a.Serf.KeyManager().RemoveKey(key)
+	return toKeyResponse(resp), err
+}
+
+func validateKey(key string) error {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return ErrInvalidKey
+	}
+	switch len(decoded) {
+	case 16, 24, 32:
+		return nil
+	}
+	return ErrInvalidKey
+}
+
+func toKeyResponse(resp *serf.KeyResponse) *KeyResponse {
+	if resp == nil {
+		return nil
+	}
+	return &KeyResponse{
+		Keys:        resp.Keys,
+		PrimaryKeys: resp.PrimaryKeys,
+		NumNodes:    resp.NumNodes,
+		NumResp:     resp.NumResp,
+		NumErr:      resp.NumErr,
+		Messages:    resp.Messages,
+	}
+}
+
+// loadKeyring reads a keyring file written by Serf.
+// The file contains a JSON list of base64 encoded keys, the first key is the primary key.
+func loadKeyring(path string) (*memberlist.Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var encodedKeys []string
+	if err := json.Unmarshal(data, &encodedKeys); err != nil {
+		return nil, fmt.Errorf("invalid keyring file %s: %v", path, err)
+	}
+	if len(encodedKeys) == 0 {
+		return nil, fmt.Errorf("keyring file %s contains no keys", path)
+	}
+	keys := make([][]byte, 0, len(encodedKeys))
+	for _, encodedKey := range encodedKeys {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in keyring file %s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return memberlist.NewKeyring(keys, keys[0])
+}
+
+// writeKeyring writes the keys to a keyring file in the format used by Serf.
+func writeKeyring(path string, keys ...[]byte) error {
+	encodedKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		encodedKeys = append(encodedKeys, base64.StdEncoding.EncodeToString(key))
+	}
+	data, err := json.MarshalIndent(encodedKeys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
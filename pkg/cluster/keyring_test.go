@@ -0,0 +1,26 @@
+package cluster
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKey(t *testing.T) {
+	assert.NoError(t, validateKey("T9jncgl9mbLus+baTTa7q7nPSUrXwbDi2dhbtqir37s="))
+	assert.ErrorIs(t, validateKey("c2hvcnQ="), ErrInvalidKey)
+	assert.ErrorIs(t, validateKey("not base64!"), ErrInvalidKey)
+}
+
+func TestKeyringFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), keyringFile)
+	primary := []byte("DMXnaJUUbIBMj1Df0dPsQY+Sks1VxWTa")
+	secondary := []byte("0123456789abcdef")
+	assert.NoError(t, writeKeyring(path, primary, secondary))
+
+	keyring, err := loadKeyring(path)
+	assert.NoError(t, err)
+	assert.Equal(t, primary, keyring.GetPrimaryKey())
+	assert.Len(t, keyring.GetKeys(), 2)
+}
@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+const (
+	leaderLeaseQuery = internalQueryPrefix + "leader_lease"
+	// leaderLeaseDuration is how long a granted lease is valid.
+	leaderLeaseDuration = 15 * time.Second
+	// leaderRenewInterval is the interval in which the candidate renews its lease.
+	leaderRenewInterval = 5 * time.Second
+)
+
+// LeaderWorkerFunc is a task that must only run on the leader.
+// The context is cancelled when the node loses the leadership or the agent shuts down.
+type LeaderWorkerFunc func(ctx context.Context)
+
+// LeaderInfo describes the current leader as seen by this node.
+type LeaderInfo struct {
+	Leader       string    `json:"leader"`
+	IsLeader     bool      `json:"is_leader"`
+	LeaseExpires time.Time `json:"lease_expires,omitempty"`
+}
+
+// Election elects the alive member with the lowest name as leader.
+// The candidate asks all members to grant it a lease with a query and becomes leader
+// once a majority granted it. The lease is renewed periodically and expires if the
+// candidate fails, so another member takes over once the lease expired.
+// Tasks that must run on a single node are registered as workers, they run while the node is the leader.
+type Election struct {
+	agent *Agent
+
+	mu           sync.Mutex
+	leader       string
+	leaseExpires time.Time
+	isLeader     bool
+	workers      map[string]LeaderWorkerFunc
+	// leaderCtx is cancelled when the node steps down, expiry steps down once the lease expired without renewal.
+	leaderCtx context.Context
+	cancel    context.CancelFunc
+	expiry    *time.Timer
+}
+
+type leaseRequest struct {
+	Leader   string        `json:"leader"`
+	Duration time.Duration `json:"duration"`
+}
+
+type leaseResponse struct {
+	Granted bool   `json:"granted"`
+	Leader  string `json:"leader,omitempty"`
+}
+
+func newElection(agent *Agent) *Election {
+	e := &Election{
+		agent:   agent,
+		workers: make(map[string]LeaderWorkerFunc),
+	}
+	agent.RegisterQuery(leaderLeaseQuery, e.handleLease)
+	return e
+}
+
+// Start runs the election until the agent is shut down.
+func (e *Election) Start() {
+	go func() {
+		ticker := time.NewTicker(leaderRenewInterval)
+		defer ticker.Stop()
+		for {
+			e.tick()
+			select {
+			case <-e.agent.ctx.Done():
+				e.stepDown()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RegisterWorker registers a task that runs while this node is the leader.
+// If the node is already the leader, the task is started right away.
+// A worker is started again each time the node becomes leader.
+func (e *Election) RegisterWorker(name string, worker LeaderWorkerFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.workers[name] = worker
+	if e.isLeader {
+		go worker(e.leaderCtx)
+	}
+}
+
+// Info returns the current leader.
+// The leader is empty if no valid lease is known.
+func (e *Election) Info() LeaderInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Now().After(e.leaseExpires) {
+		return LeaderInfo{}
+	}
+	return LeaderInfo{
+		Leader:       e.leader,
+		IsLeader:     e.isLeader,
+		LeaseExpires: e.leaseExpires,
+	}
+}
+
+// IsLeader reports whether this node holds a valid leader lease.
+func (e *Election) IsLeader() bool {
+	return e.Info().IsLeader
+}
+
+// tick requests or renews the lease if this node is the candidate and steps down otherwise.
+func (e *Election) tick() {
+	self := e.agent.Serf.LocalMember().Name
+	if candidate(e.agent.Serf.Members()) != self {
+		e.stepDown()
+		return
+	}
+
+	payload, _ := json.Marshal(leaseRequest{Leader: self, Duration: leaderLeaseDuration})
+	start := time.Now()
+	responses, err := e.agent.Query(leaderLeaseQuery, payload, nil, 0)
+	if err != nil {
+		log.Printf("[WARN] Leader lease query failed: %v", err)
+		e.stepDown()
+		return
+	}
+	granted := 0
+	for _, raw := range responses {
+		var resp leaseResponse
+		if err := json.Unmarshal(raw, &resp); err == nil && resp.Granted {
+			granted++
+		}
+	}
+	if granted*2 <= aliveCount(e.agent.Serf.Members()) {
+		log.Printf("[WARN] Leader lease granted by %d of %d members", granted, len(responses))
+		e.stepDown()
+		return
+	}
+	e.becomeLeader(start.Add(leaderLeaseDuration))
+}
+
+func (e *Election) becomeLeader(expires time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leaseExpires = expires
+	if e.expiry != nil {
+		e.expiry.Stop()
+	}
+	e.expiry = time.AfterFunc(time.Until(expires), e.stepDown)
+	if e.isLeader {
+		return
+	}
+	log.Printf("[INFO] Acquired cluster leadership")
+	e.isLeader = true
+	e.leaderCtx, e.cancel = context.WithCancel(e.agent.ctx)
+	for _, worker := range e.workers {
+		go worker(e.leaderCtx)
+	}
+}
+
+func (e *Election) stepDown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.expiry != nil {
+		e.expiry.Stop()
+		e.expiry = nil
+	}
+	if !e.isLeader {
+		return
+	}
+	log.Printf("[INFO] Lost cluster leadership")
+	e.isLeader = false
+	e.cancel()
+	e.leaderCtx, e.cancel = nil, nil
+}
+
+// handleLease grants a lease to the requesting node if it already holds the lease
+// or if no other valid lease is known. A new candidate takes over only after the
+// lease of the previous leader expired, so two nodes never hold a lease at once.
+func (e *Election) handleLease(ctx context.Context, query *serf.Query) ([]byte, error) {
+	var req leaseRequest
+	if err := json.Unmarshal(query.Payload, &req); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	expired := time.Now().After(e.leaseExpires)
+	if !expired && req.Leader != e.leader {
+		return json.Marshal(leaseResponse{Granted: false, Leader: e.leader})
+	}
+	e.leader = req.Leader
+	e.leaseExpires = time.Now().Add(req.Duration)
+	return json.Marshal(leaseResponse{Granted: true, Leader: req.Leader})
+}
+
+// candidate returns the alive member with the lowest name.
+func candidate(members []serf.Member) string {
+	var names []string
+	for _, member := range members {
+		if member.Status == serf.StatusAlive {
+			names = append(names, member.Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func aliveCount(members []serf.Member) int {
+	n := 0
+	for _, member := range members {
+		if member.Status == serf.StatusAlive {
+			n++
+		}
+	}
+	return n
+}
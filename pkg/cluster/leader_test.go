@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidate(t *testing.T) {
+	members := []serf.Member{
+		{Name: "rpi-a", Status: serf.StatusFailed},
+		{Name: "rpi-c", Status: serf.StatusAlive},
+		{Name: "rpi-b", Status: serf.StatusAlive},
+	}
+	assert.Equal(t, "rpi-b", candidate(members))
+	assert.Equal(t, 2, aliveCount(members))
+	assert.Equal(t, "", candidate(nil))
+}
+
+func TestHandleLease(t *testing.T) {
+	e := &Election{}
+	lease := func(leader string, duration time.Duration) leaseResponse {
+		payload, _ := json.Marshal(leaseRequest{Leader: leader, Duration: duration})
+		raw, err := e.handleLease(context.Background(), &serf.Query{Payload: payload})
+		require.NoError(t, err)
+		var resp leaseResponse
+		require.NoError(t, json.Unmarshal(raw, &resp))
+		return resp
+	}
+
+	assert.True(t, lease("rpi-b", time.Minute).Granted)
+	assert.True(t, lease("rpi-b", time.Minute).Granted, "the leader renews its lease")
+	resp := lease("rpi-a", time.Minute)
+	assert.False(t, resp.Granted, "no other node is granted a lease while it is valid")
+	assert.Equal(t, "rpi-b", resp.Leader)
+
+	e.leaseExpires = time.Now().Add(-time.Second)
+	assert.True(t, lease("rpi-a", time.Minute).Granted, "the lease is granted after it expired")
+	assert.Equal(t, "rpi-a", e.leader)
+}
+
+func TestLeaderWorkers(t *testing.T) {
+	e := newTestElection(t)
+	started := make(chan context.Context, 2)
+	e.RegisterWorker("test", func(ctx context.Context) { started <- ctx })
+
+	e.becomeLeader(time.Now().Add(time.Minute))
+	var ctx context.Context
+	select {
+	case ctx = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not started")
+	}
+	assert.NoError(t, ctx.Err())
+
+	e.stepDown()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.False(t, e.IsLeader())
+
+	// the lease expires without renewal
+	e.becomeLeader(time.Now().Add(50 * time.Millisecond))
+	select {
+	case ctx = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not started again")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("worker was not stopped when the lease expired")
+	}
+	assert.False(t, e.IsLeader())
+}
+
+func newTestElection(t *testing.T) *Election {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Election{
+		agent:   &Agent{ctx: ctx},
+		workers: make(map[string]LeaderWorkerFunc),
+	}
+}
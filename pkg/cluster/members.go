@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// ErrMemberNotFound is returned when a member is not known to the cluster.
+var ErrMemberNotFound = errors.New("member not found")
+
+// Member is the API representation of a cluster member.
+type Member struct {
+	Name        string            `json:"name"`
+	Addr        string            `json:"addr"`
+	Port        uint16            `json:"port"`
+	Tags        map[string]string `json:"tags"`
+	Status      string            `json:"status"`
+	ProtocolMin uint8             `json:"protocol_min"`
+	ProtocolMax uint8             `json:"protocol_max"`
+	ProtocolCur uint8             `json:"protocol_cur"`
+	DelegateMin uint8             `json:"delegate_min"`
+	DelegateMax uint8             `json:"delegate_max"`
+	DelegateCur uint8             `json:"delegate_cur"`
+	// StatusChangedAt is the time this node received the last member event of the member,
+	// like its join or failure, nil if it received none since it started.
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	RTT             *float64   `json:"rtt_ms,omitempty"`
+}
+
+// MemberFilter selects members of the cluster.
+// Zero values match everything, all tags must match.
+type MemberFilter struct {
+	Status string
+	Tags   map[string]string
+}
+
+func (f MemberFilter) matches(member serf.Member) bool {
+	if f.Status != "" && member.Status.String() != f.Status {
+		return false
+	}
+	for key, value := range f.Tags {
+		if member.Tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// statusChanges tracks when the status of members last changed.
+type statusChanges struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newStatusChanges() *statusChanges {
+	return &statusChanges{times: make(map[string]time.Time)}
+}
+
+// update records the time for the members of a member event.
+func (c *statusChanges) update(members []serf.Member, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, member := range members {
+		c.times[member.Name] = t
+	}
+}
+
+// get returns the time of the last member event of a member, nil if there was none.
+func (c *statusChanges) get(name string) *time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.times[name]; ok {
+		return &t
+	}
+	return nil
+}
+
+// Members returns the members of the Serf cluster matching the filter, sorted by name.
+func (a *Agent) Members(filter MemberFilter) ([]Member, error) {
+	members := []Member{}
+	for _, member := range a.Serf.Members() {
+		if !filter.matches(member) {
+			continue
+		}
+		members = append(members, a.toMember(member))
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// Member returns the member with the given name.
+func (a *Agent) Member(name string) (*Member, error) {
+	for _, member := range a.Serf.Members() {
+		if member.Name == name {
+			m := a.toMember(member)
+			return &m, nil
+		}
+	}
+	return nil, ErrMemberNotFound
+}
+
+func (a *Agent) toMember(member serf.Member) Member {
+	return Member{
+		Name:        member.Name,
+		Addr:        member.Addr.String(),
+		Port:        member.Port,
+		Tags:        member.Tags,
+		Status:      member.Status.String(),
+		ProtocolMin: member.ProtocolMin,
+		ProtocolMax: member.ProtocolMax,
+		ProtocolCur: member.ProtocolCur,
+		DelegateMin: member.DelegateMin,
+		DelegateMax: member.DelegateMax,
+		DelegateCur: member.DelegateCur,
+		RTT:         a.rtt(member.Name),
+
+		StatusChangedAt: a.statusChanges.get(member.Name),
+	}
+}
+
+// rtt estimates the round trip time to a member in milliseconds
+// using the Vivaldi network coordinates. Returns nil if no estimate is available.
+func (a *Agent) rtt(name string) *float64 {
+	local, err := a.Serf.GetCoordinate()
+	if err != nil {
+		return nil
+	}
+	if name == a.Serf.LocalMember().Name {
+		zero := 0.0
+		return &zero
+	}
+	remote, ok := a.Serf.GetCachedCoordinate(name)
+	if !ok || remote == nil || !local.IsCompatibleWith(remote) {
+		return nil
+	}
+	ms := float64(local.DistanceTo(remote)) / float64(time.Millisecond)
+	return &ms
+}
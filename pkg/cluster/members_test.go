@@ -0,0 +1,30 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberFilter(t *testing.T) {
+	member := serf.Member{
+		Name:   "node-1",
+		Status: serf.StatusAlive,
+		Tags:   map[string]string{"role": "ap", "site": "lab"},
+	}
+	assert.True(t, MemberFilter{}.matches(member))
+	assert.True(t, MemberFilter{Status: "alive", Tags: map[string]string{"role": "ap"}}.matches(member))
+	assert.False(t, MemberFilter{Status: "failed"}.matches(member))
+	assert.False(t, MemberFilter{Tags: map[string]string{"role": "sta"}}.matches(member))
+}
+
+func TestStatusChanges(t *testing.T) {
+	c := newStatusChanges()
+	assert.Nil(t, c.get("node-1"))
+	joined := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	c.update([]serf.Member{{Name: "node-1", Status: serf.StatusAlive}}, joined)
+	// alive members keep the time they joined
+	assert.Equal(t, joined, *c.get("node-1"))
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// internalQueryPrefix marks queries used internally by rcond.
+// They are answered like other queries but not recorded in the history.
+const internalQueryPrefix = "_rcond_"
+
+// QueryHandlerFunc answers a cluster query.
+// The returned bytes are sent back to the node that issued the query.
+// Handlers run on the event loop and must return quickly.
+type QueryHandlerFunc func(ctx context.Context, query *serf.Query) ([]byte, error)
+
+// queryHandlers holds the query handlers registered on an agent.
+type queryHandlers struct {
+	mu       sync.RWMutex
+	handlers map[string]QueryHandlerFunc
+}
+
+func newQueryHandlers() *queryHandlers {
+	return &queryHandlers{handlers: make(map[string]QueryHandlerFunc)}
+}
+
+// RegisterQuery registers a handler for the named query.
+// A handler registered later for the same name replaces the previous one.
+func (a *Agent) RegisterQuery(name string, handler QueryHandlerFunc) {
+	a.queries.mu.Lock()
+	defer a.queries.mu.Unlock()
+	a.queries.handlers[name] = handler
+}
+
+// Query sends a query to the given nodes, or to all alive nodes if none are given,
+// and collects the responses by node name until every node responded or the timeout expires.
+// A zero timeout uses Serf's default query timeout.
+func (a *Agent) Query(name string, payload []byte, nodes []string, timeout time.Duration) (map[string][]byte, error) {
+	params := a.Serf.DefaultQueryParams()
+	params.FilterNodes = nodes
+	if timeout > 0 {
+		params.Timeout = timeout
+	}
+	expected := len(nodes)
+	if expected == 0 {
+		for _, member := range a.Serf.Members() {
+			if member.Status == serf.StatusAlive {
+				expected++
+			}
+		}
+	}
+	resp, err := a.Serf.Query(name, payload, params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	responses := make(map[string][]byte)
+	for r := range resp.ResponseCh() {
+		responses[r.From] = r.Payload
+		if len(responses) >= expected {
+			break
+		}
+	}
+	return responses, nil
+}
+
+// handleQuery answers a query with the registered handler.
+// Returns the history entry describing the outcome.
+func (a *Agent) handleQuery(query *serf.Query) HistoryEntry {
+	entry := HistoryEntry{
+		Type:   HistoryQuery,
+		Name:   query.Name,
+		LTime:  uint64(query.LTime),
+		Sender: query.SourceNode(),
+	}
+	a.queries.mu.RLock()
+	handler, ok := a.queries.handlers[query.Name]
+	a.queries.mu.RUnlock()
+	if !ok {
+		log.Printf("[INFO] No query handler found for query: %s", query.Name)
+		entry.Outcome = OutcomeUnhandled
+		return entry
+	}
+
+	ctx, cancel := context.WithDeadline(a.ctx, query.Deadline())
+	defer cancel()
+	resp, err := handler(ctx, query)
+	if err == nil {
+		err = query.Respond(resp)
+	}
+	if err != nil {
+		log.Printf("[ERROR] (ClusterQuery:%s) failed: %s", query.Name, err)
+		entry.Outcome = OutcomeFailed
+		entry.Error = fmt.Sprint(err)
+		return entry
+	}
+	entry.Outcome = OutcomeOK
+	return entry
+}
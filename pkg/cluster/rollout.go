@@ -0,0 +1,453 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/hashicorp/serf/serf"
+)
+
+// TagAPIAddr is the member tag holding the URL of the node's HTTP API, like https://0.0.0.0:8080.
+// It is used to check the health of a node during a rolling restart.
+const TagAPIAddr = "api"
+
+const (
+	restartQuery = internalQueryPrefix + "restart"
+	// restartAck is the response of a node that scheduled the restart.
+	restartAck = "ok"
+	// defaultRolloutTimeout is how long a node may take to come back after a restart.
+	defaultRolloutTimeout = 10 * time.Minute
+	rolloutPollInterval   = 2 * time.Second
+	// rolloutWorker is the leader worker that runs rolling restarts.
+	rolloutWorker = "rolling-restart"
+	// rolloutHandoffTimeout is how long a job waits for the rollout worker to take it.
+	rolloutHandoffTimeout = 5 * time.Second
+)
+
+// Rollout node states
+const (
+	RolloutPending    = "pending"
+	RolloutRestarting = "restarting"
+	RolloutWaiting    = "waiting"
+	RolloutHealthy    = "healthy"
+	RolloutFailed     = "failed"
+	RolloutSkipped    = "skipped"
+)
+
+var (
+	// ErrNoNodesSelected is returned when a rolling restart selects no alive member.
+	ErrNoNodesSelected = errors.New("no alive nodes match the selector")
+	// ErrNotLeader is returned when a rolling restart is started on a node that is not the leader.
+	ErrNotLeader = errors.New("this node is not the cluster leader")
+	// ErrRolloutRunning is returned when a rolling restart is started while another one is running.
+	ErrRolloutRunning = errors.New("a rolling restart is already running")
+
+	errLeadershipLost = errors.New("lost the cluster leadership")
+)
+
+// RollingRestartRequest describes a rolling restart of the selected nodes.
+// Nodes are restarted in batches of BatchSize. If WaitHealthy is set, the next batch
+// starts only after every node of the batch is alive again and its /health endpoint passes.
+// If AbortOnFailure is set, the remaining nodes are skipped once a node failed.
+type RollingRestartRequest struct {
+	Selector       Selector `json:"selector"`
+	BatchSize      int      `json:"batch_size,omitempty"`
+	WaitHealthy    bool     `json:"wait_healthy"`
+	AbortOnFailure bool     `json:"abort_on_failure"`
+	Timeout        string   `json:"timeout,omitempty"`
+}
+
+// RolloutNode is the progress of a single node in a rolling restart.
+type RolloutNode struct {
+	Name       string     `json:"name"`
+	Batch      int        `json:"batch"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// rolloutTask hands a rolling restart from its job to the rollout worker.
+type rolloutTask struct {
+	ctx  context.Context
+	run  func(ctx context.Context) (interface{}, error)
+	done chan rolloutResult
+}
+
+type rolloutResult struct {
+	result interface{}
+	err    error
+}
+
+// rollout tracks the nodes of a running rolling restart.
+type rollout struct {
+	mu     sync.Mutex
+	nodes  []RolloutNode
+	report job.ReportFunc
+}
+
+// RollingRestart validates the request and returns the job that restarts the selected nodes.
+// The local node is restarted last, after all other nodes finished, and is not waited for.
+// Rolling restarts only run on the leader, one at a time, in the rollout worker.
+// If the node loses the leadership, the remaining nodes are skipped.
+func (a *Agent) RollingRestart(req RollingRestartRequest) (job.Func, error) {
+	if !a.Leader.IsLeader() {
+		return nil, a.notLeader()
+	}
+	if a.rolloutRunning.Load() {
+		return nil, ErrRolloutRunning
+	}
+	timeout := defaultRolloutTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", req.Timeout)
+		}
+		timeout = d
+	}
+	if req.BatchSize < 0 {
+		return nil, fmt.Errorf("invalid batch size %d", req.BatchSize)
+	}
+
+	var names []string
+	for _, member := range a.Serf.Members() {
+		if member.Status == serf.StatusAlive && req.Selector.Matches(member.Name, member.Tags) {
+			names = append(names, member.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrNoNodesSelected
+	}
+	batches := planBatches(names, a.Serf.LocalMember().Name, req.BatchSize)
+
+	restart := func(ctx context.Context, report job.ReportFunc) (interface{}, error) {
+		r := &rollout{report: report}
+		for i, batch := range batches {
+			for _, name := range batch {
+				r.nodes = append(r.nodes, RolloutNode{Name: name, Batch: i + 1, Status: RolloutPending})
+			}
+		}
+		r.publish()
+
+		var failed error
+		for _, batch := range batches {
+			if ctx.Err() != nil || (failed != nil && req.AbortOnFailure) {
+				for _, name := range batch {
+					r.update(name, RolloutSkipped, nil)
+				}
+				continue
+			}
+			if err := a.restartBatch(ctx, r, batch, req.WaitHealthy, timeout); err != nil && failed == nil {
+				failed = err
+			}
+		}
+		return r.snapshot(), failed
+	}
+
+	return func(ctx context.Context, report job.ReportFunc) (interface{}, error) {
+		if !a.rolloutRunning.CompareAndSwap(false, true) {
+			return nil, ErrRolloutRunning
+		}
+		defer a.rolloutRunning.Store(false)
+
+		task := rolloutTask{
+			ctx:  ctx,
+			run:  func(ctx context.Context) (interface{}, error) { return restart(ctx, report) },
+			done: make(chan rolloutResult, 1),
+		}
+		select {
+		case a.rollouts <- task:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(rolloutHandoffTimeout):
+			return nil, a.notLeader()
+		}
+		res := <-task.done
+		return res.result, res.err
+	}, nil
+}
+
+// runRollouts runs the rolling restarts handed over by their jobs while the node is the leader.
+// A rollout is cancelled when its job is cancelled or the node loses the leadership.
+func (a *Agent) runRollouts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-a.rollouts:
+			runCtx, cancel := context.WithCancel(ctx)
+			stop := context.AfterFunc(task.ctx, cancel)
+			result, err := task.run(runCtx)
+			stop()
+			cancel()
+			if ctx.Err() != nil && task.ctx.Err() == nil {
+				err = errLeadershipLost
+			}
+			task.done <- rolloutResult{result: result, err: err}
+		}
+	}
+}
+
+// notLeader returns ErrNotLeader with the name of the current leader.
+func (a *Agent) notLeader() error {
+	if leader := a.Leader.Info().Leader; leader != "" {
+		return fmt.Errorf("%w, the leader is %s", ErrNotLeader, leader)
+	}
+	return ErrNotLeader
+}
+
+// restartBatch restarts the nodes of a batch and waits for them to come back.
+func (a *Agent) restartBatch(ctx context.Context, r *rollout, batch []string, waitHealthy bool, timeout time.Duration) error {
+	for _, name := range batch {
+		r.update(name, RolloutRestarting, nil)
+	}
+	responses, err := a.Query(restartQuery, nil, batch, 0)
+	if err != nil {
+		for _, name := range batch {
+			r.update(name, RolloutFailed, err)
+		}
+		return err
+	}
+
+	local := a.Serf.LocalMember().Name
+	var wg sync.WaitGroup
+	errs := make(chan error, len(batch))
+	for _, name := range batch {
+		resp, ok := responses[name]
+		if !ok || string(resp) != restartAck {
+			err := fmt.Errorf("node %s did not acknowledge the restart", name)
+			if ok {
+				err = fmt.Errorf("node %s refused the restart: %s", name, resp)
+			}
+			r.update(name, RolloutFailed, err)
+			errs <- err
+			continue
+		}
+		if name == local || !waitHealthy {
+			r.update(name, RolloutHealthy, nil)
+			continue
+		}
+		r.update(name, RolloutWaiting, nil)
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := a.waitRestarted(ctx, name, timeout); err != nil {
+				r.update(name, RolloutFailed, err)
+				errs <- err
+				return
+			}
+			r.update(name, RolloutHealthy, nil)
+		}(name)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// waitRestarted waits until the node went down, is alive again and its health check passes.
+func (a *Agent) waitRestarted(ctx context.Context, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	wentDown := false
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if !wentDown {
+				return fmt.Errorf("node %s did not go down within %s", name, timeout)
+			}
+			return fmt.Errorf("node %s did not become healthy within %s", name, timeout)
+		case <-ticker.C:
+		}
+
+		member, ok := a.serfMember(name)
+		if !ok || member.Status != serf.StatusAlive {
+			wentDown = true
+			continue
+		}
+		if !wentDown {
+			continue
+		}
+		if err := checkHealth(ctx, a.healthClient, member); err != nil {
+			log.Printf("[DEBUG] (RollingRestart) node %s is not healthy yet: %v", name, err)
+			continue
+		}
+		return nil
+	}
+}
+
+func (a *Agent) serfMember(name string) (serf.Member, bool) {
+	for _, member := range a.Serf.Members() {
+		if member.Name == name {
+			return member, true
+		}
+	}
+	return serf.Member{}, false
+}
+
+// newHealthClient returns the client that checks the health of members during a rolling restart.
+// Certificates are verified against the CA file or the system roots, unless verification is disabled.
+func newHealthClient(tlsConfig *config.TLSConfig) (*http.Client, error) {
+	clientConfig := &tls.Config{}
+	if tlsConfig != nil {
+		if tlsConfig.InsecureSkipVerify {
+			log.Printf("[WARN] TLS certificates of other nodes are not verified, tls.insecure_skip_verify is enabled")
+			clientConfig.InsecureSkipVerify = true
+		}
+		if tlsConfig.CAFile != "" {
+			pem, err := os.ReadFile(tlsConfig.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca file: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", tlsConfig.CAFile)
+			}
+			clientConfig.RootCAs = pool
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}, nil
+}
+
+// checkHealth calls the /health endpoint of the member's API.
+// Members without the api tag are healthy once they are alive.
+func checkHealth(ctx context.Context, client *http.Client, member serf.Member) error {
+	addr, ok := member.Tags[TagAPIAddr]
+	if !ok {
+		return nil
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("invalid api address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(u.Hostname()); u.Hostname() == "" || (ip != nil && ip.IsUnspecified()) {
+		u.Host = net.JoinHostPort(member.Addr.String(), u.Port())
+	}
+	u.Path = "/health"
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// handleRestart schedules a reboot shortly after the restart query was answered.
+// If the reboot can not be scheduled, like while a block inhibitor is held, the reason is sent back instead of the acknowledgement.
+func (a *Agent) handleRestart(ctx context.Context, query *serf.Query) ([]byte, error) {
+	log.Printf("[INFO] (ClusterQuery:restart) requested by %s", query.SourceNode())
+	if _, err := a.power.Schedule(system.PowerReboot, time.Time{}, false, query.SourceNode()); err != nil {
+		log.Printf("[WARN] (ClusterQuery:restart) refused: %v", err)
+		return []byte(err.Error()), nil
+	}
+	return []byte(restartAck), nil
+}
+
+// planBatches splits the nodes into batches of the given size, sorted by name.
+// The local node is moved into a batch of its own at the end.
+func planBatches(names []string, local string, size int) [][]string {
+	if size <= 0 {
+		size = 1
+	}
+	sorted := make([]string, 0, len(names))
+	self := false
+	for _, name := range names {
+		if name == local {
+			self = true
+			continue
+		}
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var batches [][]string
+	for len(sorted) > 0 {
+		n := size
+		if n > len(sorted) {
+			n = len(sorted)
+		}
+		batches = append(batches, sorted[:n])
+		sorted = sorted[n:]
+	}
+	if self {
+		batches = append(batches, []string{local})
+	}
+	return batches
+}
+
+func (r *rollout) update(name, status string, err error) {
+	r.mu.Lock()
+	now := time.Now().UTC()
+	for i := range r.nodes {
+		node := &r.nodes[i]
+		if node.Name != name {
+			continue
+		}
+		node.Status = status
+		if err != nil {
+			node.Error = err.Error()
+		}
+		switch status {
+		case RolloutRestarting:
+			node.StartedAt = &now
+		case RolloutHealthy, RolloutFailed, RolloutSkipped:
+			node.FinishedAt = &now
+		}
+	}
+	r.mu.Unlock()
+	r.publish()
+}
+
+func (r *rollout) publish() {
+	nodes := r.snapshot()
+	done := 0
+	current := ""
+	for _, node := range nodes {
+		switch node.Status {
+		case RolloutHealthy, RolloutFailed, RolloutSkipped:
+			done++
+		case RolloutRestarting, RolloutWaiting:
+			current = node.Name
+		}
+	}
+	message := ""
+	if current != "" {
+		message = fmt.Sprintf("restarting %s", current)
+	}
+	r.report(job.Progress{Done: done, Total: len(nodes), Message: message}, nodes)
+}
+
+func (r *rollout) snapshot() []RolloutNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RolloutNode(nil), r.nodes...)
+}
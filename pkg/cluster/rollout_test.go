@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanBatches(t *testing.T) {
+	names := []string{"node-c", "node-a", "local", "node-b"}
+	assert.Equal(t, [][]string{{"node-a", "node-b"}, {"node-c"}, {"local"}}, planBatches(names, "local", 2))
+	assert.Equal(t, [][]string{{"node-a"}, {"node-b"}}, planBatches([]string{"node-b", "node-a"}, "local", 0))
+	assert.Equal(t, [][]string{{"local"}}, planBatches([]string{"local"}, "local", 3))
+}
+
+func TestCheckHealth(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	member := serf.Member{Addr: net.ParseIP("127.0.0.1"), Tags: map[string]string{TagAPIAddr: "http://0.0.0.0:" + port}}
+	assert.NoError(t, checkHealth(context.Background(), http.DefaultClient, member))
+
+	status = http.StatusServiceUnavailable
+	assert.Error(t, checkHealth(context.Background(), http.DefaultClient, member))
+
+	assert.NoError(t, checkHealth(context.Background(), http.DefaultClient, serf.Member{}))
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	_, port, _ = net.SplitHostPort(tlsSrv.Listener.Addr().String())
+	member = serf.Member{Addr: net.ParseIP("127.0.0.1"), Tags: map[string]string{TagAPIAddr: "https://0.0.0.0:" + port}}
+	client, err := newHealthClient(&config.TLSConfig{})
+	require.NoError(t, err)
+	assert.Error(t, checkHealth(context.Background(), client, member), "certificates are verified")
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw}), 0644))
+	client, err = newHealthClient(&config.TLSConfig{CAFile: caFile})
+	require.NoError(t, err)
+	assert.NoError(t, checkHealth(context.Background(), client, member))
+
+	client, err = newHealthClient(&config.TLSConfig{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.NoError(t, checkHealth(context.Background(), client, member))
+}
+
+func TestRolloutWorker(t *testing.T) {
+	a := &Agent{ctx: context.Background(), rollouts: make(chan rolloutTask)}
+	a.Leader = &Election{agent: a, workers: make(map[string]LeaderWorkerFunc)}
+	a.Leader.RegisterWorker(rolloutWorker, a.runRollouts)
+
+	_, err := a.RollingRestart(RollingRestartRequest{})
+	assert.ErrorIs(t, err, ErrNotLeader)
+
+	a.Leader.becomeLeader(time.Now().Add(time.Minute))
+	a.rolloutRunning.Store(true)
+	_, err = a.RollingRestart(RollingRestartRequest{})
+	assert.ErrorIs(t, err, ErrRolloutRunning)
+	a.rolloutRunning.Store(false)
+
+	started := make(chan struct{})
+	task := rolloutTask{
+		ctx: context.Background(),
+		run: func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, nil
+		},
+		done: make(chan rolloutResult, 1),
+	}
+	a.rollouts <- task
+	<-started
+	a.Leader.stepDown()
+	select {
+	case res := <-task.done:
+		assert.ErrorIs(t, res.err, errLeadershipLost)
+	case <-time.After(time.Second):
+		t.Fatal("rollout was not cancelled when the leadership was lost")
+	}
+}
@@ -0,0 +1,181 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"text/template"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/0x1d/rcond/pkg/user"
+)
+
+// Built-in document kinds
+const (
+	KindNetwork       = "network"
+	KindAuthorizedKey = "authorized_key"
+	KindFile          = "file"
+	KindHostname      = "hostname"
+)
+
+// DefaultKinds returns the built-in document kinds.
+// They are applied through the same functions as the local configuration and the HTTP API.
+func DefaultKinds() []Kind {
+	return []Kind{
+		{
+			Name: KindNetwork,
+			Schema: schema.MustParse(`{
+				"type": "object",
+				"required": ["type", "uuid", "id"],
+				"properties": {
+					"type": {"type": "string"},
+					"uuid": {"type": "string"},
+					"id": {"type": "string"},
+					"autoconnect": {"type": "boolean"},
+					"ssid": {"type": "string"},
+					"mode": {"type": "string"},
+					"band": {"type": "string"},
+					"channel": {"type": "integer"},
+					"keymgmt": {"type": "string"},
+					"psk": {"type": "string"},
+					"ipv4method": {"type": "string"},
+					"ipv6method": {"type": "string"}
+				}
+			}`),
+			Apply:   applyNetwork,
+			Secrets: []string{"psk"},
+		},
+		{
+			Name: KindAuthorizedKey,
+			Schema: schema.MustParse(`{
+				"type": "object",
+				"required": ["user", "pubkey"],
+				"properties": {
+					"user": {"type": "string", "minLength": 1},
+					"pubkey": {"type": "string", "minLength": 1}
+				}
+			}`),
+			Apply: applyAuthorizedKey,
+		},
+		{
+			Name: KindFile,
+			Schema: schema.MustParse(`{
+				"type": "object",
+				"required": ["path", "content"],
+				"properties": {
+					"path": {"type": "string", "minLength": 1},
+					"content": {"type": "string", "description": "Base64 encoded content"}
+				}
+			}`),
+			Apply:   applyFile,
+			Secrets: []string{"content"},
+		},
+		{
+			Name: KindHostname,
+			Schema: schema.MustParse(`{
+				"type": "object",
+				"required": ["template"],
+				"properties": {
+					"template": {"type": "string", "minLength": 1, "description": "Go template with .Name and .Tags of the node"}
+				}
+			}`),
+			Apply: applyHostname,
+		},
+	}
+}
+
+func applyNetwork(ctx context.Context, node *Node, doc *Document) error {
+	var connection config.ConnectionConfig
+	if err := json.Unmarshal(doc.Value, &connection); err != nil {
+		return err
+	}
+	if doc.Deleted {
+		if err := network.Remove(connection.UUID); err != nil && !errors.Is(err, network.ErrConnectionNotFound) {
+			return err
+		}
+		return nil
+	}
+	return system.Configure(&config.Config{
+		Network: config.NetworkConfig{Connections: []config.ConnectionConfig{connection}},
+	})
+}
+
+func applyAuthorizedKey(ctx context.Context, node *Node, doc *Document) error {
+	var key struct {
+		User   string `json:"user"`
+		PubKey string `json:"pubkey"`
+	}
+	if err := json.Unmarshal(doc.Value, &key); err != nil {
+		return err
+	}
+	if doc.Deleted {
+		fingerprint, err := user.Fingerprint(key.PubKey)
+		if err != nil {
+			return err
+		}
+		if err := user.RemoveAuthorizedKey(key.User, fingerprint); err != nil && !errors.Is(err, user.ErrKeyNotFound) {
+			return err
+		}
+		return nil
+	}
+	if _, err := user.AddAuthorizedKey(key.User, key.PubKey); err != nil && !errors.Is(err, user.ErrKeyExists) {
+		return err
+	}
+	return nil
+}
+
+func applyFile(ctx context.Context, node *Node, doc *Document) error {
+	var file struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(doc.Value, &file); err != nil {
+		return err
+	}
+	if doc.Deleted {
+		log.Printf("[INFO] Document %s deleted, keeping file %s", doc.Key, file.Path)
+		return nil
+	}
+	content, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return fmt.Errorf("failed to decode base64 content: %v", err)
+	}
+	return system.StoreFile(file.Path, content)
+}
+
+func applyHostname(ctx context.Context, node *Node, doc *Document) error {
+	if doc.Deleted {
+		return nil
+	}
+	var hostname struct {
+		Template string `json:"template"`
+	}
+	if err := json.Unmarshal(doc.Value, &hostname); err != nil {
+		return err
+	}
+	name, err := renderHostname(hostname.Template, node)
+	if err != nil {
+		return err
+	}
+	return system.Configure(&config.Config{Hostname: name})
+}
+
+// renderHostname renders a hostname template for the given node.
+func renderHostname(text string, node *Node) (string, error) {
+	tmpl, err := template.New("hostname").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, node); err != nil {
+		return "", fmt.Errorf("failed to render hostname template: %v", err)
+	}
+	return buf.String(), nil
+}
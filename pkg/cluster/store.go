@@ -0,0 +1,577 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/hashicorp/serf/serf"
+)
+
+// Names of the event and queries used to replicate the store
+const (
+	stateNotifyEvent = "state:notify"
+	stateDigestQuery = internalQueryPrefix + "state_digest"
+	stateFetchQuery  = internalQueryPrefix + "state_fetch"
+)
+
+const (
+	// defaultStateSyncInterval is the interval between anti-entropy runs.
+	defaultStateSyncInterval = time.Minute
+	// stateChunkSize is the number of bytes transferred per fetch query.
+	// It keeps the base64 encoded response below Serf's query response size limit.
+	stateChunkSize = 512
+	// maxDocumentSize limits the size of a document value.
+	maxDocumentSize = 64 * 1024
+)
+
+var (
+	// ErrDocumentNotFound is returned when a document does not exist in the store.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrUnknownKind is returned when a document kind is not registered.
+	ErrUnknownKind = errors.New("unknown document kind")
+)
+
+// Selector scopes a document to a set of nodes.
+// An empty selector matches every node, otherwise the node must be listed
+// in Nodes (if set) and have all Tags (if set).
+type Selector struct {
+	Nodes []string          `json:"nodes,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// Matches reports whether a node with the given name and tags is selected.
+func (s Selector) Matches(name string, tags map[string]string) bool {
+	if len(s.Nodes) > 0 && !contains(s.Nodes, name) {
+		return false
+	}
+	for key, value := range s.Tags {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Document is a versioned piece of desired state.
+type Document struct {
+	Key       string          `json:"key"`
+	Kind      string          `json:"kind"`
+	Version   uint64          `json:"version"`
+	Selector  Selector        `json:"selector"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	UpdatedBy string          `json:"updated_by"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// newer reports whether d supersedes other.
+// Concurrent updates with the same version are ordered by the name of the updating node.
+func (d *Document) newer(other *Document) bool {
+	if other == nil {
+		return true
+	}
+	if d.Version != other.Version {
+		return d.Version > other.Version
+	}
+	return d.UpdatedBy > other.UpdatedBy
+}
+
+// ApplyFunc converges the local node to the state described by a document.
+// It is also called for deleted documents so the state can be removed.
+type ApplyFunc func(ctx context.Context, node *Node, doc *Document) error
+
+// Node describes the local node to apply functions.
+type Node struct {
+	Name string
+	Tags map[string]string
+}
+
+// Kind describes a type of document, the schema of its value and how it is applied.
+// Secrets names the fields of the value that are removed by Redact.
+type Kind struct {
+	Name    string
+	Schema  *schema.Schema
+	Apply   ApplyFunc
+	Secrets []string
+}
+
+// Store is a replicated key/value store of desired state documents.
+// Changes are announced with events and pulled from the announcing node,
+// a periodic anti-entropy run compares digests with all nodes and pulls missing documents.
+type Store struct {
+	mu    sync.RWMutex
+	agent *Agent
+	path  string
+	docs  map[string]*Document
+	kinds map[string]Kind
+}
+
+type stateNotify struct {
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+type stateFetchRequest struct {
+	Resource string `json:"resource"`
+	Key      string `json:"key,omitempty"`
+	Chunk    int    `json:"chunk"`
+}
+
+type stateFetchResponse struct {
+	Data   []byte `json:"data"`
+	Chunks int    `json:"chunks"`
+}
+
+type stateIndexEntry struct {
+	Key       string `json:"key"`
+	Version   uint64 `json:"version"`
+	UpdatedBy string `json:"updated_by"`
+}
+
+// NewStore creates a store replicated by the given agent.
+// If path is not empty, documents are loaded from and saved to this file.
+func NewStore(agent *Agent, path string) (*Store, error) {
+	s := &Store{
+		agent: agent,
+		path:  path,
+		docs:  make(map[string]*Document),
+		kinds: make(map[string]Kind),
+	}
+	if path != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	for _, kind := range DefaultKinds() {
+		s.RegisterKind(kind)
+	}
+	if err := agent.Events.Register(EventType{
+		Name:        stateNotifyEvent,
+		Description: "Announce a change of the desired state",
+		Internal:    true,
+		Schema:      schema.MustParse(`{"type": "object", "required": ["key", "version"], "properties": {"key": {"type": "string"}, "version": {"type": "integer"}}}`),
+		Handler:     s.handleNotify,
+	}); err != nil {
+		return nil, err
+	}
+	agent.RegisterQuery(stateDigestQuery, s.handleDigest)
+	agent.RegisterQuery(stateFetchQuery, s.handleFetch)
+	return s, nil
+}
+
+// RegisterKind adds a document kind to the store.
+func (s *Store) RegisterKind(kind Kind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[kind.Name] = kind
+}
+
+// Start applies the stored documents and runs the anti-entropy loop until the agent is shut down.
+func (s *Store) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultStateSyncInterval
+	}
+	for _, doc := range s.List("") {
+		s.apply(doc)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.agent.ctx.Done():
+				return
+			case <-ticker.C:
+				s.sync()
+			}
+		}
+	}()
+}
+
+// Get returns the document with the given key.
+func (s *Store) Get(key string) (*Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[key]
+	if !ok || doc.Deleted {
+		return nil, ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+// List returns the documents of the given kind, or all documents if kind is empty.
+func (s *Store) List(kind string) []*Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := []*Document{}
+	for _, doc := range s.docs {
+		if doc.Deleted || (kind != "" && doc.Kind != kind) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Key < docs[j].Key })
+	return docs
+}
+
+// Redact returns a copy of the document without the secret fields of its kind.
+func (s *Store) Redact(doc *Document) *Document {
+	s.mu.RLock()
+	kind, ok := s.kinds[doc.Kind]
+	s.mu.RUnlock()
+	if !ok || len(kind.Secrets) == 0 {
+		return doc
+	}
+	var value map[string]json.RawMessage
+	if err := json.Unmarshal(doc.Value, &value); err != nil {
+		return doc
+	}
+	for _, field := range kind.Secrets {
+		delete(value, field)
+	}
+	redacted := *doc
+	redacted.Value, _ = json.Marshal(value)
+	return &redacted
+}
+
+// Put stores a document, applies it locally and announces it to the cluster.
+func (s *Store) Put(key string, kind string, selector Selector, value json.RawMessage) (*Document, error) {
+	doc := &Document{
+		Key:      key,
+		Kind:     kind,
+		Selector: selector,
+		Value:    value,
+	}
+	if err := s.validate(doc); err != nil {
+		return nil, err
+	}
+	return s.update(doc)
+}
+
+// validate checks that the document has a key and a registered kind, and its value matches the schema of the kind.
+func (s *Store) validate(doc *Document) error {
+	if doc.Key == "" {
+		return fmt.Errorf("document key is required")
+	}
+	if len(doc.Value) > maxDocumentSize {
+		return fmt.Errorf("document value exceeds %d bytes", maxDocumentSize)
+	}
+	s.mu.RLock()
+	k, ok := s.kinds[doc.Kind]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, doc.Kind)
+	}
+	if k.Schema != nil {
+		if err := k.Schema.Validate(doc.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete marks a document as deleted and announces the deletion to the cluster.
+func (s *Store) Delete(key string) (*Document, error) {
+	doc, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.update(&Document{
+		Key:      key,
+		Kind:     doc.Kind,
+		Selector: doc.Selector,
+		Value:    doc.Value,
+		Deleted:  true,
+	})
+}
+
+// update stores a new version of a document and announces it.
+func (s *Store) update(doc *Document) (*Document, error) {
+	s.mu.Lock()
+	if current, ok := s.docs[doc.Key]; ok {
+		doc.Version = current.Version
+	}
+	doc.Version++
+	doc.UpdatedBy = s.agent.Serf.LocalMember().Name
+	doc.UpdatedAt = time.Now().UTC()
+	s.docs[doc.Key] = doc
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.apply(doc)
+	payload, _ := json.Marshal(stateNotify{Key: doc.Key, Version: doc.Version})
+	if err := s.agent.sendEvent(ClusterEvent{Name: stateNotifyEvent, Payload: payload}); err != nil {
+		log.Printf("[WARN] Failed to announce state change of %s: %v", doc.Key, err)
+	}
+	return doc, nil
+}
+
+// merge stores a document received from another node if it is newer than the local one.
+// Documents of unknown kinds or with values that do not match the schema of their kind are rejected.
+func (s *Store) merge(doc *Document) error {
+	if err := s.validate(doc); err != nil {
+		return fmt.Errorf("invalid document %s: %w", doc.Key, err)
+	}
+	s.mu.Lock()
+	if !doc.newer(s.docs[doc.Key]) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.docs[doc.Key] = doc
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.apply(doc)
+	return nil
+}
+
+// apply runs the apply function of the document kind if the document selects the local node.
+func (s *Store) apply(doc *Document) {
+	local := s.agent.Serf.LocalMember()
+	if !doc.Selector.Matches(local.Name, local.Tags) {
+		return
+	}
+	s.mu.RLock()
+	kind, ok := s.kinds[doc.Kind]
+	s.mu.RUnlock()
+	if !ok || kind.Apply == nil {
+		log.Printf("[WARN] No apply function for document %s of kind %s", doc.Key, doc.Kind)
+		return
+	}
+	if err := kind.Apply(s.agent.ctx, &Node{Name: local.Name, Tags: local.Tags}, doc); err != nil {
+		log.Printf("[ERROR] Failed to apply document %s: %v", doc.Key, err)
+		return
+	}
+	log.Printf("[INFO] Applied document %s version %d", doc.Key, doc.Version)
+}
+
+// digest returns a hash over the keys and versions of all documents.
+func (s *Store) digest() string {
+	h := sha256.New()
+	for _, entry := range s.index() {
+		fmt.Fprintf(h, "%s:%d:%s\n", entry.Key, entry.Version, entry.UpdatedBy)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// index returns the keys and versions of all documents, including deleted ones.
+func (s *Store) index() []stateIndexEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index := make([]stateIndexEntry, 0, len(s.docs))
+	for _, doc := range s.docs {
+		index = append(index, stateIndexEntry{Key: doc.Key, Version: doc.Version, UpdatedBy: doc.UpdatedBy})
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].Key < index[j].Key })
+	return index
+}
+
+// sync compares the digest with all nodes and pulls the documents that are newer on other nodes.
+func (s *Store) sync() {
+	local := s.digest()
+	responses, err := s.agent.Query(stateDigestQuery, nil, nil, 0)
+	if err != nil {
+		log.Printf("[WARN] State digest query failed: %v", err)
+		return
+	}
+	self := s.agent.Serf.LocalMember().Name
+	for node, digest := range responses {
+		if node == self || string(digest) == local {
+			continue
+		}
+		if err := s.pull(node); err != nil {
+			log.Printf("[WARN] Failed to sync state from %s: %v", node, err)
+		}
+	}
+}
+
+// pull fetches the index of a node and all documents that are newer than the local ones.
+func (s *Store) pull(node string) error {
+	data, err := s.fetch(node, stateFetchRequest{Resource: "index"})
+	if err != nil {
+		return err
+	}
+	var index []stateIndexEntry
+	if err := json.Unmarshal(data, &index); err != nil {
+		return err
+	}
+	for _, entry := range index {
+		remote := &Document{Version: entry.Version, UpdatedBy: entry.UpdatedBy}
+		s.mu.RLock()
+		current := s.docs[entry.Key]
+		s.mu.RUnlock()
+		if !remote.newer(current) {
+			continue
+		}
+		if err := s.pullDocument(node, entry.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullDocument fetches a single document from a node and merges it.
+func (s *Store) pullDocument(node string, key string) error {
+	data, err := s.fetch(node, stateFetchRequest{Resource: "doc", Key: key})
+	if err != nil {
+		return err
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return s.merge(&doc)
+}
+
+// fetch transfers a resource from a node in chunks using queries.
+func (s *Store) fetch(node string, req stateFetchRequest) ([]byte, error) {
+	var data []byte
+	for chunks := 1; req.Chunk < chunks; req.Chunk++ {
+		payload, _ := json.Marshal(req)
+		responses, err := s.agent.Query(stateFetchQuery, payload, []string{node}, 0)
+		if err != nil {
+			return nil, err
+		}
+		raw, ok := responses[node]
+		if !ok {
+			return nil, fmt.Errorf("no response from %s", node)
+		}
+		var resp stateFetchResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, err
+		}
+		data = append(data, resp.Data...)
+		chunks = resp.Chunks
+	}
+	return data, nil
+}
+
+// handleNotify pulls an announced document if it is newer than the local one.
+func (s *Store) handleNotify(ctx context.Context, sender string, payload json.RawMessage) error {
+	var notify stateNotify
+	if err := json.Unmarshal(payload, &notify); err != nil {
+		return err
+	}
+	if sender == s.agent.Serf.LocalMember().Name {
+		return nil
+	}
+	s.mu.RLock()
+	current, ok := s.docs[notify.Key]
+	s.mu.RUnlock()
+	if ok && current.Version >= notify.Version {
+		return nil
+	}
+	// pull outside of the event loop, the queries need it to keep running
+	go func() {
+		if err := s.pullDocument(sender, notify.Key); err != nil {
+			log.Printf("[WARN] Failed to pull document %s from %s: %v", notify.Key, sender, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Store) handleDigest(ctx context.Context, query *serf.Query) ([]byte, error) {
+	return []byte(s.digest()), nil
+}
+
+func (s *Store) handleFetch(ctx context.Context, query *serf.Query) ([]byte, error) {
+	var req stateFetchRequest
+	if err := json.Unmarshal(query.Payload, &req); err != nil {
+		return nil, err
+	}
+	var data []byte
+	var err error
+	switch req.Resource {
+	case "index":
+		data, err = json.Marshal(s.index())
+	case "doc":
+		s.mu.RLock()
+		doc, ok := s.docs[req.Key]
+		s.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, req.Key)
+		}
+		data, err = json.Marshal(doc)
+	default:
+		return nil, fmt.Errorf("unknown resource %s", req.Resource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(chunk(data, req.Chunk))
+}
+
+// chunk returns the n-th chunk of data and the total number of chunks.
+func chunk(data []byte, n int) stateFetchResponse {
+	chunks := (len(data) + stateChunkSize - 1) / stateChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	start := n * stateChunkSize
+	if start > len(data) {
+		start = len(data)
+	}
+	end := start + stateChunkSize
+	if end > len(data) {
+		end = len(data)
+	}
+	return stateFetchResponse{Data: data[start:end], Chunks: chunks}
+}
+
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state: %v", err)
+	}
+	var docs []*Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return fmt.Errorf("invalid state file %s: %v", s.path, err)
+	}
+	for _, doc := range docs {
+		s.docs[doc.Key] = doc
+	}
+	return nil
+}
+
+// save writes all documents to the state file. The caller must hold the lock.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	docs := make([]*Document, 0, len(s.docs))
+	for _, doc := range s.docs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Key < docs[j].Key })
+	data, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
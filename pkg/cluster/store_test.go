@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	tags := map[string]string{"role": "ap"}
+	assert.True(t, Selector{}.Matches("node-1", tags))
+	assert.True(t, Selector{Nodes: []string{"node-1"}}.Matches("node-1", tags))
+	assert.False(t, Selector{Nodes: []string{"node-2"}}.Matches("node-1", tags))
+	assert.True(t, Selector{Tags: map[string]string{"role": "ap"}}.Matches("node-1", tags))
+	assert.False(t, Selector{Tags: map[string]string{"role": "sta"}}.Matches("node-1", tags))
+}
+
+func TestDocumentNewer(t *testing.T) {
+	doc := &Document{Version: 2, UpdatedBy: "node-a"}
+	assert.True(t, doc.newer(nil))
+	assert.True(t, doc.newer(&Document{Version: 1, UpdatedBy: "node-z"}))
+	assert.False(t, doc.newer(&Document{Version: 3, UpdatedBy: "node-a"}))
+	assert.True(t, (&Document{Version: 2, UpdatedBy: "node-b"}).newer(doc))
+	assert.False(t, doc.newer(doc))
+}
+
+func TestChunk(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), stateChunkSize*2+10)
+	var joined []byte
+	first := chunk(data, 0)
+	assert.Equal(t, 3, first.Chunks)
+	for i := 0; i < first.Chunks; i++ {
+		joined = append(joined, chunk(data, i).Data...)
+	}
+	assert.Equal(t, data, joined)
+	assert.Equal(t, 1, chunk(nil, 0).Chunks)
+}
+
+func TestRenderHostname(t *testing.T) {
+	node := &Node{Name: "node-1", Tags: map[string]string{"site": "lab"}}
+	name, err := renderHostname("rpi-{{.Tags.site}}-{{.Name}}", node)
+	assert.NoError(t, err)
+	assert.Equal(t, "rpi-lab-node-1", name)
+	_, err = renderHostname("{{.Missing}}", node)
+	assert.Error(t, err)
+}
+
+func TestMergeRejectsInvalidDocuments(t *testing.T) {
+	s := &Store{docs: make(map[string]*Document), kinds: make(map[string]Kind)}
+	for _, kind := range DefaultKinds() {
+		s.RegisterKind(kind)
+	}
+	for _, doc := range []*Document{
+		{Key: "motd", Kind: "shell", Version: 1, Value: json.RawMessage(`{"cmd": "reboot"}`)},
+		{Key: "motd", Kind: KindFile, Version: 1, Value: json.RawMessage(`{"path": "/etc/motd"}`)},
+		{Key: "", Kind: KindHostname, Version: 1, Value: json.RawMessage(`{"template": "rpi"}`)},
+	} {
+		assert.Error(t, s.merge(doc), doc.Kind)
+	}
+	assert.Empty(t, s.docs)
+}
+
+func TestInternalEvents(t *testing.T) {
+	a := &Agent{Events: DefaultEventRegistry(system.NewPower())}
+	a.Events.MustRegister(EventType{Name: stateNotifyEvent, Internal: true, Handler: printHostname})
+	assert.ErrorIs(t, a.Event(ClusterEvent{Name: stateNotifyEvent}), ErrUnknownEvent)
+	for _, event := range a.Events.List() {
+		assert.NotEqual(t, stateNotifyEvent, event.Name)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	s := &Store{docs: make(map[string]*Document), kinds: make(map[string]Kind)}
+	for _, kind := range DefaultKinds() {
+		s.RegisterKind(kind)
+	}
+	file := &Document{Key: "motd", Kind: KindFile, Value: json.RawMessage(`{"path":"/etc/motd","content":"aGk="}`)}
+	redacted := s.Redact(file)
+	assert.JSONEq(t, `{"path":"/etc/motd"}`, string(redacted.Value))
+	assert.JSONEq(t, `{"path":"/etc/motd","content":"aGk="}`, string(file.Value), "the stored document is not modified")
+
+	hostname := &Document{Key: "hostname", Kind: KindHostname, Value: json.RawMessage(`{"template":"rpi"}`)}
+	assert.Same(t, hostname, s.Redact(hostname))
+}
@@ -1,7 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v3"
@@ -15,8 +23,159 @@ type Config struct {
 }
 
 type RcondConfig struct {
-	Addr     string `yaml:"addr" envconfig:"RCOND_ADDR"`
-	ApiToken string `yaml:"api_token" envconfig:"RCOND_API_TOKEN"`
+	Addr      string          `yaml:"addr" envconfig:"RCOND_ADDR"`
+	ApiToken  string          `yaml:"api_token" envconfig:"RCOND_API_TOKEN"`
+	Tokens    []TokenConfig   `yaml:"tokens"`
+	TokenFile string          `yaml:"token_file" envconfig:"RCOND_TOKEN_FILE"`
+	TLS       TLSConfig       `yaml:"tls"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	Audit     AuditConfig     `yaml:"audit"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Socket    SocketConfig    `yaml:"socket"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Health    HealthConfig    `yaml:"health"`
+	Units     UnitsConfig     `yaml:"units"`
+	Logs      LogsConfig      `yaml:"logs"`
+	// ValidateResponses checks responses against the OpenAPI spec and logs mismatches.
+	ValidateResponses bool `yaml:"validate_responses" envconfig:"RCOND_VALIDATE_RESPONSES"`
+}
+
+// MetricsConfig configures the Prometheus metrics endpoint.
+// Public serves /metrics without authentication, otherwise the metrics:read scope is required.
+type MetricsConfig struct {
+	Public bool `yaml:"public" envconfig:"RCOND_METRICS_PUBLIC"`
+}
+
+// LogsConfig limits the output of /system/logs. Queries return at most MaxLines entries
+// with MaxBytes of messages, follow streams are closed after MaxFollow. Zero values select the defaults.
+type LogsConfig struct {
+	MaxLines  int           `yaml:"max_lines" envconfig:"RCOND_LOGS_MAX_LINES"`
+	MaxBytes  int           `yaml:"max_bytes" envconfig:"RCOND_LOGS_MAX_BYTES"`
+	MaxFollow time.Duration `yaml:"max_follow" envconfig:"RCOND_LOGS_MAX_FOLLOW"`
+}
+
+// UnitsConfig is the allowlist of the systemd units API clients can read and control.
+// Entries are unit names or glob patterns like rcond-*.service, names without a type are services.
+type UnitsConfig struct {
+	Allow []string `yaml:"allow" envconfig:"RCOND_UNITS_ALLOW"`
+}
+
+// HealthConfig configures the disk checks of /health and the disks reported by /system/info.
+// The health is degraded if a disk in DiskPaths has less than DiskWarnPercent free space
+// and unhealthy below DiskCriticalPercent. Zero values select the defaults.
+type HealthConfig struct {
+	DiskPaths           []string `yaml:"disk_paths" envconfig:"RCOND_HEALTH_DISK_PATHS"`
+	DiskWarnPercent     float64  `yaml:"disk_warn_percent" envconfig:"RCOND_HEALTH_DISK_WARN_PERCENT"`
+	DiskCriticalPercent float64  `yaml:"disk_critical_percent" envconfig:"RCOND_HEALTH_DISK_CRITICAL_PERCENT"`
+}
+
+// JobsConfig configures the jobs of long running operations.
+// Jobs are persisted to File, if set, and the MaxFinished most recently finished jobs are kept.
+type JobsConfig struct {
+	File        string `yaml:"file" envconfig:"RCOND_JOBS_FILE"`
+	MaxFinished int    `yaml:"max_finished" envconfig:"RCOND_JOBS_MAX_FINISHED"`
+}
+
+// SocketConfig configures an additional Unix socket listener for local clients.
+// Callers are identified by the uid and gid of the connecting process and mapped to scopes in Peers.
+// Mode is the octal file mode of the socket and Group its owning group.
+type SocketConfig struct {
+	Enabled bool               `yaml:"enabled" envconfig:"RCOND_SOCKET_ENABLED"`
+	Path    string             `yaml:"path" envconfig:"RCOND_SOCKET_PATH"`
+	Mode    string             `yaml:"mode" envconfig:"RCOND_SOCKET_MODE"`
+	Group   string             `yaml:"group" envconfig:"RCOND_SOCKET_GROUP"`
+	Peers   []SocketPeerConfig `yaml:"peers"`
+}
+
+// SocketPeerConfig grants scopes to socket clients running as the user or as a member of the group.
+// Users and groups are names or numeric IDs.
+type SocketPeerConfig struct {
+	User   string   `yaml:"user"`
+	Group  string   `yaml:"group"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// RateLimitConfig limits the request rate per client IP and per authenticated client.
+// Independent of Enabled, client IPs are locked out after LockoutThreshold failed
+// authentication attempts and request bodies are limited to MaxBodySize bytes,
+// uploads to /system/file to MaxUploadSize bytes. Zero values select the defaults.
+type RateLimitConfig struct {
+	Enabled            bool          `yaml:"enabled" envconfig:"RCOND_RATE_LIMIT_ENABLED"`
+	IPRate             float64       `yaml:"ip_rate" envconfig:"RCOND_RATE_LIMIT_IP_RATE"`
+	IPBurst            int           `yaml:"ip_burst" envconfig:"RCOND_RATE_LIMIT_IP_BURST"`
+	TokenRate          float64       `yaml:"token_rate" envconfig:"RCOND_RATE_LIMIT_TOKEN_RATE"`
+	TokenBurst         int           `yaml:"token_burst" envconfig:"RCOND_RATE_LIMIT_TOKEN_BURST"`
+	LockoutThreshold   int           `yaml:"lockout_threshold" envconfig:"RCOND_RATE_LIMIT_LOCKOUT_THRESHOLD"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration" envconfig:"RCOND_RATE_LIMIT_LOCKOUT_DURATION"`
+	LockoutMaxDuration time.Duration `yaml:"lockout_max_duration" envconfig:"RCOND_RATE_LIMIT_LOCKOUT_MAX_DURATION"`
+	MaxBodySize        int64         `yaml:"max_body_size" envconfig:"RCOND_RATE_LIMIT_MAX_BODY_SIZE"`
+	MaxUploadSize      int64         `yaml:"max_upload_size" envconfig:"RCOND_RATE_LIMIT_MAX_UPLOAD_SIZE"`
+}
+
+// AuditConfig configures the audit log of mutating API calls.
+// Records are written to a JSON lines file that is rotated at MaxSize megabytes.
+type AuditConfig struct {
+	Enabled    bool   `yaml:"enabled" envconfig:"RCOND_AUDIT_ENABLED"`
+	File       string `yaml:"file" envconfig:"RCOND_AUDIT_FILE"`
+	MaxSize    int    `yaml:"max_size" envconfig:"RCOND_AUDIT_MAX_SIZE"`
+	MaxBackups int    `yaml:"max_backups" envconfig:"RCOND_AUDIT_MAX_BACKUPS"`
+	Journald   bool   `yaml:"journald" envconfig:"RCOND_AUDIT_JOURNALD"`
+}
+
+// JWTConfig configures authentication with JWT bearer tokens from an identity provider.
+// Keys are read from JWKSFile, or fetched from JWKSURL or the issuer's OpenID discovery document
+// and cached in CacheFile, so tokens can be verified while the issuer is unreachable.
+type JWTConfig struct {
+	Enabled         bool             `yaml:"enabled" envconfig:"RCOND_JWT_ENABLED"`
+	Issuer          string           `yaml:"issuer" envconfig:"RCOND_JWT_ISSUER"`
+	Audience        string           `yaml:"audience" envconfig:"RCOND_JWT_AUDIENCE"`
+	JWKSFile        string           `yaml:"jwks_file" envconfig:"RCOND_JWT_JWKS_FILE"`
+	JWKSURL         string           `yaml:"jwks_url" envconfig:"RCOND_JWT_JWKS_URL"`
+	CacheFile       string           `yaml:"cache_file" envconfig:"RCOND_JWT_CACHE_FILE"`
+	RefreshInterval time.Duration    `yaml:"refresh_interval" envconfig:"RCOND_JWT_REFRESH_INTERVAL"`
+	NameClaim       string           `yaml:"name_claim" envconfig:"RCOND_JWT_NAME_CLAIM"`
+	ScopeClaim      string           `yaml:"scope_claim" envconfig:"RCOND_JWT_SCOPE_CLAIM"`
+	Claims          []JWTClaimConfig `yaml:"claims"`
+}
+
+// JWTClaimConfig grants scopes to tokens whose claim contains the value.
+type JWTClaimConfig struct {
+	Claim  string   `yaml:"claim"`
+	Value  string   `yaml:"value"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// TLSConfig configures HTTPS for the API server.
+// If the certificate and key files do not exist, a self-signed certificate is generated.
+// With a client CA, clients can authenticate with a certificate that is mapped to scopes in Clients.
+// CAFile verifies the certificates of other nodes, like during the health checks of a rolling restart.
+// InsecureSkipVerify disables that verification.
+type TLSConfig struct {
+	Enabled            bool              `yaml:"enabled" envconfig:"RCOND_TLS_ENABLED"`
+	CertFile           string            `yaml:"cert_file" envconfig:"RCOND_TLS_CERT_FILE"`
+	KeyFile            string            `yaml:"key_file" envconfig:"RCOND_TLS_KEY_FILE"`
+	ClientCAFile       string            `yaml:"client_ca_file" envconfig:"RCOND_TLS_CLIENT_CA_FILE"`
+	RequireClientCert  bool              `yaml:"require_client_cert" envconfig:"RCOND_TLS_REQUIRE_CLIENT_CERT"`
+	Clients            []TLSClientConfig `yaml:"clients"`
+	ReloadInterval     time.Duration     `yaml:"reload_interval" envconfig:"RCOND_TLS_RELOAD_INTERVAL"`
+	CAFile             string            `yaml:"ca_file" envconfig:"RCOND_TLS_CA_FILE"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify" envconfig:"RCOND_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// TLSClientConfig maps the identity of a client certificate to scopes.
+// The name is matched against the common name, DNS names and email addresses of the certificate.
+type TLSClientConfig struct {
+	Name   string   `yaml:"name"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// TokenConfig is a named API token with the scopes it grants.
+// Only the SHA-256 hash of the token is stored, formatted as "sha256:<hex>".
+type TokenConfig struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"`
+	Scopes []string `yaml:"scopes"`
 }
 
 type NetworkConfig struct {
@@ -39,15 +198,44 @@ type ConnectionConfig struct {
 }
 
 type ClusterConfig struct {
-	Enabled       bool     `yaml:"enabled" envconfig:"CLUSTER_ENABLED"`
-	NodeName      string   `yaml:"node_name" envconfig:"CLUSTER_NODE_NAME"`
-	SecretKey     string   `yaml:"secret_key" envconfig:"CLUSTER_SECRET_KEY"`
-	Join          []string `yaml:"join" envconfig:"CLUSTER_JOIN"`
-	AdvertiseAddr string   `yaml:"advertise_addr" envconfig:"CLUSTER_ADVERTISE_ADDR"`
-	AdvertisePort int      `yaml:"advertise_port" envconfig:"CLUSTER_ADVERTISE_PORT"`
-	BindAddr      string   `yaml:"bind_addr" envconfig:"CLUSTER_BIND_ADDR"`
-	BindPort      int      `yaml:"bind_port" envconfig:"CLUSTER_BIND_PORT"`
-	LogLevel      string   `yaml:"log_level" envconfig:"CLUSTER_LOG_LEVEL"`
+	Enabled              bool              `yaml:"enabled" envconfig:"CLUSTER_ENABLED"`
+	NodeName             string            `yaml:"node_name" envconfig:"CLUSTER_NODE_NAME"`
+	SecretKey            string            `yaml:"secret_key" envconfig:"CLUSTER_SECRET_KEY"`
+	Join                 []string          `yaml:"join" envconfig:"CLUSTER_JOIN"`
+	AdvertiseAddr        string            `yaml:"advertise_addr" envconfig:"CLUSTER_ADVERTISE_ADDR"`
+	AdvertisePort        int               `yaml:"advertise_port" envconfig:"CLUSTER_ADVERTISE_PORT"`
+	BindAddr             string            `yaml:"bind_addr" envconfig:"CLUSTER_BIND_ADDR"`
+	BindPort             int               `yaml:"bind_port" envconfig:"CLUSTER_BIND_PORT"`
+	LogLevel             string            `yaml:"log_level" envconfig:"CLUSTER_LOG_LEVEL"`
+	DataDir              string            `yaml:"data_dir" envconfig:"CLUSTER_DATA_DIR"`
+	HistorySize          int               `yaml:"history_size" envconfig:"CLUSTER_HISTORY_SIZE"`
+	DisableCoordinates   bool              `yaml:"disable_coordinates" envconfig:"CLUSTER_DISABLE_COORDINATES"`
+	RejoinAfterLeave     bool              `yaml:"rejoin_after_leave" envconfig:"CLUSTER_REJOIN_AFTER_LEAVE"`
+	RetryJoinInterval    time.Duration     `yaml:"retry_join_interval" envconfig:"CLUSTER_RETRY_JOIN_INTERVAL"`
+	RetryJoinMaxInterval time.Duration     `yaml:"retry_join_max_interval" envconfig:"CLUSTER_RETRY_JOIN_MAX_INTERVAL"`
+	RetryJoinMax         int               `yaml:"retry_join_max" envconfig:"CLUSTER_RETRY_JOIN_MAX"`
+	Discover             DiscoverConfig    `yaml:"discover"`
+	Tags                 map[string]string `yaml:"tags" envconfig:"CLUSTER_TAGS"`
+	StateSyncInterval    time.Duration     `yaml:"state_sync_interval" envconfig:"CLUSTER_STATE_SYNC_INTERVAL"`
+}
+
+type DiscoverConfig struct {
+	Interval time.Duration `yaml:"interval" envconfig:"CLUSTER_DISCOVER_INTERVAL"`
+	MDNS     MDNSConfig    `yaml:"mdns"`
+	DNS      DNSConfig     `yaml:"dns"`
+}
+
+type MDNSConfig struct {
+	Enabled   bool   `yaml:"enabled" envconfig:"CLUSTER_DISCOVER_MDNS_ENABLED"`
+	Service   string `yaml:"service" envconfig:"CLUSTER_DISCOVER_MDNS_SERVICE"`
+	Domain    string `yaml:"domain" envconfig:"CLUSTER_DISCOVER_MDNS_DOMAIN"`
+	Interface string `yaml:"interface" envconfig:"CLUSTER_DISCOVER_MDNS_INTERFACE"`
+}
+
+type DNSConfig struct {
+	Enabled bool     `yaml:"enabled" envconfig:"CLUSTER_DISCOVER_DNS_ENABLED"`
+	Names   []string `yaml:"names" envconfig:"CLUSTER_DISCOVER_DNS_NAMES"`
+	Port    int      `yaml:"port" envconfig:"CLUSTER_DISCOVER_DNS_PORT"`
 }
 
 // LoadConfig reads the configuration from a YAML file and environment variables.
@@ -68,9 +256,102 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// Validate checks the configuration for values that would fail at runtime.
+func (c *Config) Validate() error {
+	if err := c.Rcond.Validate(); err != nil {
+		return err
+	}
+	return c.Cluster.Validate()
+}
+
+// Validate checks the API server configuration.
+// Token names must be unique and every token needs a SHA-256 hash.
+func (c *RcondConfig) Validate() error {
+	names := map[string]bool{}
+	for _, token := range c.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("token name is required")
+		}
+		if names[token.Name] {
+			return fmt.Errorf("duplicate token name %s", token.Name)
+		}
+		names[token.Name] = true
+		hash := strings.TrimPrefix(token.Hash, "sha256:")
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size || hash == token.Hash {
+			return fmt.Errorf("token %s: hash must be formatted as sha256:<hex>", token.Name)
+		}
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("tls require_client_cert needs a client_ca_file")
+	}
+	if c.JWT.Enabled && (c.JWT.Issuer == "" || c.JWT.Audience == "") {
+		return fmt.Errorf("jwt needs an issuer and an audience")
+	}
+	if c.Socket.Mode != "" {
+		if _, err := strconv.ParseUint(c.Socket.Mode, 8, 32); err != nil {
+			return fmt.Errorf("socket mode must be an octal file mode like 0660")
+		}
+	}
+	for _, peer := range c.Socket.Peers {
+		if (peer.User == "") == (peer.Group == "") {
+			return fmt.Errorf("socket peers need either a user or a group")
+		}
+	}
+	if h := c.Health; h.DiskWarnPercent < 0 || h.DiskWarnPercent > 100 || h.DiskCriticalPercent < 0 || h.DiskCriticalPercent > 100 {
+		return fmt.Errorf("health disk percents must be between 0 and 100")
+	}
+	for _, unit := range c.Units.Allow {
+		if _, err := path.Match(unit, ""); err != nil || unit == "" {
+			return fmt.Errorf("units allow entry %q is not a valid unit name or pattern", unit)
+		}
+	}
+	if c.Logs.MaxLines < 0 || c.Logs.MaxBytes < 0 || c.Logs.MaxFollow < 0 {
+		return fmt.Errorf("logs limits must not be negative")
+	}
+	rl := c.RateLimit
+	if rl.IPRate < 0 || rl.TokenRate < 0 || rl.IPBurst < 0 || rl.TokenBurst < 0 || rl.LockoutThreshold < 0 {
+		return fmt.Errorf("rate_limit rates, bursts and lockout_threshold must not be negative")
+	}
+	if rl.LockoutDuration < 0 || rl.LockoutMaxDuration < 0 || rl.MaxBodySize < 0 || rl.MaxUploadSize < 0 {
+		return fmt.Errorf("rate_limit durations and sizes must not be negative")
+	}
+	return nil
+}
+
+// Validate checks the cluster configuration.
+// The secret key must select AES-128, AES-192 or AES-256.
+func (c *ClusterConfig) Validate() error {
+	_, _, err := c.SecretKeyBytes()
+	return err
+}
+
+// SecretKeyBytes returns the decoded secret key, nil if none is set.
+// The key is base64 encoded like the output of serf keygen and the keys of the keyring API.
+// Keys that are not valid base64 keys are used as raw key bytes for compatibility, raw is true for them.
+func (c *ClusterConfig) SecretKeyBytes() (key []byte, raw bool, err error) {
+	if c.SecretKey == "" {
+		return nil, false, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(c.SecretKey); err == nil && validKeySize(len(decoded)) {
+		return decoded, false, nil
+	}
+	if validKeySize(len(c.SecretKey)) {
+		return []byte(c.SecretKey), true, nil
+	}
+	return nil, false, fmt.Errorf("cluster secret_key must be a base64 encoded 16, 24 or 32 byte key")
+}
+
+func validKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
 func SaveConfig(path string, config *Config) error {
 	yamlFile, err := yaml.Marshal(config)
 	if err != nil {
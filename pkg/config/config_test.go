@@ -0,0 +1,58 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterConfigValidate(t *testing.T) {
+	assert.NoError(t, (&ClusterConfig{}).Validate())
+	assert.NoError(t, (&ClusterConfig{SecretKey: "T9jncgl9mbLus+baTTa7q7nPSUrXwbDi2dhbtqir37s="}).Validate())
+	assert.NoError(t, (&ClusterConfig{SecretKey: "0123456789abcdef"}).Validate())
+	assert.Error(t, (&ClusterConfig{SecretKey: "tooshort"}).Validate())
+	assert.Error(t, (&ClusterConfig{SecretKey: "c2hvcnQ="}).Validate())
+}
+
+func TestSecretKeyBytes(t *testing.T) {
+	key, raw, err := (&ClusterConfig{SecretKey: "T9jncgl9mbLus+baTTa7q7nPSUrXwbDi2dhbtqir37s="}).SecretKeyBytes()
+	assert.NoError(t, err)
+	assert.False(t, raw)
+	assert.Len(t, key, 32)
+
+	key, raw, err = (&ClusterConfig{SecretKey: "0123456789abcdef"}).SecretKeyBytes()
+	assert.NoError(t, err)
+	assert.True(t, raw, "keys that are not base64 are used as raw bytes")
+	assert.Equal(t, []byte("0123456789abcdef"), key)
+
+	key, _, err = (&ClusterConfig{}).SecretKeyBytes()
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+func TestRcondConfigValidate(t *testing.T) {
+	hash := "sha256:" + strings.Repeat("ab", 32)
+	assert.NoError(t, (&RcondConfig{}).Validate())
+	assert.NoError(t, (&RcondConfig{Tokens: []TokenConfig{{Name: "ci", Hash: hash}}}).Validate())
+	assert.Error(t, (&RcondConfig{Tokens: []TokenConfig{{Hash: hash}}}).Validate())
+	assert.Error(t, (&RcondConfig{Tokens: []TokenConfig{{Name: "ci", Hash: hash}, {Name: "ci", Hash: hash}}}).Validate())
+	assert.Error(t, (&RcondConfig{Tokens: []TokenConfig{{Name: "ci", Hash: strings.Repeat("ab", 32)}}}).Validate())
+	assert.Error(t, (&RcondConfig{Tokens: []TokenConfig{{Name: "ci", Hash: "sha256:abc"}}}).Validate())
+	assert.Error(t, (&RcondConfig{TLS: TLSConfig{RequireClientCert: true}}).Validate())
+	assert.Error(t, (&RcondConfig{JWT: JWTConfig{Enabled: true}}).Validate())
+	assert.Error(t, (&RcondConfig{JWT: JWTConfig{Enabled: true, Issuer: "https://id.example.com"}}).Validate())
+	assert.Error(t, (&RcondConfig{JWT: JWTConfig{Enabled: true, Audience: "rcond", JWKSFile: "/etc/rcond/jwks.json"}}).Validate())
+	assert.NoError(t, (&RcondConfig{JWT: JWTConfig{Enabled: true, Issuer: "https://id.example.com", Audience: "rcond"}}).Validate())
+	assert.NoError(t, (&RcondConfig{RateLimit: RateLimitConfig{Enabled: true, IPRate: 0.5}}).Validate())
+	assert.Error(t, (&RcondConfig{RateLimit: RateLimitConfig{IPRate: -1}}).Validate())
+	assert.Error(t, (&RcondConfig{RateLimit: RateLimitConfig{MaxBodySize: -1}}).Validate())
+	assert.NoError(t, (&RcondConfig{Socket: SocketConfig{Mode: "0660", Peers: []SocketPeerConfig{{User: "root"}}}}).Validate())
+	assert.Error(t, (&RcondConfig{Socket: SocketConfig{Mode: "rw"}}).Validate())
+	assert.Error(t, (&RcondConfig{Socket: SocketConfig{Peers: []SocketPeerConfig{{User: "root", Group: "wheel"}}}}).Validate())
+	assert.NoError(t, (&RcondConfig{Health: HealthConfig{DiskWarnPercent: 20, DiskCriticalPercent: 5}}).Validate())
+	assert.Error(t, (&RcondConfig{Health: HealthConfig{DiskWarnPercent: 120}}).Validate())
+	assert.NoError(t, (&RcondConfig{Units: UnitsConfig{Allow: []string{"nginx", "rcond-*.timer"}}}).Validate())
+	assert.Error(t, (&RcondConfig{Units: UnitsConfig{Allow: []string{"rcond-[.service"}}}).Validate())
+	assert.Error(t, (&RcondConfig{Logs: LogsConfig{MaxLines: -1}}).Validate())
+}
@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/audit"
+	"github.com/gorilla/mux"
+)
+
+// maxAuditBody is the part of a request body that is kept for the audit record.
+const maxAuditBody = 64 * 1024
+
+// defaultAuditLimit is the number of records returned if no limit is requested.
+const defaultAuditLimit = 100
+
+type auditKey struct{}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+// audited writes an audit record for every POST, PUT and DELETE request handled by next.
+// The identity is added to the record by requireScope once the client is authenticated.
+func (s *Server) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.audit == nil || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) {
+			next(w, r)
+			return
+		}
+		start := time.Now()
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+		r.Body = bodyReader{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		record := &audit.Record{
+			Time:     start.UTC(),
+			ClientIP: clientIP(r),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Body:     audit.Sanitize(body),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			record.Route, _ = route.GetPathTemplate()
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, record)))
+
+		record.Status = rec.status
+		record.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		s.audit.Record(*record)
+	}
+}
+
+// setAuditIdentity adds the name of the authenticated client to the audit record of the request.
+func setAuditIdentity(r *http.Request, name string) {
+	if record, ok := r.Context().Value(auditKey{}).(*audit.Record); ok {
+		record.Identity = name
+	}
+}
+
+// clientIP returns the IP address of the client, or the uid of a Unix socket client.
+func clientIP(r *http.Request) string {
+	if cred, ok := peerCred(r); ok {
+		return fmt.Sprintf("unix:%d", cred.Uid)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func HandleAudit(log *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if log == nil {
+			WriteError(w, "audit log is not enabled", http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		filter := audit.Filter{
+			Identity: query.Get("identity"),
+			Method:   query.Get("method"),
+			Route:    query.Get("route"),
+			Limit:    defaultAuditLimit,
+		}
+		var err error
+		if v := query.Get("status"); v != "" {
+			if filter.Status, err = strconv.Atoi(v); err != nil {
+				WriteError(w, "invalid status parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("since"); v != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, "invalid since parameter, expected RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("until"); v != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, "invalid until parameter, expected RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+				WriteError(w, "invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		records, err := log.Query(filter)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(records)
+	}
+}
@@ -2,15 +2,39 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
 	"github.com/0x1d/rcond/pkg/cluster"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/gorilla/mux"
 )
 
-type clusterEventRequest struct {
-	Name    string `json:"name"`
-	Payload string `json:"payload,omitempty"`
+// eventScopes are the scopes required to send cluster events in addition to cluster:admin.
+var eventScopes = map[string]string{
+	"restart":  auth.ScopeSystemPower,
+	"shutdown": auth.ScopeSystemPower,
+}
+
+// stateScopes are the scopes required to write documents of a kind and to read their secrets.
+// Documents of other kinds only require cluster:admin.
+var stateScopes = map[string]string{
+	cluster.KindNetwork:       auth.ScopeNetworkWrite,
+	cluster.KindAuthorizedKey: auth.ScopeUsersWrite,
+	cluster.KindFile:          auth.ScopeFilesWrite,
+	cluster.KindHostname:      auth.ScopeNetworkWrite,
+}
+
+// allowsKind reports whether the client was granted the scope of the document kind.
+func allowsKind(r *http.Request, kind string) bool {
+	scope, ok := stateScopes[kind]
+	return !ok || allows(r, scope)
 }
 
 func ClusterAgentHandler(agent *cluster.Agent, handler func(http.ResponseWriter, *http.Request, *cluster.Agent)) func(http.ResponseWriter, *http.Request) {
@@ -20,9 +44,7 @@ func ClusterAgentHandler(agent *cluster.Agent, handler func(http.ResponseWriter,
 }
 
 func HandleClusterJoin(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
-	var joinRequest struct {
-		Join []string `json:"join"`
-	}
+	var joinRequest api.ClusterJoinRequest
 	err := json.NewDecoder(r.Body).Decode(&joinRequest)
 	if err != nil {
 		WriteError(w, "Invalid request body", http.StatusBadRequest)
@@ -42,7 +64,7 @@ func HandleClusterJoin(w http.ResponseWriter, r *http.Request, agent *cluster.Ag
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"joined": n})
+	json.NewEncoder(w).Encode(api.ClusterJoinResponse{Joined: n})
 }
 
 func HandleClusterLeave(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
@@ -53,7 +75,7 @@ func HandleClusterLeave(w http.ResponseWriter, r *http.Request, agent *cluster.A
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
 }
 
 func HandleClusterMembers(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
@@ -61,7 +83,20 @@ func HandleClusterMembers(w http.ResponseWriter, r *http.Request, agent *cluster
 		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
 		return
 	}
-	members, err := agent.Members()
+	query := r.URL.Query()
+	filter := cluster.MemberFilter{
+		Status: query.Get("status"),
+		Tags:   map[string]string{},
+	}
+	for _, tag := range query["tag"] {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			WriteError(w, "invalid tag parameter, expected key=value", http.StatusBadRequest)
+			return
+		}
+		filter.Tags[key] = value
+	}
+	members, err := agent.Members(filter)
 	if err != nil {
 		WriteError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -71,26 +106,334 @@ func HandleClusterMembers(w http.ResponseWriter, r *http.Request, agent *cluster
 	json.NewEncoder(w).Encode(members)
 }
 
+func HandleClusterMember(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	member, err := agent.Member(name)
+	if errors.Is(err, cluster.ErrMemberNotFound) {
+		WriteError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
 func HandleClusterEvent(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
 	if agent == nil {
 		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
 		return
 	}
-	var req clusterEventRequest
+	var req api.ClusterEventRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if scope, ok := eventScopes[req.Name]; ok && !allows(r, scope) {
+		WriteError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	event := cluster.ClusterEvent{
-		Name: req.Name,
-		Data: []byte(req.Payload),
+		Name:    req.Name,
+		Payload: req.Payload,
 	}
 	err := agent.Event(event)
 	if err != nil {
+		var validationErr *schema.ValidationError
+		if errors.As(err, &validationErr) {
+			writeErr(w, err)
+			return
+		}
+		if errors.Is(err, cluster.ErrUnknownEvent) {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		WriteError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
+}
+
+func HandleClusterEvents(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent.Events.List())
+}
+
+func HandleClusterHistory(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	filter := cluster.HistoryFilter{
+		Type: query.Get("type"),
+		Name: query.Get("name"),
+		Node: query.Get("node"),
+	}
+	var err error
+	if v := query.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			WriteError(w, "invalid since parameter, expected RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			WriteError(w, "invalid until parameter, expected RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			WriteError(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent.History.Query(filter))
+}
+
+func HandleClusterListKeys(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	resp, err := agent.ListKeys()
+	writeKeyResponse(w, resp, err)
+}
+
+func HandleClusterInstallKey(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	var req api.ClusterKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := agent.InstallKey(req.Key, req.Primary)
+	writeKeyResponse(w, resp, err)
+}
+
+func HandleClusterRemoveKey(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	var req api.ClusterKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := agent.RemoveKey(req.Key)
+	writeKeyResponse(w, resp, err)
+}
+
+func writeKeyResponse(w http.ResponseWriter, resp *cluster.KeyResponse, err error) {
+	if errors.Is(err, cluster.ErrInvalidKey) {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func HandleClusterStateList(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	docs := agent.State.List(r.URL.Query().Get("kind"))
+	for i, doc := range docs {
+		if !allowsKind(r, doc.Kind) {
+			docs[i] = agent.State.Redact(doc)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(docs)
+}
+
+func HandleClusterStateGet(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	doc, err := agent.State.Get(mux.Vars(r)["key"])
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+	if !allowsKind(r, doc.Kind) {
+		doc = agent.State.Redact(doc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func HandleClusterStatePut(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	var req api.ClusterStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if !allowsKind(r, req.Kind) || !allowsExisting(r, agent, key) {
+		WriteError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	doc, err := agent.State.Put(key, req.Kind, cluster.Selector(req.Selector), req.Value)
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func HandleClusterStateDelete(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if !allowsExisting(r, agent, key) {
+		WriteError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if _, err := agent.State.Delete(key); err != nil {
+		writeStateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
+}
+
+// allowsExisting reports whether the client was granted the scope of the document stored under the key.
+func allowsExisting(r *http.Request, agent *cluster.Agent, key string) bool {
+	doc, err := agent.State.Get(key)
+	return err != nil || allowsKind(r, doc.Kind)
+}
+
+func writeStateError(w http.ResponseWriter, err error) {
+	var validationErr *schema.ValidationError
+	switch {
+	case errors.Is(err, cluster.ErrDocumentNotFound):
+		WriteError(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &validationErr):
+		writeErr(w, err)
+	case errors.Is(err, cluster.ErrUnknownKind):
+		WriteError(w, err.Error(), http.StatusBadRequest)
+	default:
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func HandleClusterLeader(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+	if agent == nil {
+		WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent.Leader.Info())
+}
+
+// rollingRestartJob is the job type of rolling restarts.
+const rollingRestartJob = "rolling-restart"
+
+func HandleClusterRollingRestart(jobs *job.Manager) func(http.ResponseWriter, *http.Request, *cluster.Agent) {
+	return func(w http.ResponseWriter, r *http.Request, agent *cluster.Agent) {
+		if agent == nil {
+			WriteError(w, "cluster agent is not initialized", http.StatusInternalServerError)
+			return
+		}
+		if !allows(r, auth.ScopeSystemPower) {
+			WriteError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var req cluster.RollingRestartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fn, err := agent.RollingRestart(req)
+		if errors.Is(err, cluster.ErrNotLeader) || errors.Is(err, cluster.ErrRolloutRunning) {
+			WriteError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		j, err := jobs.Run(job.Job{Type: rollingRestartJob, Scope: auth.ScopeClusterAdmin, CreatedBy: identityName(r)}, fn)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", api.Version+"/cluster/rolling-restart/"+j.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j)
+	}
+}
+
+// HandleClusterRollingRestarts lists the rolling restarts the client may access, newest first.
+func HandleClusterRollingRestarts(jobs *job.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+		visible := []job.Job{}
+		for _, j := range jobs.List(rollingRestartJob) {
+			if identity != nil && !jobVisible(identity, j) {
+				continue
+			}
+			visible = append(visible, j)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(visible)
+	}
+}
+
+func HandleClusterRollingRestartStatus(jobs *job.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, err := visibleJob(jobs, r)
+		if err != nil || j.Type != rollingRestartJob {
+			WriteError(w, job.ErrJobNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j)
+	}
 }
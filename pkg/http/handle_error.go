@@ -2,15 +2,92 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/0x1d/rcond/pkg/user"
+	"github.com/0x1d/rcond/pkg/util"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+// ErrorResponse is the body of error responses, see api.ErrorResponse.
+type ErrorResponse = api.ErrorResponse
 
+// WriteError writes an error response with the error code of the status.
 func WriteError(w http.ResponseWriter, message string, code int) {
+	writeErrorResponse(w, code, ErrorResponse{Error: message, Code: errorCode(code)})
+}
+
+// writeErr writes an error of the system packages with the status of its kind:
+// unknown connections, devices, users, keys, units and power actions are not found, changes that conflict
+// with the current state or are blocked by an inhibitor are conflicts, units outside the allowlist are forbidden
+// and an unreachable D-Bus service or journal is unavailable. Other errors are internal server errors.
+func writeErr(w http.ResponseWriter, err error) {
+	var validationErr *schema.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: api.CodeValidationFailed, Errors: fieldErrors(validationErr.Errors)})
+	case errors.Is(err, util.ErrUnavailable):
+		writeErrorResponse(w, http.StatusServiceUnavailable, ErrorResponse{Error: err.Error(), Code: api.CodeDBusUnavailable})
+	case errors.Is(err, system.ErrJournalUnavailable):
+		WriteError(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, network.ErrConnectionNotFound), errors.Is(err, network.ErrDeviceNotFound),
+		errors.Is(err, user.ErrUserNotFound), errors.Is(err, user.ErrKeyNotFound), errors.Is(err, system.ErrUnitNotFound),
+		errors.Is(err, system.ErrPowerActionNotFound):
+		WriteError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, network.ErrConflict), errors.Is(err, user.ErrKeyExists), errors.Is(err, system.ErrActionConflicts),
+		errors.Is(err, system.ErrPowerInhibited):
+		WriteError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, system.ErrUnitNotAllowed):
+		WriteError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, user.ErrInvalidKey), errors.Is(err, system.ErrInvalidUnit), errors.Is(err, system.ErrInvalidAction),
+		errors.Is(err, system.ErrInvalidLogFilter), errors.Is(err, system.ErrInvalidPowerAction):
+		WriteError(w, err.Error(), http.StatusBadRequest)
+	default:
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fieldErrors converts the errors of a failed validation to the wire format of the API.
+func fieldErrors(errs []schema.FieldError) []api.FieldError {
+	fields := make([]api.FieldError, len(errs))
+	for i, err := range errs {
+		fields[i] = api.FieldError(err)
+	}
+	return fields
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, resp ErrorResponse) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// errorCode returns the error code of a status code.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return api.CodeBadRequest
+	case http.StatusUnauthorized:
+		return api.CodeUnauthorized
+	case http.StatusForbidden:
+		return api.CodeForbidden
+	case http.StatusNotFound:
+		return api.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return api.CodeMethodNotAllowed
+	case http.StatusConflict:
+		return api.CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return api.CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return api.CodeRateLimited
+	}
+	if status >= 500 {
+		return api.CodeInternal
+	}
+	return api.CodeBadRequest
 }
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/cluster"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/0x1d/rcond/pkg/util"
+	"github.com/hashicorp/serf/serf"
+)
+
+// Defaults of the disk checks
+const (
+	defaultDiskWarnPercent     = 10
+	defaultDiskCriticalPercent = 2
+)
+
+// healthCacheTTL is how long the result of the health checks is reused,
+// so frequent probes do not query D-Bus on every request.
+const healthCacheTTL = 5 * time.Second
+
+// healthSeverity orders the health statuses, the status of a node is its worst check.
+var healthSeverity = map[string]int{
+	api.HealthHealthy:   0,
+	api.HealthDegraded:  1,
+	api.HealthUnhealthy: 2,
+}
+
+// health checks the services rcond depends on and the disk space of the node.
+type health struct {
+	diskPaths      []string
+	diskWarn       float64
+	diskCritical   float64
+	clusterEnabled bool
+
+	mu        sync.Mutex
+	cached    api.HealthResponse
+	checkedAt time.Time
+}
+
+func newHealth(cfg *config.Config) *health {
+	h := &health{
+		diskPaths:      cfg.Rcond.Health.DiskPaths,
+		diskWarn:       cfg.Rcond.Health.DiskWarnPercent,
+		diskCritical:   cfg.Rcond.Health.DiskCriticalPercent,
+		clusterEnabled: cfg.Cluster.Enabled,
+	}
+	if len(h.diskPaths) == 0 {
+		h.diskPaths = []string{"/"}
+	}
+	if h.diskWarn == 0 {
+		h.diskWarn = defaultDiskWarnPercent
+	}
+	if h.diskCritical == 0 {
+		h.diskCritical = defaultDiskCriticalPercent
+	}
+	return h
+}
+
+// check returns the result of the health checks, which are run at most once per healthCacheTTL.
+// The cluster is only checked if it is enabled or an agent is running.
+func (h *health) check(agent *cluster.Agent) api.HealthResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.checkedAt.IsZero() && time.Since(h.checkedAt) < healthCacheTTL {
+		return h.cached
+	}
+	checks := []api.HealthCheck{checkDBus(), checkNetworkManager()}
+	if h.clusterEnabled || agent != nil {
+		checks = append(checks, checkCluster(agent))
+	}
+	for _, path := range h.diskPaths {
+		checks = append(checks, h.checkDisk(path))
+	}
+	resp := api.HealthResponse{Status: api.HealthHealthy, Checks: checks}
+	for _, c := range checks {
+		if healthSeverity[c.Status] > healthSeverity[resp.Status] {
+			resp.Status = c.Status
+		}
+	}
+	h.cached, h.checkedAt = resp, time.Now()
+	return resp
+}
+
+// checkDBus checks that the system bus is reachable, rcond can not manage the node without it.
+func checkDBus() api.HealthCheck {
+	c := api.HealthCheck{Name: "dbus", Status: api.HealthHealthy}
+	if err := util.Ping(); err != nil {
+		c.Status = api.HealthUnhealthy
+		c.Reason = fmt.Sprintf("system bus is unreachable: %v", err)
+	}
+	return c
+}
+
+// checkNetworkManager checks that NetworkManager is running and networking is enabled.
+func checkNetworkManager() api.HealthCheck {
+	c := api.HealthCheck{Name: "networkmanager", Status: api.HealthHealthy}
+	state, err := network.State()
+	switch {
+	case errors.Is(err, util.ErrUnavailable):
+		c.Status = api.HealthDegraded
+		c.Reason = "NetworkManager is not running"
+	case err != nil:
+		c.Status = api.HealthDegraded
+		c.Reason = fmt.Sprintf("failed to query NetworkManager: %v", err)
+	case state == "asleep":
+		c.Status = api.HealthDegraded
+		c.Reason = "networking is disabled"
+	}
+	return c
+}
+
+// checkCluster checks that the cluster agent is running and a member of the cluster.
+func checkCluster(agent *cluster.Agent) api.HealthCheck {
+	c := api.HealthCheck{Name: "cluster", Status: api.HealthHealthy}
+	if agent == nil {
+		c.Status = api.HealthDegraded
+		c.Reason = "cluster agent is not running"
+	} else if state := agent.Serf.State(); state != serf.SerfAlive {
+		c.Status = api.HealthDegraded
+		c.Reason = fmt.Sprintf("cluster agent is %s", state)
+	}
+	return c
+}
+
+// checkDisk checks the free space of the file system mounted at path.
+func (h *health) checkDisk(path string) api.HealthCheck {
+	c := api.HealthCheck{Name: "disk:" + path, Status: api.HealthHealthy}
+	disk, err := system.DiskUsage(path)
+	if err != nil {
+		c.Status = api.HealthDegraded
+		c.Reason = err.Error()
+		return c
+	}
+	free := 100 - disk.UsedPercent
+	switch {
+	case free < h.diskCritical:
+		c.Status = api.HealthUnhealthy
+	case free < h.diskWarn:
+		c.Status = api.HealthDegraded
+	default:
+		return c
+	}
+	c.Reason = fmt.Sprintf("%.1f%% free space left", free)
+	return c
+}
+
+// healthHandler reports the health of the node.
+// Degraded nodes respond with 200, so they are still considered up, unhealthy nodes with 503.
+// The endpoint requires no authentication, the checks are only returned to clients granted system:read.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	resp := s.health.check(s.clusterAgent)
+	if identity := s.optionalIdentity(r); identity == nil || !identity.Allows(auth.ScopeSystemRead) {
+		resp = api.HealthResponse{Status: resp.Status}
+	}
+	status := http.StatusOK
+	if resp.Status == api.HealthUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// optionalIdentity authenticates clients that sent credentials to an endpoint without authentication.
+// Clients without credentials, or with invalid ones, are anonymous. Failed tokens are rate limited like in requireScope.
+func (s *Server) optionalIdentity(r *http.Request) *auth.Identity {
+	_, peer := peerCred(r)
+	hasSecret := r.Header.Get("X-API-Token") != "" || r.Header.Get("Authorization") != ""
+	if !hasSecret && !peer && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return nil
+	}
+	ip := clientIP(r)
+	if locked, _ := s.limits.lockout.Locked(ip); locked || s.limits.failedAuth.Wait(ip) > 0 {
+		return nil
+	}
+	identity, err := s.authenticate(r)
+	if err != nil {
+		if hasSecret {
+			s.limits.failedAuth.Allow(ip)
+			if d := s.limits.lockout.Failure(ip); d > 0 {
+				log.Printf("[WARN] Locked out %s for %s after failed authentication attempts", ip, d)
+			}
+		}
+		return nil
+	}
+	return identity
+}
+
+// systemInfoHandler returns the information about the host and rcond, with the usage of the checked disks.
+func (s *Server) systemInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(system.GetInfo(s.health.diskPaths))
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDisk(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		warn     float64
+		critical float64
+		status   string
+	}{
+		{"healthy", 0.001, 0.0001, api.HealthHealthy},
+		{"degraded", 100.1, 0.0001, api.HealthDegraded},
+		{"unhealthy", 100.1, 100.1, api.HealthUnhealthy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health{diskWarn: tt.warn, diskCritical: tt.critical}
+			c := h.checkDisk(dir)
+			assert.Equal(t, "disk:"+dir, c.Name)
+			assert.Equal(t, tt.status, c.Status)
+			assert.Equal(t, tt.status == api.HealthHealthy, c.Reason == "")
+		})
+	}
+
+	c := (&health{}).checkDisk(dir + "/missing")
+	assert.Equal(t, api.HealthDegraded, c.Status)
+	assert.NotEmpty(t, c.Reason)
+}
+
+func TestHealth(t *testing.T) {
+	cfg := &config.Config{
+		Rcond:   config.RcondConfig{Addr: "127.0.0.1:0", ApiToken: "secret", Health: config.HealthConfig{DiskPaths: []string{t.TempDir()}, DiskWarnPercent: 100.1}},
+		Cluster: config.ClusterConfig{Enabled: true},
+	}
+	s := NewServer(cfg)
+	s.RegisterRoutes()
+
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeNetworkRead})
+	require.NoError(t, err)
+
+	// anonymous clients and clients without system:read only get the status
+	for _, token := range []string{"", reader, "invalid"} {
+		rec := serve("/health", token)
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fields))
+		assert.Len(t, fields, 1, token)
+		assert.Contains(t, fields, "status", token)
+	}
+
+	rec := serve("/health", "secret")
+	var resp api.HealthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	checks := map[string]api.HealthCheck{}
+	for _, c := range resp.Checks {
+		checks[c.Name] = c
+	}
+	assert.Contains(t, checks, "dbus")
+	assert.Contains(t, checks, "networkmanager")
+	assert.Equal(t, api.HealthCheck{Name: "cluster", Status: api.HealthDegraded, Reason: "cluster agent is not running"}, checks["cluster"])
+	assert.Equal(t, api.HealthDegraded, checks["disk:"+cfg.Rcond.Health.DiskPaths[0]].Status)
+	assert.NotEqual(t, api.HealthHealthy, resp.Status)
+	if resp.Status == api.HealthUnhealthy {
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	} else {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// the versioned route returns the checks of an unhealthy node next to the error
+	rec = serve("/v1/health", "")
+	var env api.Envelope
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &env))
+	require.NotEmpty(t, env.Data)
+	assert.Equal(t, rec.Code == http.StatusServiceUnavailable, env.Error != nil)
+}
+
+func TestSystemInfo(t *testing.T) {
+	s := newTestServer(t)
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeNetworkRead})
+	require.NoError(t, err)
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/system/info", nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(reader).Code)
+	rec := serve("secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var info system.Info
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.NotEmpty(t, info.Arch)
+	assert.NotEmpty(t, info.Rcond.Version)
+	require.Len(t, info.Disks, 1)
+	assert.Equal(t, "/", info.Disks[0].Path)
+}
+
+func TestHealthCache(t *testing.T) {
+	h := &health{diskPaths: []string{t.TempDir()}, diskWarn: 0.001, diskCritical: 0.0001}
+	first := h.check(nil)
+	h.diskWarn = 100.1
+	assert.Equal(t, first, h.check(nil), "the result is reused within the cache TTL")
+
+	h.checkedAt = time.Now().Add(-healthCacheTTL)
+	checks := map[string]string{}
+	for _, c := range h.check(nil).Checks {
+		checks[c.Name] = c.Status
+	}
+	assert.Equal(t, api.HealthDegraded, checks["disk:"+h.diskPaths[0]])
+}
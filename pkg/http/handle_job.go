@@ -0,0 +1,194 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/gorilla/mux"
+)
+
+// Job types of the operations that can run asynchronously.
+const (
+	networkSTAJob     = "network-sta"
+	networkAPJob      = "network-ap"
+	networkUpJob      = "network-up"
+	networkDownJob    = "network-down"
+	systemRestartJob  = "system-restart"
+	systemShutdownJob = "system-shutdown"
+	clusterJoinJob    = "cluster-join"
+)
+
+// asyncable runs the handler as a job if the request has the query parameter async=true
+// and responds with 202 Accepted and the job. The response of the handler is stored as
+// the api.JobResult of the job, error responses fail the job.
+// The job is canceled by canceling the context of the request passed to the handler.
+func (s *Server) asyncable(kind, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+		if !async {
+			next(w, r)
+			return
+		}
+		// The body is read before responding, the server closes it once the handler returned.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		j, err := s.jobs.Run(job.Job{Type: kind, Scope: scope, CreatedBy: identityName(r)}, func(ctx context.Context, report job.ReportFunc) (interface{}, error) {
+			report(job.Progress{Total: 1, Message: r.Method + " " + r.URL.Path}, nil)
+			reqCtx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+			defer cancel()
+			stop := context.AfterFunc(ctx, cancel)
+			defer stop()
+
+			req := r.WithContext(reqCtx)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			rec := &jobRecorder{header: make(http.Header), status: http.StatusOK}
+			next(rec, req)
+			report(job.Progress{Done: 1, Total: 1}, nil)
+			return rec.result()
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", api.Version+"/jobs/"+j.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j)
+	}
+}
+
+// identityName returns the name of the authenticated client of the request.
+func identityName(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return identity.Name
+	}
+	return ""
+}
+
+// allows reports whether the client of the request was granted the scope.
+func allows(r *http.Request, scope string) bool {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	return ok && identity.Allows(scope)
+}
+
+// jobRecorder captures the response of a handler that runs as a job.
+type jobRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *jobRecorder) Header() http.Header { return r.header }
+
+func (r *jobRecorder) WriteHeader(code int) { r.status = code }
+
+func (r *jobRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+
+// result returns the recorded response and the error message of an error response.
+func (r *jobRecorder) result() (*api.JobResult, error) {
+	result := &api.JobResult{Status: r.status}
+	body := bytes.TrimSpace(r.body.Bytes())
+	if json.Valid(body) {
+		result.Body = json.RawMessage(body)
+	}
+	if r.status < 400 {
+		return result, nil
+	}
+	var resp ErrorResponse
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		return result, errors.New(resp.Error)
+	}
+	return result, fmt.Errorf("request failed with status %d", r.status)
+}
+
+// visibleJob returns the job with the ID from the path if the client may access it:
+// it holds the scope of the operation or created the job.
+func visibleJob(jobs *job.Manager, r *http.Request) (job.Job, error) {
+	j, err := jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		return job.Job{}, err
+	}
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok && !jobVisible(identity, j) {
+		return job.Job{}, job.ErrJobNotFound
+	}
+	return j, nil
+}
+
+func jobVisible(identity *auth.Identity, j job.Job) bool {
+	return j.Scope == "" || identity.Allows(j.Scope) || (j.CreatedBy != "" && j.CreatedBy == identity.Name)
+}
+
+// HandleJobs lists the jobs the client may access, newest first, optionally filtered by type and status.
+func HandleJobs(jobs *job.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+		status := r.URL.Query().Get("status")
+		visible := []job.Job{}
+		for _, j := range jobs.List(r.URL.Query().Get("type")) {
+			if identity != nil && !jobVisible(identity, j) {
+				continue
+			}
+			if status != "" && j.Status != status {
+				continue
+			}
+			visible = append(visible, j)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(visible)
+	}
+}
+
+func HandleJob(jobs *job.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, err := visibleJob(jobs, r)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j)
+	}
+}
+
+// HandleCancelJob cancels a running job. The job is returned with 202 Accepted,
+// it is marked as canceled once the operation stopped.
+func HandleCancelJob(jobs *job.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, err := visibleJob(jobs, r)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		j, err = jobs.Cancel(j.ID)
+		switch {
+		case errors.Is(err, job.ErrJobNotFound):
+			WriteError(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, job.ErrJobFinished):
+			WriteError(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			writeErr(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j)
+	}
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitJob(t *testing.T, jobs *job.Manager, id string) job.Job {
+	t.Helper()
+	var j job.Job
+	require.Eventually(t, func() bool {
+		var err error
+		j, err = jobs.Get(id)
+		require.NoError(t, err)
+		return j.Status != job.StatusRunning
+	}, time.Second, 10*time.Millisecond)
+	return j
+}
+
+func TestAsyncable(t *testing.T) {
+	s := newTestServer(t)
+	h := s.asyncable("test", auth.ScopeNetworkWrite, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if mux.Vars(r)["interface"] != "wlan0" {
+			WriteError(w, "unknown interface", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+	identity := &auth.Identity{Name: "ci", Scopes: []string{auth.ScopeNetworkWrite}}
+	request := func(iface, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/v1/network/interface/"+iface+query, strings.NewReader(`{"uuid":"7d706027"}`))
+		req = mux.SetURLVars(req, map[string]string{"interface": iface})
+		rec := httptest.NewRecorder()
+		h(rec, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+		return rec
+	}
+
+	rec := request("wlan0", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"uuid":"7d706027"}`, rec.Body.String())
+
+	rec = request("wlan0", "?async=true")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var j job.Job
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &j))
+	assert.Equal(t, "/v1/jobs/"+j.ID, rec.Header().Get("Location"))
+	assert.Equal(t, "ci", j.CreatedBy)
+	j = waitJob(t, s.jobs, j.ID)
+	assert.Equal(t, job.StatusSucceeded, j.Status)
+	result := j.Result.(*api.JobResult)
+	assert.Equal(t, http.StatusOK, result.Status)
+	assert.JSONEq(t, `{"uuid":"7d706027"}`, string(result.Body))
+
+	rec = request("eth9", "?async=true")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &j))
+	j = waitJob(t, s.jobs, j.ID)
+	assert.Equal(t, job.StatusFailed, j.Status)
+	assert.Equal(t, "unknown interface", j.Error)
+	assert.Equal(t, http.StatusNotFound, j.Result.(*api.JobResult).Status)
+}
+
+func TestJobEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	running, err := s.jobs.Run(job.Job{Type: "network-up", Scope: auth.ScopeNetworkWrite}, func(ctx context.Context, report job.ReportFunc) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeNetworkRead})
+	require.NoError(t, err)
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/jobs?status=running", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var jobs []job.Job
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, running.ID, jobs[0].ID)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/jobs/"+running.ID, "secret").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/jobs/"+running.ID, reader).Code, "jobs require the scope of the operation")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/jobs/"+running.ID, reader).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/jobs/missing", "secret").Code)
+
+	assert.Equal(t, http.StatusAccepted, serve(http.MethodDelete, "/jobs/"+running.ID, "secret").Code)
+	assert.Equal(t, job.StatusCanceled, waitJob(t, s.jobs, running.ID).Status)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodDelete, "/jobs/"+running.ID, "secret").Code)
+}
+
+func TestRollingRestartVisibility(t *testing.T) {
+	s := newTestServer(t)
+	running, err := s.jobs.Run(job.Job{Type: rollingRestartJob, Scope: auth.ScopeClusterAdmin, CreatedBy: "admin"}, func(ctx context.Context, report job.ReportFunc) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.jobs.Cancel(running.ID) })
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeClusterRead})
+	require.NoError(t, err)
+
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/cluster/rolling-restart", reader)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve("/cluster/rolling-restart/"+running.ID, reader).Code)
+
+	rec = serve("/cluster/rolling-restart", "secret")
+	var jobs []job.Job
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, http.StatusOK, serve("/cluster/rolling-restart/"+running.ID, "secret").Code)
+}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/system"
+)
+
+// Defaults of the logs endpoint
+const (
+	defaultLogLines    = 100
+	defaultMaxLogLines = 1000
+	defaultMaxLogBytes = 1 << 20
+	defaultMaxFollow   = time.Hour
+	// followLines is the number of recent entries sent before following the journal.
+	followLines = 10
+	// logKeepAlive is the interval of comments sent on idle follow streams, so proxies keep them open.
+	logKeepAlive = 30 * time.Second
+)
+
+// logReader reads journal entries like system.ReadLogs.
+type logReader func(ctx context.Context, filter system.LogFilter, follow bool, fn func(system.LogEntry) bool) error
+
+// logLimits caps the output of the logs endpoint.
+type logLimits struct {
+	maxLines  int
+	maxBytes  int
+	maxFollow time.Duration
+}
+
+func newLogLimits(cfg *config.LogsConfig) logLimits {
+	return logLimits{
+		maxLines:  orDefault(cfg.MaxLines, defaultMaxLogLines),
+		maxBytes:  orDefault(cfg.MaxBytes, defaultMaxLogBytes),
+		maxFollow: orDefault(cfg.MaxFollow, defaultMaxFollow),
+	}
+}
+
+// HandleLogs returns the journal entries matching the unit, priority, since, until and cursor parameters.
+// With follow=true, the entries are streamed as server-sent events as they are written.
+func HandleLogs(limits logLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := system.LogFilter{
+			Units:    query["unit"],
+			Priority: query.Get("priority"),
+			Cursor:   query.Get("cursor"),
+		}
+		var err error
+		if v := query.Get("since"); v != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, "invalid since parameter, expected RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("until"); v != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, "invalid until parameter, expected RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 {
+				WriteError(w, "invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		follow := query.Get("follow") == "true"
+		if follow {
+			if id := r.Header.Get("Last-Event-ID"); id != "" {
+				filter.Cursor = id
+			}
+		}
+		if err := filter.Validate(); err != nil {
+			writeErr(w, err)
+			return
+		}
+		if follow {
+			streamLogs(w, r, system.ReadLogs, filter, limits)
+			return
+		}
+
+		resp := api.LogsResponse{Entries: []api.LogEntry{}}
+		if filter.Limit == 0 {
+			filter.Limit = defaultLogLines
+		}
+		if filter.Limit > limits.maxLines {
+			filter.Limit = limits.maxLines
+			resp.Truncated = true
+		}
+		size := 0
+		err = system.ReadLogs(r.Context(), filter, false, func(entry system.LogEntry) bool {
+			size += len(entry.Message)
+			if size > limits.maxBytes {
+				resp.Truncated = true
+				return false
+			}
+			resp.Entries = append(resp.Entries, api.LogEntry(entry))
+			return true
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		if n := len(resp.Entries); n > 0 {
+			resp.Cursor = resp.Entries[n-1].Cursor
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// streamLogs sends the most recent entries, or the entries after the cursor, and then every new entry
+// as server-sent events with the cursor as id, so clients resume with the Last-Event-ID header.
+// Streams are closed after the maximum follow duration, or with a truncated event once the maximum lines
+// or message bytes were sent. The event carries the cursor of the last sent entry to resume from.
+func streamLogs(w http.ResponseWriter, r *http.Request, read logReader, filter system.LogFilter, limits logLimits) {
+	if filter.Cursor == "" && filter.Limit == 0 {
+		filter.Limit = followLines
+	}
+	filter.Limit = min(filter.Limit, limits.maxLines)
+	ctx, cancel := context.WithTimeout(r.Context(), limits.maxFollow)
+	defer cancel()
+	rc := http.NewResponseController(w)
+	// the write timeout of the server would end the stream
+	rc.SetWriteDeadline(time.Now().Add(limits.maxFollow + logKeepAlive))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	entries := make(chan system.LogEntry)
+	done := make(chan error, 1)
+	go func() {
+		done <- read(ctx, filter, true, func(entry system.LogEntry) bool {
+			select {
+			case entries <- entry:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	keepAlive := time.NewTicker(logKeepAlive)
+	defer keepAlive.Stop()
+	lines, size := 0, 0
+	cursor := filter.Cursor
+	truncated := func() {
+		data, _ := json.Marshal(struct {
+			Cursor string `json:"cursor,omitempty"`
+		}{cursor})
+		fmt.Fprintf(w, "event: truncated\ndata: %s\n\n", data)
+		rc.Flush()
+	}
+	for {
+		select {
+		case entry := <-entries:
+			if size += len(entry.Message); size > limits.maxBytes {
+				truncated()
+				return
+			}
+			data, _ := json.Marshal(api.LogEntry(entry))
+			fmt.Fprintf(w, "id: %s\nevent: entry\ndata: %s\n\n", entry.Cursor, data)
+			cursor = entry.Cursor
+			if lines++; lines >= limits.maxLines {
+				rc.Flush()
+				truncated()
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case err := <-done:
+			if err != nil {
+				data, _ := json.Marshal(ErrorResponse{Error: err.Error(), Code: api.CodeInternal})
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				rc.Flush()
+			}
+			return
+		}
+		rc.Flush()
+	}
+}
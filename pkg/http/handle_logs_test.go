@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogsEndpoint(t *testing.T) {
+	s := newTestServer(t)
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeSystemRead})
+	require.NoError(t, err)
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("/v1/system/logs", reader).Code)
+	for _, query := range []string{
+		"unit=nginx*",
+		"priority=loud",
+		"since=yesterday",
+		"until=2026-10-19",
+		"cursor=--all",
+		"limit=0",
+		"limit=ten",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve("/v1/system/logs?"+query, "secret").Code, query)
+	}
+}
+
+func TestLogLimits(t *testing.T) {
+	assert.Equal(t, logLimits{maxLines: defaultMaxLogLines, maxBytes: defaultMaxLogBytes, maxFollow: defaultMaxFollow}, newLogLimits(&config.LogsConfig{}))
+	assert.Equal(t, logLimits{maxLines: 10, maxBytes: 2048, maxFollow: time.Minute}, newLogLimits(&config.LogsConfig{MaxLines: 10, MaxBytes: 2048, MaxFollow: time.Minute}))
+}
+
+func TestStreamLogsLimits(t *testing.T) {
+	// flood reads entries as fast as the stream takes them until the context is done
+	flood := func(ctx context.Context, filter system.LogFilter, follow bool, fn func(system.LogEntry) bool) error {
+		for i := 0; ; i++ {
+			if !fn(system.LogEntry{Cursor: fmt.Sprintf("s=1;i=%x", i), Message: "0123456789"}) {
+				return ctx.Err()
+			}
+		}
+	}
+	stream := func(limits logLimits) []string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/system/logs?follow=true", nil)
+		done := make(chan struct{})
+		go func() {
+			streamLogs(rec, req, flood, system.LogFilter{}, limits)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream did not stop at the limits")
+		}
+		return strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	}
+
+	events := stream(logLimits{maxLines: 5, maxBytes: 1 << 20, maxFollow: time.Minute})
+	require.Len(t, events, 6)
+	assert.Equal(t, "event: truncated\ndata: {\"cursor\":\"s=1;i=4\"}", events[5])
+
+	events = stream(logLimits{maxLines: 1000, maxBytes: 25, maxFollow: time.Minute})
+	require.Len(t, events, 3)
+	assert.Contains(t, events[1], "id: s=1;i=1\nevent: entry")
+	assert.Equal(t, "event: truncated\ndata: {\"cursor\":\"s=1;i=1\"}", events[2])
+}
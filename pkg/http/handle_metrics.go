@@ -0,0 +1,108 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/cluster"
+	"github.com/0x1d/rcond/pkg/metrics"
+	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/system"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounterVec("rcond_http_requests_total", "Handled API requests by method, route and status code.", "method", "route", "code")
+	httpDuration = metrics.Default.NewHistogramVec("rcond_http_request_duration_seconds", "Latency of API requests by method and route.", metrics.DefBuckets, "method", "route")
+)
+
+// memberStatuses are the statuses of cluster members that are always reported.
+var memberStatuses = []string{"alive", "leaving", "left", "failed"}
+
+// instrumented counts the requests of a route and observes their latency.
+// Routes are labeled with the path of the spec, so versioned routes and their aliases are counted together.
+func instrumented(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route, ok := routePath(r)
+		if !ok {
+			return
+		}
+		httpRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// metricsHandler serves the metrics of rcond, the network and the cluster, and of the host
+// in the Prometheus text format. Metrics that can not be read are left out.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+	metrics.Default.Collect(mw)
+	collectHost(mw)
+	collectNetwork(mw)
+	if s.clusterAgent != nil {
+		collectCluster(mw, s.clusterAgent)
+	}
+	if err := mw.Err(); err != nil {
+		log.Printf("[WARN] Failed to write metrics: %v", err)
+	}
+}
+
+func collectHost(w *metrics.Writer) {
+	if uptime, err := system.Uptime(); err == nil {
+		w.Gauge("rcond_host_uptime_seconds", "Time since the host booted.", uptime.Seconds())
+	}
+	if load, err := system.Load(); err == nil {
+		w.Gauge("rcond_host_load1", "Load average over 1 minute.", load.Load1)
+		w.Gauge("rcond_host_load5", "Load average over 5 minutes.", load.Load5)
+		w.Gauge("rcond_host_load15", "Load average over 15 minutes.", load.Load15)
+	}
+	if mem, err := system.MemoryInfo(); err == nil {
+		w.Gauge("rcond_host_memory_total_bytes", "Total memory of the host.", float64(mem.Total))
+		w.Gauge("rcond_host_memory_available_bytes", "Memory available for new processes.", float64(mem.Available))
+	}
+	temp, err := system.Temperature()
+	if err == nil {
+		w.Gauge("rcond_host_temperature_celsius", "Temperature of the first thermal zone, the SoC on a Raspberry Pi.", temp)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[WARN] Failed to read temperature: %v", err)
+	}
+}
+
+func collectNetwork(w *metrics.Writer) {
+	devices, err := network.Devices()
+	if err != nil {
+		return
+	}
+	for _, d := range devices {
+		w.Gauge("rcond_network_device_state", "NetworkManager state of a device, 100 if activated.", float64(d.StateCode), "interface", d.Interface, "type", d.Type)
+	}
+	for _, d := range devices {
+		if d.Strength != nil {
+			w.Gauge("rcond_network_link_quality_percent", "Signal quality of the access point of a connected WiFi device.", float64(*d.Strength), "interface", d.Interface)
+		}
+	}
+	if active, err := network.ActiveConnections(); err == nil {
+		w.Gauge("rcond_network_active_connections", "Number of active NetworkManager connections.", float64(active))
+	}
+}
+
+func collectCluster(w *metrics.Writer, agent *cluster.Agent) {
+	members, err := agent.Members(cluster.MemberFilter{})
+	if err != nil {
+		return
+	}
+	counts := make(map[string]int)
+	for _, m := range members {
+		counts[m.Status]++
+	}
+	for _, status := range memberStatuses {
+		w.Gauge("rcond_cluster_members", "Cluster members by status.", float64(counts[status]), "status", status)
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t)
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeNetworkRead})
+	require.NoError(t, err)
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, serve("/v1/tokens", "secret").Code)
+	assert.Equal(t, http.StatusForbidden, serve("/metrics", reader).Code)
+	rec := serve("/metrics", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+	assert.Contains(t, rec.Body.String(), `rcond_http_requests_total{method="GET",route="/tokens",code="200"}`)
+	assert.Contains(t, rec.Body.String(), `rcond_http_requests_total{method="GET",route="/metrics",code="403"}`)
+	assert.Contains(t, rec.Body.String(), `rcond_http_request_duration_seconds_bucket{method="GET",route="/tokens",le="+Inf"}`)
+	assert.Contains(t, rec.Body.String(), "# TYPE rcond_host_uptime_seconds gauge")
+}
+
+func TestMetricsPublic(t *testing.T) {
+	s := NewServer(&config.Config{Rcond: config.RcondConfig{Addr: "127.0.0.1:0", ApiToken: "secret", Metrics: config.MetricsConfig{Public: true}}})
+	s.RegisterRoutes()
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "rcond_http_requests_total")
+}
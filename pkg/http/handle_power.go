@@ -0,0 +1,115 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/gorilla/mux"
+)
+
+// HandlePowerAction schedules a reboot or poweroff after the delay or at the time of the optional
+// api.PowerRequest and responds with the pending action before it runs.
+// A delay of zero and a time in the past run the action immediately, like a request without either.
+func HandlePowerAction(power *system.Power, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req api.PowerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			WriteError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var at time.Time
+		switch {
+		case req.Delay != "" && req.At != nil:
+			WriteError(w, "delay and at are mutually exclusive", http.StatusBadRequest)
+			return
+		case req.Delay != "":
+			delay, err := time.ParseDuration(req.Delay)
+			if err != nil || delay < 0 {
+				WriteError(w, "invalid delay, expected a duration like 5m", http.StatusBadRequest)
+				return
+			}
+			if delay > 0 {
+				at = time.Now().Add(delay)
+			}
+		case req.At != nil:
+			at = *req.At
+		}
+
+		scheduled, err := power.Schedule(action, at, req.Force, identityName(r))
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scheduled)
+	}
+}
+
+// HandlePower returns the pending and failed power actions and the inhibitors held with logind.
+func HandlePower(power *system.Power) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := api.PowerResponse{Pending: powerActions(power.List()), Failed: powerActions(power.Failed()), Inhibitors: []api.Inhibitor{}}
+		inhibitors, err := power.Inhibitors()
+		if err != nil {
+			log.Printf("[WARN] Failed to list inhibitors: %v", err)
+		} else if inhibitors != nil {
+			resp.Inhibitors = apiInhibitors(inhibitors)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleCancelPower cancels a pending power action, or all pending actions without an id.
+func HandleCancelPower(power *system.Power) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := mux.Vars(r)["id"]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(power.CancelAll())
+			return
+		}
+		canceled, err := power.Cancel(id)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(canceled)
+	}
+}
+
+// powerActions converts power actions to the wire format of the API.
+func powerActions(actions []system.PowerAction) []api.PowerAction {
+	converted := make([]api.PowerAction, len(actions))
+	for i, action := range actions {
+		converted[i] = api.PowerAction{
+			ID:          action.ID,
+			Action:      action.Action,
+			At:          action.At,
+			Force:       action.Force,
+			CreatedBy:   action.CreatedBy,
+			CreatedAt:   action.CreatedAt,
+			InhibitedBy: apiInhibitors(action.InhibitedBy),
+			Error:       action.Error,
+		}
+	}
+	return converted
+}
+
+func apiInhibitors(inhibitors []system.Inhibitor) []api.Inhibitor {
+	if inhibitors == nil {
+		return nil
+	}
+	converted := make([]api.Inhibitor, len(inhibitors))
+	for i, inhibitor := range inhibitors {
+		converted[i] = api.Inhibitor(inhibitor)
+	}
+	return converted
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPowerEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	t.Cleanup(s.power.Stop)
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeSystemRead})
+	require.NoError(t, err)
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"delay":"soon"}`,
+		`{"delay":"-5m"}`,
+		`{"delay":"5m","at":"2999-01-01T00:00:00Z"}`,
+		`not json`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/system/restart", "secret", body).Code, body)
+	}
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/system/restart", reader, `{"delay":"1h"}`).Code)
+
+	rec := serve(http.MethodPost, "/system/restart", "secret", `{"delay":"1h"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var reboot system.PowerAction
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&reboot))
+	assert.Equal(t, system.PowerReboot, reboot.Action)
+	assert.Equal(t, "default", reboot.CreatedBy)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), reboot.At, time.Minute)
+
+	at := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	rec = serve(http.MethodPost, "/system/shutdown", "secret", `{"at":"`+at.Format(time.RFC3339)+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodGet, "/system/power", reader, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status api.PowerResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	require.Len(t, status.Pending, 2)
+	assert.Equal(t, reboot.ID, status.Pending[0].ID)
+	assert.Equal(t, system.PowerPoweroff, status.Pending[1].Action)
+	assert.True(t, at.Equal(status.Pending[1].At))
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/system/power/"+reboot.ID, reader, "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/system/power/"+reboot.ID, "secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/system/power/"+reboot.ID, "secret", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/system/power", "secret", "").Code)
+	assert.Empty(t, s.power.List())
+}
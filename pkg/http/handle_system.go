@@ -5,35 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/0x1d/rcond/pkg/api"
 	"github.com/0x1d/rcond/pkg/system"
 )
 
-func HandleReboot(w http.ResponseWriter, r *http.Request) {
-	if err := system.Restart(); err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-}
-
-func HandleShutdown(w http.ResponseWriter, r *http.Request) {
-	if err := system.Shutdown(); err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-}
-
 func HandleFileUpload(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body
-	var fileUpload struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
-	}
+	var fileUpload api.FileUploadRequest
 	if err := json.NewDecoder(r.Body).Decode(&fileUpload); err != nil {
 		WriteError(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -48,10 +26,10 @@ func HandleFileUpload(w http.ResponseWriter, r *http.Request) {
 
 	// Store the file
 	if err := system.StoreFile(fileUpload.Path, contentBytes); err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
+		writeErr(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
 }
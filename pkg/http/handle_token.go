@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/gorilla/mux"
+)
+
+func HandleListTokens(tokens *auth.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens.List())
+	}
+}
+
+func HandleCreateToken(tokens *auth.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req api.CreateTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// a client can only grant the scopes it holds itself
+		identity, _ := auth.IdentityFromContext(r.Context())
+		for _, scope := range req.Scopes {
+			if identity == nil || !identity.Allows(scope) {
+				WriteError(w, "scope "+scope+" is not granted to the requesting token", http.StatusForbidden)
+				return
+			}
+		}
+
+		secret, token, err := tokens.Create(req.Name, req.Scopes)
+		switch {
+		case errors.Is(err, auth.ErrTokenExists):
+			WriteError(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(api.CreateTokenResponse{
+			Token:  api.Token{Name: token.Name, Scopes: token.Scopes, Source: token.Source, CreatedAt: token.CreatedAt},
+			Secret: secret,
+		})
+	}
+}
+
+func HandleRevokeToken(tokens *auth.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := tokens.Revoke(mux.Vars(r)["name"])
+		switch {
+		case errors.Is(err, auth.ErrTokenNotFound):
+			WriteError(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, auth.ErrTokenReadOnly):
+			WriteError(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
+	}
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/gorilla/mux"
+)
+
+// HandleUnits lists the systemd units of the allowlist.
+func HandleUnits(units *system.Units) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := units.List()
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// HandleUnit returns the state of a unit of the allowlist.
+func HandleUnit(units *system.Units) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		unit, err := units.Get(mux.Vars(r)["name"])
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(unit)
+	}
+}
+
+// HandleUnitAction starts, stops, restarts, reloads, enables or disables a unit of the allowlist
+// and returns its state.
+func HandleUnitAction(units *system.Units) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		unit, err := units.Run(vars["name"], vars["action"])
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(unit)
+	}
+}
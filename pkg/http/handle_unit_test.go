@@ -0,0 +1,32 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitEndpoints(t *testing.T) {
+	s := NewServer(&config.Config{Rcond: config.RcondConfig{Addr: "127.0.0.1:0", ApiToken: "secret", Units: config.UnitsConfig{Allow: []string{"nginx"}}}})
+	s.RegisterRoutes()
+	reader, _, err := s.tokens.Create("reader", []string{auth.ScopeUnitsRead})
+	require.NoError(t, err)
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/v1/system/units/ssh", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/v1/system/units/nginx*", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/v1/system/units/nginx/mask", "secret").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/v1/system/units/ssh/restart", "secret").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/v1/system/units/nginx/restart", reader).Code)
+}
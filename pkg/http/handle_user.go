@@ -5,17 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/0x1d/rcond/pkg/api"
 	"github.com/0x1d/rcond/pkg/user"
 	"github.com/gorilla/mux"
 )
 
-type authorizedKeyRequest struct {
-	User   string `json:"user"`
-	PubKey string `json:"pubkey"`
-}
-
 func HandleAddAuthorizedKey(w http.ResponseWriter, r *http.Request) {
-	var req authorizedKeyRequest
+	var req api.AuthorizedKeyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, err.Error(), http.StatusBadRequest)
 		return
@@ -25,12 +21,12 @@ func HandleAddAuthorizedKey(w http.ResponseWriter, r *http.Request) {
 
 	fingerprint, err := user.AddAuthorizedKey(username, req.PubKey)
 	if err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
+		writeErr(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"fingerprint": fingerprint})
+	json.NewEncoder(w).Encode(api.AuthorizedKeyResponse{Fingerprint: fingerprint})
 }
 
 func HandleRemoveAuthorizedKey(w http.ResponseWriter, r *http.Request) {
@@ -54,10 +50,10 @@ func HandleRemoveAuthorizedKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := user.RemoveAuthorizedKey(username, string(fingerprintBytes)); err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
+		writeErr(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(api.StatusResponse{Status: api.StatusSuccess})
 }
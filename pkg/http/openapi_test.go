@@ -0,0 +1,156 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/cluster"
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/network"
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/0x1d/rcond/pkg/system"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer(&config.Config{Rcond: config.RcondConfig{Addr: "127.0.0.1:0", ApiToken: "secret"}})
+	s.RegisterRoutes()
+	return s
+}
+
+// TestSpecPathsRegistered checks that every path and method of the spec is served and every route is documented.
+func TestSpecPathsRegistered(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, op := range s.spec.Operations() {
+		for _, prefix := range []string{api.Version, ""} {
+			path := prefix + op.Path
+			req := httptest.NewRequest(op.Method, pathParam.ReplaceAllString(path, "x"), nil)
+			var match mux.RouteMatch
+			if !assert.True(t, s.router.Match(req, &match), "%s %s is not registered", op.Method, path) {
+				continue
+			}
+			tmpl, err := match.Route.GetPathTemplate()
+			require.NoError(t, err)
+			assert.Equal(t, path, prefix+specPath(tmpl), "%s %s is served by another route", op.Method, path)
+		}
+	}
+
+	err := s.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			assert.NotNil(t, s.spec.Operation(method, specPath(tmpl)), "%s %s is not documented", method, tmpl)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestValidateRequests(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []api.FieldError
+	}{
+		{"unknown field", `{"name": "ci", "scopes": ["files:write"], "admin": true}`, http.StatusBadRequest, []api.FieldError{{Field: "admin", Message: "unknown field"}}},
+		{"missing field", `{"name": "ci"}`, http.StatusBadRequest, []api.FieldError{{Field: "scopes", Message: "is required"}}},
+		{"empty body", ``, http.StatusBadRequest, []api.FieldError{{Message: "request body is required"}}},
+		{"valid", `{"name": "ci", "scopes": ["files:write"]}`, http.StatusCreated, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/tokens", strings.NewReader(tt.body))
+			req.Header.Set("X-API-Token", "secret")
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.errors, resp.Errors)
+		})
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+	assert.Equal(t, s.spec.YAML(), rec.Body.Bytes())
+}
+
+// TestWireTypes checks that the wire structs of pkg/api encode like the types of the daemon they mirror.
+func TestWireTypes(t *testing.T) {
+	for _, pair := range [][2]interface{}{
+		{cluster.Member{}, api.Member{}},
+		{cluster.HistoryEntry{}, api.HistoryEntry{}},
+		{cluster.LeaderInfo{}, api.LeaderInfo{}},
+		{cluster.KeyResponse{}, api.KeyResponse{}},
+		{cluster.Document{}, api.Document{}},
+		{cluster.RollingRestartRequest{}, api.RollingRestartRequest{}},
+		{cluster.RolloutNode{}, api.RolloutNode{}},
+		{system.Info{}, api.SystemInfo{}},
+		{system.Unit{}, api.Unit{}},
+		{system.LogEntry{}, api.LogEntry{}},
+		{system.PowerAction{}, api.PowerAction{}},
+		{network.Connection{}, api.Connection{}},
+		{auth.Token{}, api.Token{}},
+		{schema.FieldError{}, api.FieldError{}},
+	} {
+		daemon, wire := reflect.TypeOf(pair[0]), reflect.TypeOf(pair[1])
+		assert.Equal(t, wireFields(daemon), wireFields(wire), "%s and %s", daemon, wire)
+	}
+}
+
+// wireFields returns the JSON fields of a type with their kinds, nested fields are prefixed by their parent.
+func wireFields(t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name+":"+field.Type.Kind().String()+","+opts)
+		for _, nested := range wireFields(field.Type) {
+			fields = append(fields, name+"."+nested)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/ratelimit"
+)
+
+// Defaults for the rate limit configuration
+const (
+	defaultIPRate             = 10
+	defaultIPBurst            = 20
+	defaultTokenRate          = 5
+	defaultTokenBurst         = 10
+	defaultLockoutThreshold   = 5
+	defaultLockoutDuration    = 30 * time.Second
+	defaultLockoutMaxDuration = time.Hour
+	defaultMaxBodySize        = 1 << 20
+	defaultMaxUploadSize      = 32 << 20
+	// failedAuthRate and failedAuthBurst limit the failed authentication attempts per client IP,
+	// also if rate limiting is disabled.
+	failedAuthRate  = 1
+	failedAuthBurst = 5
+)
+
+// uploadRoutes accept request bodies up to the upload size instead of the body size.
+var uploadRoutes = map[string]bool{
+	"/system/file": true,
+}
+
+// limits protects the API from request floods, token guessing and large request bodies.
+type limits struct {
+	ip            *ratelimit.Limiter
+	token         *ratelimit.Limiter
+	failedAuth    *ratelimit.Limiter
+	lockout       *ratelimit.Lockout
+	maxBodySize   int64
+	maxUploadSize int64
+}
+
+func newLimits(cfg *config.RateLimitConfig) *limits {
+	l := &limits{
+		lockout: ratelimit.NewLockout(
+			orDefault(cfg.LockoutThreshold, defaultLockoutThreshold),
+			orDefault(cfg.LockoutDuration, defaultLockoutDuration),
+			orDefault(cfg.LockoutMaxDuration, defaultLockoutMaxDuration),
+		),
+		failedAuth:    ratelimit.NewLimiter(failedAuthRate, failedAuthBurst),
+		maxBodySize:   orDefault(cfg.MaxBodySize, defaultMaxBodySize),
+		maxUploadSize: orDefault(cfg.MaxUploadSize, defaultMaxUploadSize),
+	}
+	if cfg.Enabled {
+		l.ip = ratelimit.NewLimiter(orDefault(cfg.IPRate, defaultIPRate), orDefault(cfg.IPBurst, defaultIPBurst))
+		l.token = ratelimit.NewLimiter(orDefault(cfg.TokenRate, defaultTokenRate), orDefault(cfg.TokenBurst, defaultTokenBurst))
+	}
+	return l
+}
+
+func orDefault[T int | int64 | float64 | time.Duration](value, def T) T {
+	if value == 0 {
+		return def
+	}
+	return value
+}
+
+// limitRequests is a middleware of the API routes that limits the request rate per client IP
+// and the size of request bodies.
+func (s *Server) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limits.ip != nil {
+			if ok, wait := s.limits.ip.Allow(clientIP(r)); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+		limit := s.limits.maxBodySize
+		if path, ok := routePath(r); ok && uploadRoutes[path] {
+			limit = s.limits.maxUploadSize
+		}
+		if r.ContentLength > limit {
+			WriteError(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooManyRequests rejects a request with 429 and the seconds to wait in the Retry-After header.
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteError(w, "too many requests", http.StatusTooManyRequests)
+}
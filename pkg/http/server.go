@@ -3,25 +3,106 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/audit"
+	"github.com/0x1d/rcond/pkg/auth"
 	"github.com/0x1d/rcond/pkg/cluster"
 	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/job"
+	"github.com/0x1d/rcond/pkg/openapi"
+	"github.com/0x1d/rcond/pkg/system"
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
 	router       *mux.Router
 	srv          *http.Server
-	apiToken     string
+	socketSrv    *http.Server
+	socketCfg    *config.SocketConfig
+	tokens       *auth.TokenStore
+	certs        *auth.CertMapper
+	peers        *auth.PeerMapper
+	jwt          *auth.JWTVerifier
+	audit        *audit.Log
+	limits       *limits
+	tls          *certReloader
+	tlsReload    time.Duration
 	clusterAgent *cluster.Agent
+	jobs         *job.Manager
+	health       *health
+	units        *system.Units
+	logLimits    logLimits
+	power        *system.Power
+	spec         *openapi.Spec
+	// validateResponses logs responses that do not match the spec.
+	validateResponses bool
+	// metricsPublic serves /metrics without authentication.
+	metricsPublic bool
+	done          chan struct{}
+	closeDone     sync.Once
 }
 
 func NewServer(cfg *config.Config) *Server {
-	if cfg.Rcond.Addr == "" || cfg.Rcond.ApiToken == "" {
-		panic("addr or api_token is not set")
+	if cfg.Rcond.Addr == "" {
+		panic("addr is not set")
+	}
+	tokens, err := auth.NewTokenStore(&cfg.Rcond)
+	if err != nil {
+		panic(err)
+	}
+	certs, err := auth.NewCertMapper(cfg.Rcond.TLS.Clients)
+	if err != nil {
+		panic(err)
+	}
+	var peers *auth.PeerMapper
+	if cfg.Rcond.Socket.Enabled {
+		peers, err = auth.NewPeerMapper(cfg.Rcond.Socket.Peers)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if tokens.Len() == 0 && len(cfg.Rcond.TLS.Clients) == 0 && !cfg.Rcond.JWT.Enabled && (peers == nil || peers.Len() == 0) {
+		panic("api_token, tokens, tls clients, jwt or socket peers are not set")
+	}
+	var jwt *auth.JWTVerifier
+	if cfg.Rcond.JWT.Enabled {
+		jwt, err = auth.NewJWTVerifier(&cfg.Rcond.JWT)
+		if err != nil {
+			panic(err)
+		}
+	}
+	var auditLog *audit.Log
+	if cfg.Rcond.Audit.Enabled {
+		auditLog, err = audit.NewLog(&cfg.Rcond.Audit)
+		if err != nil {
+			panic(err)
+		}
+	}
+	jobs, err := job.NewManager(&cfg.Rcond.Jobs)
+	if err != nil {
+		panic(err)
+	}
+	units, err := system.NewUnits(&cfg.Rcond.Units)
+	if err != nil {
+		panic(err)
+	}
+	spec, err := openapi.Load()
+	if err != nil {
+		panic(err)
+	}
+	var reloader *certReloader
+	if cfg.Rcond.TLS.Enabled {
+		reloader, err = newCertReloader(&cfg.Rcond.TLS)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	router := mux.NewRouter()
@@ -33,13 +114,47 @@ func NewServer(cfg *config.Config) *Server {
 		WriteTimeout: 15 * time.Second,
 	}
 
+	var socketSrv *http.Server
+	if cfg.Rcond.Socket.Enabled {
+		socketSrv = &http.Server{
+			Handler:      router,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			ConnContext:  peerConnContext,
+		}
+	}
+
 	return &Server{
-		router:   router,
-		srv:      srv,
-		apiToken: cfg.Rcond.ApiToken,
+		router:    router,
+		srv:       srv,
+		socketSrv: socketSrv,
+		socketCfg: &cfg.Rcond.Socket,
+		peers:     peers,
+		tokens:    tokens,
+		certs:     certs,
+		jwt:       jwt,
+		audit:     auditLog,
+		limits:    newLimits(&cfg.Rcond.RateLimit),
+		tls:       reloader,
+		tlsReload: cfg.Rcond.TLS.ReloadInterval,
+		jobs:      jobs,
+		health:    newHealth(cfg),
+		units:     units,
+		logLimits: newLogLimits(&cfg.Rcond.Logs),
+		power:     system.NewPower(),
+		spec:      spec,
+		done:      make(chan struct{}),
+
+		validateResponses: cfg.Rcond.ValidateResponses,
+		metricsPublic:     cfg.Rcond.Metrics.Public,
 	}
 }
 
+// Power returns the scheduler of power actions, so the cluster agent can share it.
+func (s *Server) Power() *system.Power {
+	return s.power
+}
+
 func (s *Server) WithClusterAgent(agent *cluster.Agent) *Server {
 	s.clusterAgent = agent
 	return s
@@ -57,48 +172,187 @@ func Up(appConfig *config.Config, clusterAgent *cluster.Agent) *Server {
 	return srv
 }
 
+// Start serves the API, over HTTPS if TLS is enabled.
+// If the socket is enabled, it is served concurrently.
 func (s *Server) Start() error {
-	return s.srv.ListenAndServe()
+	if s.jwt != nil {
+		go s.jwt.Watch(s.done)
+	}
+	if s.socketSrv != nil {
+		listener, err := listenSocket(s.socketCfg)
+		if err != nil {
+			return fmt.Errorf("failed to listen on socket: %v", err)
+		}
+		log.Printf("[INFO] Serving API on socket %s", listener.Addr())
+		go func() {
+			if err := s.socketSrv.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Printf("[ERROR] Socket server failed: %v", err)
+			}
+		}()
+	}
+	if s.tls == nil {
+		return s.srv.ListenAndServe()
+	}
+	s.srv.TLSConfig = s.tls.tlsConfig()
+	go s.tls.watch(s.tlsReload, s.done)
+	return s.srv.ListenAndServeTLS("", "")
 }
 
+// Shutdown stops the servers and the background tasks. It may be called more than once.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	s.closeDone.Do(func() { close(s.done) })
+	if s.socketSrv != nil {
+		s.socketSrv.Shutdown(ctx)
+	}
+	err := s.srv.Shutdown(ctx)
+	s.power.Stop()
+	if s.audit != nil {
+		s.audit.Close()
+	}
+	return err
 }
 
-func (s *Server) verifyToken(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-API-Token")
-		if token == "" || token != s.apiToken {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+// authenticate returns the identity of a mapped Unix socket peer, of a verified and mapped
+// client certificate, of a JWT in the Authorization header, or of the token in the X-API-Token header.
+func (s *Server) authenticate(r *http.Request) (*auth.Identity, error) {
+	if cred, ok := peerCred(r); ok && s.peers != nil {
+		if identity, ok := s.peers.Identify(cred.Uid, cred.Gid); ok {
+			return identity, nil
+		}
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if identity, ok := s.certs.Identify(r.TLS.VerifiedChains[0][0]); ok {
+			return identity, nil
 		}
-		next(w, r)
 	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && s.jwt != nil {
+		return s.jwt.Verify(strings.TrimSpace(bearer))
+	}
+	return s.tokens.Authenticate(r.Header.Get("X-API-Token"))
 }
 
+// requireScope authenticates the client and checks that it was granted the scope.
+// Failed attempts are rate limited per client IP, client IPs with too many failed attempts are locked out
+// and authenticated clients are rate limited.
+// The identity of the client is added to the request context and mutating calls are audited.
+// Request bodies are validated against the OpenAPI spec once the client is authorized.
+// An empty scope only requires authentication.
+func (s *Server) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return s.audited(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if locked, wait := s.limits.lockout.Locked(ip); locked {
+			tooManyRequests(w, wait)
+			return
+		}
+		if wait := s.limits.failedAuth.Wait(ip); wait > 0 {
+			tooManyRequests(w, wait)
+			return
+		}
+		identity, err := s.authenticate(r)
+		if err != nil {
+			s.limits.failedAuth.Allow(ip)
+			if d := s.limits.lockout.Failure(ip); d > 0 {
+				log.Printf("[WARN] Locked out %s for %s after failed authentication attempts", ip, d)
+			}
+			WriteError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		setAuditIdentity(r, identity.Name)
+		if s.limits.token != nil {
+			if ok, wait := s.limits.token.Allow(identity.Name); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+		if scope != "" && !identity.Allows(scope) {
+			WriteError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		s.validated(next)(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// RegisterRoutes registers the API under the version prefix, with responses wrapped in an api.Envelope,
+// and as deprecated unversioned aliases that send the plain response bodies.
 func (s *Server) RegisterRoutes() {
-	s.router.HandleFunc("/health", s.healthHandler).Methods(http.MethodGet)
-	s.router.HandleFunc("/network/ap", s.verifyToken(HandleConfigureAP)).Methods(http.MethodPost)
-	s.router.HandleFunc("/network/sta", s.verifyToken(HandleConfigureSTA)).Methods(http.MethodPost)
-	s.router.HandleFunc("/network/interface/{interface}", s.verifyToken(HandleNetworkUp)).Methods(http.MethodPut)
-	s.router.HandleFunc("/network/interface/{interface}", s.verifyToken(HandleNetworkDown)).Methods(http.MethodDelete)
-	s.router.HandleFunc("/network/connection/{uuid}", s.verifyToken(HandleNetworkRemove)).Methods(http.MethodDelete)
-	s.router.HandleFunc("/hostname", s.verifyToken(HandleGetHostname)).Methods(http.MethodGet)
-	s.router.HandleFunc("/hostname", s.verifyToken(HandleSetHostname)).Methods(http.MethodPost)
-	s.router.HandleFunc("/users/{user}/keys", s.verifyToken(HandleAddAuthorizedKey)).Methods(http.MethodPost)
-	s.router.HandleFunc("/users/{user}/keys/{fingerprint}", s.verifyToken(HandleRemoveAuthorizedKey)).Methods(http.MethodDelete)
-	s.router.HandleFunc("/system/file", s.verifyToken(HandleFileUpload)).Methods(http.MethodPost)
-	s.router.HandleFunc("/system/restart", s.verifyToken(HandleReboot)).Methods(http.MethodPost)
-	s.router.HandleFunc("/system/shutdown", s.verifyToken(HandleShutdown)).Methods(http.MethodPost)
-	s.router.HandleFunc("/cluster/members", s.verifyToken(ClusterAgentHandler(s.clusterAgent, HandleClusterMembers))).Methods(http.MethodGet)
-	s.router.HandleFunc("/cluster/join", s.verifyToken(ClusterAgentHandler(s.clusterAgent, HandleClusterJoin))).Methods(http.MethodPost)
-	s.router.HandleFunc("/cluster/leave", s.verifyToken(ClusterAgentHandler(s.clusterAgent, HandleClusterLeave))).Methods(http.MethodPost)
-	s.router.HandleFunc("/cluster/event", s.verifyToken(ClusterAgentHandler(s.clusterAgent, HandleClusterEvent))).Methods(http.MethodPost)
+	s.router.NotFoundHandler = versioned(http.HandlerFunc(notFound))
+	s.router.MethodNotAllowedHandler = versioned(http.HandlerFunc(methodNotAllowed))
+	s.registerRoutes(api.Version, func(h http.Handler) http.Handler {
+		return instrumented(enveloped(s.requireClientCert(s.limitRequests(h))))
+	})
+	s.registerRoutes("", func(h http.Handler) http.Handler {
+		return instrumented(deprecated(s.requireClientCert(s.limitRequests(h))))
+	})
 }
 
-func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+// registerRoutes registers every route with the prefix, the handlers are wrapped by wrap.
+func (s *Server) registerRoutes(prefix string, wrap func(http.Handler) http.Handler) {
+	handle := func(path string, handler http.HandlerFunc) *mux.Route {
+		return s.router.Handle(prefix+path, wrap(handler))
+	}
+	handle("/health", s.healthHandler).Methods(http.MethodGet)
+	handle("/openapi.yaml", s.specHandler).Methods(http.MethodGet)
+	handle("/system/tls", s.tlsHandler).Methods(http.MethodGet)
+	handle("/system/info", s.requireScope(auth.ScopeSystemRead, s.systemInfoHandler)).Methods(http.MethodGet)
+	if s.metricsPublic {
+		handle("/metrics", s.metricsHandler).Methods(http.MethodGet)
+	} else {
+		handle("/metrics", s.requireScope(auth.ScopeMetricsRead, s.metricsHandler)).Methods(http.MethodGet)
+	}
+	handle("/network/ap", s.requireScope(auth.ScopeNetworkWrite, s.asyncable(networkAPJob, auth.ScopeNetworkWrite, HandleConfigureAP))).Methods(http.MethodPost)
+	handle("/network/sta", s.requireScope(auth.ScopeNetworkWrite, s.asyncable(networkSTAJob, auth.ScopeNetworkWrite, HandleConfigureSTA))).Methods(http.MethodPost)
+	handle("/network/connections", s.requireScope(auth.ScopeNetworkRead, HandleListConnections)).Methods(http.MethodGet)
+	handle("/network/interface/{interface}", s.requireScope(auth.ScopeNetworkWrite, s.asyncable(networkUpJob, auth.ScopeNetworkWrite, HandleNetworkUp))).Methods(http.MethodPut)
+	handle("/network/interface/{interface}", s.requireScope(auth.ScopeNetworkWrite, s.asyncable(networkDownJob, auth.ScopeNetworkWrite, HandleNetworkDown))).Methods(http.MethodDelete)
+	handle("/network/connection/{uuid}", s.requireScope(auth.ScopeNetworkWrite, HandleNetworkRemove)).Methods(http.MethodDelete)
+	handle("/hostname", s.requireScope(auth.ScopeNetworkRead, HandleGetHostname)).Methods(http.MethodGet)
+	handle("/hostname", s.requireScope(auth.ScopeNetworkWrite, HandleSetHostname)).Methods(http.MethodPost)
+	handle("/users/{user}/keys", s.requireScope(auth.ScopeUsersWrite, HandleAddAuthorizedKey)).Methods(http.MethodPost)
+	handle("/users/{user}/keys/{fingerprint}", s.requireScope(auth.ScopeUsersWrite, HandleRemoveAuthorizedKey)).Methods(http.MethodDelete)
+	handle("/system/file", s.requireScope(auth.ScopeFilesWrite, HandleFileUpload)).Methods(http.MethodPost)
+	handle("/system/units", s.requireScope(auth.ScopeUnitsRead, HandleUnits(s.units))).Methods(http.MethodGet)
+	handle("/system/units/{name}", s.requireScope(auth.ScopeUnitsRead, HandleUnit(s.units))).Methods(http.MethodGet)
+	handle("/system/units/{name}/{action}", s.requireScope(auth.ScopeUnitsWrite, HandleUnitAction(s.units))).Methods(http.MethodPost)
+	handle("/system/logs", s.requireScope(auth.ScopeLogsRead, HandleLogs(s.logLimits))).Methods(http.MethodGet)
+	handle("/system/restart", s.requireScope(auth.ScopeSystemPower, s.asyncable(systemRestartJob, auth.ScopeSystemPower, HandlePowerAction(s.power, system.PowerReboot)))).Methods(http.MethodPost)
+	handle("/system/shutdown", s.requireScope(auth.ScopeSystemPower, s.asyncable(systemShutdownJob, auth.ScopeSystemPower, HandlePowerAction(s.power, system.PowerPoweroff)))).Methods(http.MethodPost)
+	handle("/system/power", s.requireScope(auth.ScopeSystemRead, HandlePower(s.power))).Methods(http.MethodGet)
+	handle("/system/power", s.requireScope(auth.ScopeSystemPower, HandleCancelPower(s.power))).Methods(http.MethodDelete)
+	handle("/system/power/{id}", s.requireScope(auth.ScopeSystemPower, HandleCancelPower(s.power))).Methods(http.MethodDelete)
+	handle("/audit", s.requireScope(auth.ScopeAuditRead, HandleAudit(s.audit))).Methods(http.MethodGet)
+	handle("/tokens", s.requireScope(auth.ScopeTokensAdmin, HandleListTokens(s.tokens))).Methods(http.MethodGet)
+	handle("/tokens", s.requireScope(auth.ScopeTokensAdmin, HandleCreateToken(s.tokens))).Methods(http.MethodPost)
+	handle("/tokens/{name}", s.requireScope(auth.ScopeTokensAdmin, HandleRevokeToken(s.tokens))).Methods(http.MethodDelete)
+	handle("/jobs", s.requireScope("", HandleJobs(s.jobs))).Methods(http.MethodGet)
+	handle("/jobs/{id}", s.requireScope("", HandleJob(s.jobs))).Methods(http.MethodGet)
+	handle("/jobs/{id}", s.requireScope("", HandleCancelJob(s.jobs))).Methods(http.MethodDelete)
+	handle("/cluster/members", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterMembers))).Methods(http.MethodGet)
+	handle("/cluster/members/{name}", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterMember))).Methods(http.MethodGet)
+	handle("/cluster/join", s.requireScope(auth.ScopeClusterAdmin, s.asyncable(clusterJoinJob, auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterJoin)))).Methods(http.MethodPost)
+	handle("/cluster/leave", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterLeave))).Methods(http.MethodPost)
+	handle("/cluster/event", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterEvent))).Methods(http.MethodPost)
+	handle("/cluster/events", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterEvents))).Methods(http.MethodGet)
+	handle("/cluster/history", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterHistory))).Methods(http.MethodGet)
+	handle("/cluster/leader", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterLeader))).Methods(http.MethodGet)
+	handle("/cluster/rolling-restart", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterRollingRestart(s.jobs)))).Methods(http.MethodPost)
+	handle("/cluster/rolling-restart", s.requireScope(auth.ScopeClusterRead, HandleClusterRollingRestarts(s.jobs))).Methods(http.MethodGet)
+	handle("/cluster/rolling-restart/{id}", s.requireScope(auth.ScopeClusterRead, HandleClusterRollingRestartStatus(s.jobs))).Methods(http.MethodGet)
+	handle("/cluster/keys", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterListKeys))).Methods(http.MethodGet)
+	handle("/cluster/keys", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterInstallKey))).Methods(http.MethodPost)
+	handle("/cluster/keys", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterRemoveKey))).Methods(http.MethodDelete)
+	handle("/cluster/state", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterStateList))).Methods(http.MethodGet)
+	handle("/cluster/state/{key:.+}", s.requireScope(auth.ScopeClusterRead, ClusterAgentHandler(s.clusterAgent, HandleClusterStateGet))).Methods(http.MethodGet)
+	handle("/cluster/state/{key:.+}", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterStatePut))).Methods(http.MethodPut)
+	handle("/cluster/state/{key:.+}", s.requireScope(auth.ScopeClusterAdmin, ClusterAgentHandler(s.clusterAgent, HandleClusterStateDelete))).Methods(http.MethodDelete)
+}
+
+// tlsHandler returns the served certificate, so clients can pin its fingerprint.
+// The certificate is public and sent in every TLS handshake, so no authentication is required.
+func (s *Server) tlsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.tls == nil {
+		WriteError(w, "tls is not enabled", http.StatusNotFound)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "healthy",
-	})
+	json.NewEncoder(w).Encode(s.tls.info())
 }
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/0x1d/rcond/pkg/auth"
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// Defaults for the socket configuration
+const (
+	defaultSocketPath = "/run/rcond/rcond.sock"
+	defaultSocketMode = 0660
+)
+
+type peerCredKey struct{}
+
+// listenSocket creates the Unix socket, replacing a stale socket file of a previous run,
+// and applies the configured file mode and group.
+func listenSocket(cfg *config.SocketConfig) (net.Listener, error) {
+	path := cfg.Path
+	if path == "" {
+		path = defaultSocketPath
+	}
+	mode := os.FileMode(defaultSocketMode)
+	if cfg.Mode != "" {
+		m, err := strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket mode %q", cfg.Mode)
+		}
+		mode = os.FileMode(m)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket mode: %v", err)
+	}
+	if cfg.Group != "" {
+		gid, err := auth.LookupGID(cfg.Group)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		if err := os.Chown(path, -1, int(gid)); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set socket group: %v", err)
+		}
+	}
+	return listener, nil
+}
+
+// peerConnContext adds the credentials of the process connected to a Unix socket to the context.
+func peerConnContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+	var cred *syscall.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+func peerCred(r *http.Request) (*syscall.Ucred, bool) {
+	cred, ok := r.Context().Value(peerCredKey{}).(*syscall.Ucred)
+	return cred, ok
+}
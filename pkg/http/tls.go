@@ -0,0 +1,311 @@
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+// Defaults for the TLS configuration
+const (
+	defaultCertFile          = "/etc/rcond/tls/rcond.crt"
+	defaultKeyFile           = "/etc/rcond/tls/rcond.key"
+	defaultTLSReloadInterval = time.Minute
+	selfSignedValidity       = 10 * 365 * 24 * time.Hour
+)
+
+// certReloader serves the certificate and client CAs from files
+// and reloads them when the files change or on SIGHUP.
+type certReloader struct {
+	certFile          string
+	keyFile           string
+	clientCAFile      string
+	requireClientCert bool
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	leaf      *x509.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// newCertReloader loads the configured certificate.
+// A self-signed certificate is generated if the certificate and key files do not exist.
+func newCertReloader(cfg *config.TLSConfig) (*certReloader, error) {
+	r := &certReloader{
+		certFile:          cfg.CertFile,
+		keyFile:           cfg.KeyFile,
+		clientCAFile:      cfg.ClientCAFile,
+		requireClientCert: cfg.RequireClientCert,
+	}
+	if r.certFile == "" {
+		r.certFile = defaultCertFile
+	}
+	if r.keyFile == "" {
+		r.keyFile = defaultKeyFile
+	}
+	if !exists(r.certFile) && !exists(r.keyFile) {
+		log.Printf("[INFO] Generating self-signed certificate %s", r.certFile)
+		if err := generateSelfSigned(r.certFile, r.keyFile); err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %v", err)
+		}
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the certificate, key and client CAs from their files.
+func (r *certReloader) load() error {
+	modTimes := r.currentModTimes()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		data, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client CA %s", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.leaf = leaf
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	log.Printf("[INFO] Loaded TLS certificate %s, SHA-256 fingerprint %s", r.certFile, Fingerprint(leaf))
+	return nil
+}
+
+func (r *certReloader) currentModTimes() map[string]time.Time {
+	modTimes := map[string]time.Time{}
+	for _, path := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// reloadIfChanged reloads the files if one of them was modified.
+// On failure the previous certificate is kept.
+func (r *certReloader) reloadIfChanged() {
+	r.mu.RLock()
+	previous := r.modTimes
+	r.mu.RUnlock()
+	changed := false
+	for path, modTime := range r.currentModTimes() {
+		if !modTime.Equal(previous[path]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Printf("[ERROR] Failed to reload TLS certificate, keeping the previous one: %v", err)
+	}
+}
+
+// watch reloads the certificate periodically and on SIGHUP until done is closed.
+func (r *certReloader) watch(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultTLSReloadInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-hup:
+			if err := r.load(); err != nil {
+				log.Printf("[ERROR] Failed to reload TLS certificate, keeping the previous one: %v", err)
+			}
+		case <-ticker.C:
+			r.reloadIfChanged()
+		}
+	}
+}
+
+// tlsConfig returns a TLS configuration that always serves the current certificate and client CAs.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			// a missing client certificate is rejected by requireClientCert,
+			// so /health stays reachable for the health checks of other members
+			if r.clientCAs != nil {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// requireClientCert rejects requests over TLS without a verified client certificate
+// if require_client_cert is set. /health is exempt, it is checked by other members during a rolling restart.
+func (s *Server) requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tls != nil && s.tls.requireClientCert && r.TLS != nil && len(r.TLS.VerifiedChains) == 0 {
+			if path, ok := routePath(r); !ok || path != "/health" {
+				WriteError(w, "client certificate required", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// info describes the current certificate.
+func (r *certReloader) info() api.CertificateInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info := api.CertificateInfo{
+		Subject:     r.leaf.Subject.String(),
+		Issuer:      r.leaf.Issuer.String(),
+		DNSNames:    r.leaf.DNSNames,
+		NotBefore:   r.leaf.NotBefore,
+		NotAfter:    r.leaf.NotAfter,
+		SelfSigned:  selfSigned(r.leaf),
+		Fingerprint: Fingerprint(r.leaf),
+	}
+	for _, ip := range r.leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// selfSigned reports whether the certificate is signed by its own key.
+// CheckSignatureFrom can not be used, it rejects parents that are not a CA.
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate in the format used by openssl.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// generateSelfSigned writes a self-signed ECDSA certificate for the hostname
+// and the addresses of the local interfaces.
+func generateSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "rcond"
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"rcond"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              []string{hostname, "localhost"},
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+	}
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	s := newTestServer(t)
+	s.tls = &certReloader{requireClientCert: true}
+	serve := func(path string, state *tls.ConnectionState) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Token", "secret")
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("/v1/system/info", &tls.ConnectionState{}))
+	assert.Equal(t, http.StatusUnauthorized, serve("/system/info", &tls.ConnectionState{}))
+	assert.NotEqual(t, http.StatusUnauthorized, serve("/v1/health", &tls.ConnectionState{}))
+	assert.NotEqual(t, http.StatusUnauthorized, serve("/health", &tls.ConnectionState{}))
+	// plain HTTP, like requests on the Unix socket
+	assert.Equal(t, http.StatusOK, serve("/v1/system/info", nil))
+}
+
+func TestGenerateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "rcond.crt"), filepath.Join(dir, "rcond.key")
+	require.NoError(t, generateSelfSigned(certFile, keyFile))
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+
+	assert.False(t, cert.IsCA)
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, cert.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+	assert.True(t, selfSigned(cert))
+}
+
+func TestShutdownTwice(t *testing.T) {
+	s := newTestServer(t)
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.NotPanics(t, func() { s.Shutdown(context.Background()) })
+}
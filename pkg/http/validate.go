@@ -0,0 +1,87 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/0x1d/rcond/pkg/openapi"
+)
+
+// maxValidatedResponse is the part of a response body that is kept to validate it.
+const maxValidatedResponse = 1 << 20
+
+// routeVariable matches a variable of a route template with its pattern, like {key:.+}.
+var routeVariable = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// bodyRecorder captures the status code and the start of the body written by a handler.
+type bodyRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	if n := maxValidatedResponse - r.body.Len(); n > 0 {
+		r.body.Write(p[:min(n, len(p))])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// operation returns the documented operation of the route that matched the request.
+func (s *Server) operation(r *http.Request) *openapi.Operation {
+	path, ok := routePath(r)
+	if !ok {
+		return nil
+	}
+	return s.spec.Operation(r.Method, path)
+}
+
+// validated rejects request bodies that do not match the OpenAPI spec with 400 and the invalid fields.
+// If response validation is enabled, responses that do not match are logged, they are sent unchanged.
+func (s *Server) validated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op := s.operation(r)
+		if op == nil {
+			next(w, r)
+			return
+		}
+		if op.Body != nil || op.BodyRequired {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					WriteError(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				WriteError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := op.ValidateRequest(body); err != nil {
+				writeErr(w, err)
+				return
+			}
+			r.Body = bodyReader{bytes.NewReader(body), r.Body}
+		}
+		if !s.validateResponses {
+			next(w, r)
+			return
+		}
+		rec := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		next(rec, r)
+		if rec.body.Len() >= maxValidatedResponse {
+			return
+		}
+		if err := op.ValidateResponse(rec.status, rec.body.Bytes()); err != nil {
+			log.Printf("[WARN] Response %d of %s %s does not match the spec: %v", rec.status, op.Method, op.Path, err)
+		}
+	}
+}
+
+// specHandler serves the OpenAPI spec of the API.
+func (s *Server) specHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(s.spec.YAML())
+}
@@ -0,0 +1,183 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/gorilla/mux"
+)
+
+// unversioned are the routes that stay supported without the version prefix.
+var unversioned = map[string]bool{
+	"/health":       true,
+	"/metrics":      true,
+	"/openapi.yaml": true,
+}
+
+// specPath converts a route template to the path of the spec by removing the version prefix
+// and the patterns of variables.
+func specPath(tmpl string) string {
+	return routeVariable.ReplaceAllString(strings.TrimPrefix(tmpl, api.Version), "{$1}")
+}
+
+// routePath returns the spec path of the route that matched the request.
+func routePath(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return specPath(tmpl), true
+}
+
+// deprecated marks the responses of the unversioned aliases as deprecated
+// and links the route of the current version.
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !unversioned[r.URL.Path] {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", api.Version, r.URL.EscapedPath()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enveloped wraps the JSON responses and the errors of the versioned API in an api.Envelope.
+// Other successful responses, like the spec or event streams, are sent unchanged.
+func enveloped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &envelopeWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		ew.finish()
+	})
+}
+
+// versioned envelopes the responses of a handler for requests with the version prefix.
+func versioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, api.Version+"/") {
+			enveloped(next).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, "not found", http.StatusNotFound)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+// envelopeWriter buffers a response to wrap it in an api.Envelope once the handler returned.
+// Responses that are not wrapped are passed through as soon as the status is written.
+type envelopeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	body        bytes.Buffer
+}
+
+func (e *envelopeWriter) WriteHeader(code int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+	e.status = code
+	if code < 400 && !isJSON(e.Header().Get("Content-Type")) {
+		e.passthrough = true
+		e.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (e *envelopeWriter) Write(p []byte) (int, error) {
+	if !e.wroteHeader {
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.passthrough {
+		return e.ResponseWriter.Write(p)
+	}
+	return e.body.Write(p)
+}
+
+// Flush flushes passed through responses, buffered responses are sent by finish.
+func (e *envelopeWriter) Flush() {
+	if !e.passthrough {
+		return
+	}
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (e *envelopeWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// finish writes the buffered response in an envelope.
+func (e *envelopeWriter) finish() {
+	if e.passthrough {
+		return
+	}
+	var env api.Envelope
+	body := bytes.TrimSpace(e.body.Bytes())
+	contentType := e.Header().Get("Content-Type")
+	if e.status >= 400 {
+		env.Error = envelopeError(e.status, contentType, body)
+		// Error responses with a body of their own, like the checks of an unhealthy node, keep it as data.
+		if isJSON(contentType) && !isErrorResponse(body) {
+			env.Data = json.RawMessage(body)
+		}
+	} else if len(body) > 0 {
+		env.Data = json.RawMessage(body)
+	}
+	h := e.ResponseWriter.Header()
+	h.Set("Content-Type", "application/json")
+	h.Del("Content-Length")
+	e.ResponseWriter.WriteHeader(e.status)
+	json.NewEncoder(e.ResponseWriter).Encode(env)
+}
+
+// envelopeError converts the body of an error response, an ErrorResponse or plain text, to an api.Error.
+func envelopeError(status int, contentType string, body []byte) *api.Error {
+	apiErr := &api.Error{Code: errorCode(status), Message: string(body)}
+	var resp ErrorResponse
+	if isJSON(contentType) && json.Unmarshal(body, &resp) == nil {
+		apiErr.Message = resp.Error
+		apiErr.Fields = resp.Errors
+		if resp.Code != "" {
+			apiErr.Code = resp.Code
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.ToLower(http.StatusText(status))
+	}
+	return apiErr
+}
+
+// isErrorResponse reports whether a JSON body is an ErrorResponse.
+func isErrorResponse(body []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return true
+	}
+	_, ok := fields["error"]
+	return ok
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
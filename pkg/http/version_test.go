@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		status int
+		code   string
+	}{
+		{"data", http.MethodGet, "/v1/tokens", "", "secret", http.StatusOK, ""},
+		{"unauthorized", http.MethodGet, "/v1/tokens", "", "", http.StatusUnauthorized, api.CodeUnauthorized},
+		{"validation failed", http.MethodPost, "/v1/tokens", `{"name": "ci"}`, "secret", http.StatusBadRequest, api.CodeValidationFailed},
+		{"not found", http.MethodGet, "/v1/unknown", "", "secret", http.StatusNotFound, api.CodeNotFound},
+		{"method not allowed", http.MethodPatch, "/v1/hostname", "", "secret", http.StatusMethodNotAllowed, api.CodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("X-API-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Empty(t, rec.Header().Get("Deprecation"))
+			var env api.Envelope
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &env))
+			if tt.code == "" {
+				assert.Nil(t, env.Error)
+				assert.NotEmpty(t, env.Data)
+				return
+			}
+			require.NotNil(t, env.Error)
+			assert.Equal(t, tt.code, env.Error.Code)
+			assert.NotEmpty(t, env.Error.Message)
+			assert.Empty(t, env.Data)
+		})
+	}
+}
+
+func TestDeprecatedAliases(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/tokens", nil)
+	req.Header.Set("X-API-Token", "secret")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+	assert.Equal(t, `</v1/tokens>; rel="successor-version"`, rec.Header().Get("Link"))
+	var tokens []json.RawMessage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens), "aliases return unwrapped bodies")
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, api.CodeNotFound, resp.Code)
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+}
@@ -0,0 +1,289 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+)
+
+var (
+	// ErrJobNotFound is returned when a job is not known to the manager.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when a job that already finished is canceled.
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// defaultMaxFinished is the number of finished jobs kept by default.
+const defaultMaxFinished = 100
+
+// errInterrupted is the error of jobs that were running when rcond stopped.
+const errInterrupted = "interrupted by a restart of rcond"
+
+// Job states
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Progress describes how far a job has come.
+type Progress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Message string `json:"message,omitempty"`
+}
+
+// Job is a long running operation executed in the background.
+type Job struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Status    string      `json:"status"`
+	Progress  Progress    `json:"progress"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Scope     string      `json:"scope,omitempty"`
+	CreatedBy string      `json:"created_by,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// ReportFunc updates the progress and the intermediate result of a running job.
+type ReportFunc func(progress Progress, result interface{})
+
+// Func is the work of a job. The returned result is stored on the job,
+// an error marks the job as failed. The context is canceled when the job is canceled.
+type Func func(ctx context.Context, report ReportFunc) (interface{}, error)
+
+// Manager runs jobs and keeps track of their state.
+// If a file is configured, jobs are persisted to it on every change, so their results
+// are kept across restarts. Jobs that were running when rcond stopped are marked as failed.
+type Manager struct {
+	mu          sync.RWMutex
+	jobs        map[string]*Job
+	cancels     map[string]context.CancelFunc
+	path        string
+	maxFinished int
+}
+
+// NewManager creates a job manager and loads the jobs of the configured file.
+func NewManager(cfg *config.JobsConfig) (*Manager, error) {
+	m := &Manager{
+		jobs:        make(map[string]*Job),
+		cancels:     make(map[string]context.CancelFunc),
+		path:        cfg.File,
+		maxFinished: cfg.MaxFinished,
+	}
+	if m.maxFinished <= 0 {
+		m.maxFinished = defaultMaxFinished
+	}
+	if err := m.load(); err != nil {
+		return nil, fmt.Errorf("failed to load jobs from %s: %w", m.path, err)
+	}
+	return m, nil
+}
+
+// Start runs fn in the background as a job of the given type and returns the created job.
+func (m *Manager) Start(kind string, fn Func) (Job, error) {
+	return m.Run(Job{Type: kind}, fn)
+}
+
+// Run runs fn in the background and returns the created job.
+// The type, scope and creator are taken from j, the other fields are set by the manager.
+func (m *Manager) Run(j Job, fn Func) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now().UTC()
+	created := &Job{
+		ID:        id,
+		Type:      j.Type,
+		Status:    StatusRunning,
+		Scope:     j.Scope,
+		CreatedBy: j.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.jobs[id] = created
+	m.cancels[id] = cancel
+	m.prune()
+	m.save()
+	started := *created
+	m.mu.Unlock()
+
+	go m.run(ctx, created, fn)
+	return started, nil
+}
+
+func (m *Manager) run(ctx context.Context, j *Job, fn Func) {
+	report := func(progress Progress, result interface{}) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j.Progress = progress
+		if result != nil {
+			j.Result = result
+		}
+		j.UpdatedAt = time.Now().UTC()
+		m.save()
+	}
+	result, err := fn(ctx, report)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if result != nil {
+		j.Result = result
+	}
+	j.Status = StatusSucceeded
+	if err != nil {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+	}
+	if ctx.Err() != nil {
+		j.Status = StatusCanceled
+	}
+	j.UpdatedAt = time.Now().UTC()
+	m.cancels[j.ID]()
+	delete(m.cancels, j.ID)
+	m.save()
+}
+
+// Cancel cancels the context of a running job and returns it.
+// The job is marked as canceled once its work returned.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	cancel, ok := m.cancels[id]
+	if !ok {
+		return *j, ErrJobFinished
+	}
+	cancel()
+	return *j, nil
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *j, nil
+}
+
+// List returns all known jobs of the given type, newest first.
+// An empty type returns jobs of every type.
+func (m *Manager) List(kind string) []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := []Job{}
+	for _, j := range m.jobs {
+		if kind == "" || j.Type == kind {
+			jobs = append(jobs, *j)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.After(jobs[k].CreatedAt) })
+	return jobs
+}
+
+// prune removes the oldest finished jobs once more than the configured number are kept.
+func (m *Manager) prune() {
+	var finished []*Job
+	for _, j := range m.jobs {
+		if j.Status != StatusRunning {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= m.maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].UpdatedAt.Before(finished[k].UpdatedAt) })
+	for _, j := range finished[:len(finished)-m.maxFinished] {
+		delete(m.jobs, j.ID)
+	}
+}
+
+// load reads the jobs of the job file. Jobs that were still running are marked as failed.
+func (m *Manager) load() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return err
+	}
+	for _, j := range jobs {
+		if j.Status == StatusRunning {
+			j.Status = StatusFailed
+			j.Error = errInterrupted
+			j.UpdatedAt = time.Now().UTC()
+		}
+		m.jobs[j.ID] = j
+	}
+	m.prune()
+	return nil
+}
+
+// save writes the jobs to the job file. The caller must hold the lock.
+// Failures are logged, the jobs are kept in memory.
+func (m *Manager) save() {
+	if m.path == "" {
+		return
+	}
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.Before(jobs[k].CreatedAt) })
+	if err := writeFile(m.path, jobs); err != nil {
+		log.Printf("[WARN] Failed to save jobs to %s: %v", m.path, err)
+	}
+}
+
+func writeFile(path string, jobs []*Job) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
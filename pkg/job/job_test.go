@@ -0,0 +1,145 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T, cfg config.JobsConfig) *Manager {
+	t.Helper()
+	m, err := NewManager(&cfg)
+	require.NoError(t, err)
+	return m
+}
+
+func waitFinished(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	var j Job
+	require.Eventually(t, func() bool {
+		var err error
+		j, err = m.Get(id)
+		require.NoError(t, err)
+		return j.Status != StatusRunning
+	}, time.Second, 10*time.Millisecond)
+	return j
+}
+
+func TestManagerStart(t *testing.T) {
+	m := newManager(t, config.JobsConfig{})
+	release := make(chan struct{})
+	j, err := m.Start("test", func(ctx context.Context, report ReportFunc) (interface{}, error) {
+		report(Progress{Done: 1, Total: 2, Message: "halfway"}, nil)
+		<-release
+		return "done", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, j.Status)
+
+	require.Eventually(t, func() bool {
+		got, _ := m.Get(j.ID)
+		return got.Progress.Done == 1
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	got := waitFinished(t, m, j.ID)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	assert.Equal(t, "done", got.Result)
+	assert.Equal(t, "halfway", got.Progress.Message)
+}
+
+func TestManagerFailedJob(t *testing.T) {
+	m := newManager(t, config.JobsConfig{})
+	j, err := m.Start("test", func(ctx context.Context, report ReportFunc) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	require.NoError(t, err)
+	got := waitFinished(t, m, j.ID)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, "boom", got.Error)
+
+	_, err = m.Get("missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManagerList(t *testing.T) {
+	m := newManager(t, config.JobsConfig{})
+	noop := func(ctx context.Context, report ReportFunc) (interface{}, error) { return nil, nil }
+	a, _ := m.Start("a", noop)
+	b, _ := m.Start("b", noop)
+	waitFinished(t, m, a.ID)
+	waitFinished(t, m, b.ID)
+
+	assert.Len(t, m.List(""), 2)
+	jobs := m.List("a")
+	require.Len(t, jobs, 1)
+	assert.Equal(t, a.ID, jobs[0].ID)
+}
+
+func TestManagerCancel(t *testing.T) {
+	m := newManager(t, config.JobsConfig{})
+	j, err := m.Start("test", func(ctx context.Context, report ReportFunc) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+
+	_, err = m.Cancel(j.ID)
+	require.NoError(t, err)
+	got := waitFinished(t, m, j.ID)
+	assert.Equal(t, StatusCanceled, got.Status)
+	assert.Equal(t, context.Canceled.Error(), got.Error)
+
+	_, err = m.Cancel(j.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+	_, err = m.Cancel("missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManagerPersist(t *testing.T) {
+	cfg := config.JobsConfig{File: filepath.Join(t.TempDir(), "jobs.json")}
+	m := newManager(t, cfg)
+	done, err := m.Run(Job{Type: "test", Scope: "network:write", CreatedBy: "ci"}, func(ctx context.Context, report ReportFunc) (interface{}, error) {
+		return map[string]string{"uuid": "7d706027"}, nil
+	})
+	require.NoError(t, err)
+	waitFinished(t, m, done.ID)
+	running, err := m.Start("test", func(ctx context.Context, report ReportFunc) (interface{}, error) {
+		<-ctx.Done()
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	reloaded := newManager(t, cfg)
+	got, err := reloaded.Get(done.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	assert.Equal(t, "ci", got.CreatedBy)
+	assert.Equal(t, map[string]interface{}{"uuid": "7d706027"}, got.Result)
+
+	got, err = reloaded.Get(running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, errInterrupted, got.Error)
+
+	_, err = m.Cancel(running.ID)
+	require.NoError(t, err)
+	waitFinished(t, m, running.ID)
+}
+
+func TestManagerPrune(t *testing.T) {
+	m := newManager(t, config.JobsConfig{MaxFinished: 2})
+	noop := func(ctx context.Context, report ReportFunc) (interface{}, error) { return nil, nil }
+	for i := 0; i < 4; i++ {
+		j, err := m.Start("test", noop)
+		require.NoError(t, err)
+		waitFinished(t, m, j.ID)
+	}
+	assert.Len(t, m.List(""), 3, "finished jobs are pruned when a job is started")
+}
@@ -0,0 +1,275 @@
+// Package metrics collects counters and histograms and writes them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default buckets of histograms, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry of the metrics of the packages of rcond.
+var Default = NewRegistry()
+
+// family is a metric with all its label values.
+type family interface {
+	write(w *Writer)
+}
+
+// Registry holds the metrics that are updated while rcond runs.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounterVec registers a counter with the label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: make(map[string]*counter)}
+	r.register(c)
+	return c
+}
+
+// NewHistogramVec registers a histogram with the upper bounds of its buckets and the label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+	r.register(h)
+	return h
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// Collect writes the current values of the registered metrics.
+func (r *Registry) Collect(w *Writer) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*counter
+}
+
+type counter struct {
+	values []string
+	value  float64
+}
+
+// Inc increments the counter of the label values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter of the label values. The values are given in the order of the label names.
+func (c *CounterVec) Add(v float64, values ...string) {
+	checkLabels(c.name, c.labels, values)
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counter{values: append([]string(nil), values...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		w.Counter(c.name, c.help, s.value, pairs(c.labels, s.values)...)
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	checkLabels(h.name, h.labels, values)
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		labels := pairs(h.labels, s.values)
+		w.header(h.name, h.help, "histogram")
+		for i, bound := range h.buckets {
+			w.sample(h.name+"_bucket", append(labels, "le", formatValue(bound)), float64(s.counts[i]))
+		}
+		w.sample(h.name+"_bucket", append(labels, "le", "+Inf"), float64(s.count))
+		w.sample(h.name+"_sum", labels, s.sum)
+		w.sample(h.name+"_count", labels, float64(s.count))
+	}
+}
+
+// Writer writes metrics in the text exposition format.
+// The samples of a metric must be written one after another, the help and type
+// are written before its first sample.
+type Writer struct {
+	w    io.Writer
+	last string
+	err  error
+}
+
+// NewWriter creates a writer of the text exposition format.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Gauge writes the sample of a gauge. Labels are given as name and value pairs.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.header(name, help, "gauge")
+	w.sample(name, labels, value)
+}
+
+// Counter writes the sample of a counter. Labels are given as name and value pairs.
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.header(name, help, "counter")
+	w.sample(name, labels, value)
+}
+
+// Err returns the first error that occurred while writing.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) header(name, help, kind string) {
+	if w.last == name {
+		return
+	}
+	w.last = name
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func (w *Writer) sample(name string, labels []string, value float64) {
+	if len(labels) == 0 {
+		w.printf("%s %s\n", name, formatValue(value))
+		return
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+	}
+	w.printf("%s{%s} %s\n", name, b.String(), formatValue(value))
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// pairs zips label names and values to name and value pairs.
+func pairs(names, values []string) []string {
+	labels := make([]string, 0, 2*len(names))
+	for i, name := range names {
+		labels = append(labels, name, values[i])
+	}
+	return labels
+}
+
+func checkLabels(name string, labels, values []string) {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", name, len(labels), len(values)))
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("http_requests_total", "Handled requests.", "route", "code")
+	latency := r.NewHistogramVec("http_request_duration_seconds", "Request latency.", []float64{1, 0.1}, "route")
+	requests.Inc("/hostname", "200")
+	requests.Add(2, "/hostname", "500")
+	requests.Inc("/health", "200")
+	latency.Observe(0.05, "/hostname")
+	latency.Observe(0.5, "/hostname")
+
+	var b strings.Builder
+	w := NewWriter(&b)
+	r.Collect(w)
+	require.NoError(t, w.Err())
+	assert.Equal(t, `# HELP http_requests_total Handled requests.
+# TYPE http_requests_total counter
+http_requests_total{route="/health",code="200"} 1
+http_requests_total{route="/hostname",code="200"} 1
+http_requests_total{route="/hostname",code="500"} 2
+# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/hostname",le="0.1"} 1
+http_request_duration_seconds_bucket{route="/hostname",le="1"} 2
+http_request_duration_seconds_bucket{route="/hostname",le="+Inf"} 2
+http_request_duration_seconds_sum{route="/hostname"} 0.55
+http_request_duration_seconds_count{route="/hostname"} 2
+`, b.String())
+
+	assert.Panics(t, func() { requests.Inc("/health") })
+}
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Gauge("members", "Cluster members\nby status.", 2, "status", "alive")
+	w.Gauge("members", "Cluster members\nby status.", 0, "status", "failed")
+	w.Gauge("device", "Device.", 100, "interface", `wl"an\0`)
+	w.Gauge("uptime_seconds", "Uptime.", 12.5)
+	require.NoError(t, w.Err())
+	assert.Equal(t, `# HELP members Cluster members\nby status.
+# TYPE members gauge
+members{status="alive"} 2
+members{status="failed"} 0
+# HELP device Device.
+# TYPE device gauge
+device{interface="wl\"an\\0"} 100
+# HELP uptime_seconds Uptime.
+# TYPE uptime_seconds gauge
+uptime_seconds 12.5
+`, b.String())
+}
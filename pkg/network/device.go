@@ -0,0 +1,176 @@
+package network
+
+import (
+	"github.com/0x1d/rcond/pkg/util"
+	"github.com/godbus/dbus/v5"
+)
+
+// Device is a network device known to NetworkManager.
+type Device struct {
+	Interface string `json:"interface"`
+	Type      string `json:"type"`
+	State     string `json:"state"`
+	// StateCode is the NMDeviceState of the device, 100 if it is activated.
+	StateCode uint32 `json:"state_code"`
+	// Strength is the signal quality of the access point of a connected WiFi device in percent.
+	Strength *uint8 `json:"strength,omitempty"`
+}
+
+// deviceTypes are the names of the NMDeviceType values.
+var deviceTypes = map[uint32]string{
+	1:  "ethernet",
+	2:  "wifi",
+	5:  "bluetooth",
+	8:  "modem",
+	10: "bond",
+	11: "vlan",
+	13: "bridge",
+	14: "generic",
+	16: "tun",
+	29: "wireguard",
+	30: "wifi-p2p",
+	32: "loopback",
+}
+
+// deviceStates are the names of the NMDeviceState values.
+var deviceStates = map[uint32]string{
+	10:  "unmanaged",
+	20:  "unavailable",
+	30:  "disconnected",
+	40:  "prepare",
+	50:  "config",
+	60:  "need-auth",
+	70:  "ip-config",
+	80:  "ip-check",
+	90:  "secondaries",
+	100: "activated",
+	110: "deactivating",
+	120: "failed",
+}
+
+// nmStates are the names of the NMState values.
+var nmStates = map[uint32]string{
+	10: "asleep",
+	20: "disconnected",
+	30: "disconnecting",
+	40: "connecting",
+	50: "connected-local",
+	60: "connected-site",
+	70: "connected-global",
+}
+
+const deviceTypeWifi = 2
+
+func deviceType(code uint32) string {
+	if name, ok := deviceTypes[code]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func deviceState(code uint32) string {
+	if name, ok := deviceStates[code]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Devices returns the network devices with their state and, for connected WiFi devices,
+// the signal strength of the access point.
+func Devices() ([]Device, error) {
+	devices := []Device{}
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		nmObj := conn.Object(
+			"org.freedesktop.NetworkManager",
+			"/org/freedesktop/NetworkManager",
+		)
+		var paths []dbus.ObjectPath
+		if err := nmObj.Call("org.freedesktop.NetworkManager.GetAllDevices", 0).Store(&paths); err != nil {
+			return callError("GetAllDevices", err)
+		}
+		for _, p := range paths {
+			obj := conn.Object("org.freedesktop.NetworkManager", p)
+			var d Device
+			var typeCode uint32
+			if err := storeProperty(obj, "org.freedesktop.NetworkManager.Device.Interface", &d.Interface); err != nil {
+				continue
+			}
+			storeProperty(obj, "org.freedesktop.NetworkManager.Device.DeviceType", &typeCode)
+			storeProperty(obj, "org.freedesktop.NetworkManager.Device.State", &d.StateCode)
+			d.Type = deviceType(typeCode)
+			d.State = deviceState(d.StateCode)
+			if typeCode == deviceTypeWifi {
+				d.Strength = accessPointStrength(conn, obj)
+			}
+			devices = append(devices, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// accessPointStrength returns the signal strength of the active access point of a WiFi device.
+func accessPointStrength(conn *dbus.Conn, device dbus.BusObject) *uint8 {
+	var apPath dbus.ObjectPath
+	if err := storeProperty(device, "org.freedesktop.NetworkManager.Device.Wireless.ActiveAccessPoint", &apPath); err != nil || apPath == "/" {
+		return nil
+	}
+	var strength uint8
+	ap := conn.Object("org.freedesktop.NetworkManager", apPath)
+	if err := storeProperty(ap, "org.freedesktop.NetworkManager.AccessPoint.Strength", &strength); err != nil {
+		return nil
+	}
+	return &strength
+}
+
+// ActiveConnections returns the number of active connections.
+func ActiveConnections() (int, error) {
+	var count int
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		nmObj := conn.Object(
+			"org.freedesktop.NetworkManager",
+			"/org/freedesktop/NetworkManager",
+		)
+		var paths []dbus.ObjectPath
+		if err := storeProperty(nmObj, "org.freedesktop.NetworkManager.ActiveConnections", &paths); err != nil {
+			return callError("Properties.Get(ActiveConnections)", err)
+		}
+		count = len(paths)
+		return nil
+	})
+	return count, err
+}
+
+// State returns the overall connection state of NetworkManager,
+// or an error wrapping util.ErrUnavailable if it is not running.
+func State() (string, error) {
+	var code uint32
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		nmObj := conn.Object(
+			"org.freedesktop.NetworkManager",
+			"/org/freedesktop/NetworkManager",
+		)
+		if err := storeProperty(nmObj, "org.freedesktop.NetworkManager.State", &code); err != nil {
+			return callError("Properties.Get(State)", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if name, ok := nmStates[code]; ok {
+		return name, nil
+	}
+	return "unknown", nil
+}
+
+func storeProperty(obj dbus.BusObject, name string, value interface{}) error {
+	variant, err := obj.GetProperty(name)
+	if err != nil {
+		return err
+	}
+	return dbus.Store([]interface{}{variant.Value()}, value)
+}
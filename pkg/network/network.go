@@ -1,6 +1,8 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,6 +18,34 @@ var (
 	defaultPassword = "raspberry"
 )
 
+// Errors returned for unknown connections and devices, and for changes that conflict
+// with the state of a device or connection.
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrDeviceNotFound     = errors.New("device not found")
+	ErrConflict           = errors.New("conflicts with the state of the device or connection")
+)
+
+// nmErrors maps the D-Bus errors of NetworkManager to the errors of this package.
+var nmErrors = map[string]error{
+	"org.freedesktop.NetworkManager.UnknownConnection":             ErrConnectionNotFound,
+	"org.freedesktop.NetworkManager.UnknownDevice":                 ErrDeviceNotFound,
+	"org.freedesktop.NetworkManager.ConnectionNotAvailable":        ErrConflict,
+	"org.freedesktop.NetworkManager.ConnectionAlreadyActive":       ErrConflict,
+	"org.freedesktop.NetworkManager.ConnectionNotActive":           ErrConflict,
+	"org.freedesktop.NetworkManager.Device.NotActive":              ErrConflict,
+	"org.freedesktop.NetworkManager.Device.IncompatibleConnection": ErrConflict,
+}
+
+// callError wraps the error of a failed NetworkManager call,
+// adding the matching error of this package if there is one.
+func callError(call string, err error) error {
+	if target, ok := nmErrors[util.ErrorName(err)]; ok {
+		return fmt.Errorf("%s failed: %w: %w", call, target, err)
+	}
+	return fmt.Errorf("%s failed: %w", call, err)
+}
+
 // ConnectionConfig holds the configuration for a NetworkManager connection
 type ConnectionConfig struct {
 	Type        string
@@ -32,6 +62,19 @@ type ConnectionConfig struct {
 	IPv6Method  string
 }
 
+// Connection is a NetworkManager connection profile.
+type Connection struct {
+	UUID        string `json:"uuid"`
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Interface   string `json:"interface,omitempty"`
+	AutoConnect bool   `json:"autoconnect"`
+	SSID        string `json:"ssid,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+	Active      bool   `json:"active"`
+	Device      string `json:"device,omitempty"`
+}
+
 func DefaultSTAConfig(uuid uuid.UUID, ssid string, password string, autoconnect bool) *ConnectionConfig {
 	return &ConnectionConfig{
 		Type:        "802-11-wireless",
@@ -67,9 +110,9 @@ func DefaultAPConfig(uuid uuid.UUID, ssid string, password string, autoconnect b
 
 // ActivateConnection activates a NetworkManager connection profile.
 // It takes a D-Bus connection, connection profile path, and device path as arguments.
-// The function waits up to 10 seconds for the connection to become active.
+// The function waits up to 10 seconds for the connection to become active, or until ctx is done.
 // Returns an error if activation fails or times out.
-func ActivateConnection(conn *dbus.Conn, connPath, devPath dbus.ObjectPath) error {
+func ActivateConnection(ctx context.Context, conn *dbus.Conn, connPath, devPath dbus.ObjectPath) error {
 	nmObj := conn.Object(
 		"org.freedesktop.NetworkManager",
 		"/org/freedesktop/NetworkManager",
@@ -82,7 +125,7 @@ func ActivateConnection(conn *dbus.Conn, connPath, devPath dbus.ObjectPath) erro
 			connPath, devPath, dbus.ObjectPath("/")).
 		Store(&activePath)
 	if err != nil {
-		return fmt.Errorf("ActivateConnection failed: %v", err)
+		return callError("ActivateConnection", err)
 	}
 
 	// Wait until the connection is activated
@@ -100,13 +143,17 @@ func ActivateConnection(conn *dbus.Conn, connPath, devPath dbus.ObjectPath) erro
 				"State").
 			Store(&stateVar)
 		if err != nil {
-			return fmt.Errorf("Properties.Get(State) failed: %v", err)
+			return callError("Properties.Get(State)", err)
 		}
 		if state, ok := stateVar.Value().(uint32); ok && state == 2 {
 			log.Printf("Connection activated on connection path %v", connPath)
 			return nil
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 	return fmt.Errorf("failed to activate connection")
 }
@@ -123,7 +170,7 @@ func DisconnectDevice(conn *dbus.Conn, devPath dbus.ObjectPath) error {
 		Call("org.freedesktop.NetworkManager.Device.Disconnect", 0).
 		Err
 	if err != nil {
-		return fmt.Errorf("Device.Disconnect failed: %v", err)
+		return callError("Device.Disconnect", err)
 	}
 	fmt.Println("Access point stopped")
 	return nil
@@ -141,7 +188,7 @@ func DeleteConnection(conn *dbus.Conn, connPath dbus.ObjectPath) error {
 		Call("org.freedesktop.NetworkManager.Settings.Connection.Delete", 0).
 		Err
 	if err != nil {
-		return fmt.Errorf("Connection.Delete failed: %v", err)
+		return callError("Connection.Delete", err)
 	}
 	log.Printf("Connection removed: %v", connPath)
 	return nil
@@ -190,7 +237,7 @@ func GetConnectionPath(conn *dbus.Conn, connUUID string) (dbus.ObjectPath, error
 		Call("org.freedesktop.NetworkManager.Settings.ListConnections", 0).
 		Store(&paths)
 	if err != nil {
-		return "", fmt.Errorf("ListConnections failed: %v", err)
+		return "", callError("ListConnections", err)
 	}
 
 	// Look up our connection by UUID
@@ -239,7 +286,7 @@ func AddStationConnection(conn *dbus.Conn, uuid uuid.UUID, ssid string, password
 func AddConnectionWithConfig(conn *dbus.Conn, cfg *ConnectionConfig) (dbus.ObjectPath, error) {
 
 	// check of connection already exists and return existing connection path
-	if existingObjectPath, err := GetConnectionPath(conn, cfg.UUID); err == nil {
+	if existingObjectPath, err := GetConnectionPath(conn, cfg.UUID); err == nil && existingObjectPath != "" {
 		return existingObjectPath, nil
 	}
 
@@ -293,12 +340,111 @@ func AddConnectionWithConfig(conn *dbus.Conn, cfg *ConnectionConfig) (dbus.Objec
 		Call("org.freedesktop.NetworkManager.Settings.AddConnection", 0, settingsMap).
 		Store(&connPath)
 	if err != nil {
-		return "", fmt.Errorf("AddConnection failed: %v", err)
+		return "", callError("AddConnection", err)
 	}
 
 	return connPath, nil
 }
 
+// ListConnections returns the NetworkManager connection profiles.
+// Active connections are marked with the interface of the device they are active on.
+func ListConnections() ([]Connection, error) {
+	connections := []Connection{}
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		settingsObj := conn.Object(
+			"org.freedesktop.NetworkManager",
+			"/org/freedesktop/NetworkManager/Settings",
+		)
+		var paths []dbus.ObjectPath
+		err := settingsObj.
+			Call("org.freedesktop.NetworkManager.Settings.ListConnections", 0).
+			Store(&paths)
+		if err != nil {
+			return callError("ListConnections", err)
+		}
+
+		active, err := activeDevices(conn)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			var cfg map[string]map[string]dbus.Variant
+			err := conn.Object("org.freedesktop.NetworkManager", p).
+				Call("org.freedesktop.NetworkManager.Settings.Connection.GetSettings", 0).
+				Store(&cfg)
+			if err != nil {
+				continue
+			}
+			c := connectionFromSettings(cfg)
+			if device, ok := active[c.UUID]; ok {
+				c.Active = true
+				c.Device = device
+			}
+			connections = append(connections, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// activeDevices returns the interface names of the active connections by connection UUID.
+func activeDevices(conn *dbus.Conn) (map[string]string, error) {
+	nmObj := conn.Object(
+		"org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager",
+	)
+	variant, err := nmObj.GetProperty("org.freedesktop.NetworkManager.ActiveConnections")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active connections: %w", err)
+	}
+	paths, _ := variant.Value().([]dbus.ObjectPath)
+	active := make(map[string]string)
+	for _, p := range paths {
+		obj := conn.Object("org.freedesktop.NetworkManager", p)
+		uuidVariant, err := obj.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Uuid")
+		if err != nil {
+			continue
+		}
+		uuid, _ := uuidVariant.Value().(string)
+		device := ""
+		if devicesVariant, err := obj.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Devices"); err == nil {
+			if devices, ok := devicesVariant.Value().([]dbus.ObjectPath); ok && len(devices) > 0 {
+				ifaceVariant, err := conn.Object("org.freedesktop.NetworkManager", devices[0]).
+					GetProperty("org.freedesktop.NetworkManager.Device.Interface")
+				if err == nil {
+					device, _ = ifaceVariant.Value().(string)
+				}
+			}
+		}
+		active[uuid] = device
+	}
+	return active, nil
+}
+
+// connectionFromSettings extracts a connection from its NetworkManager settings.
+// Secrets are not part of the settings returned by GetSettings.
+func connectionFromSettings(cfg map[string]map[string]dbus.Variant) Connection {
+	c := Connection{AutoConnect: true}
+	settings := cfg["connection"]
+	c.UUID, _ = settings["uuid"].Value().(string)
+	c.ID, _ = settings["id"].Value().(string)
+	c.Type, _ = settings["type"].Value().(string)
+	c.Interface, _ = settings["interface-name"].Value().(string)
+	if v, ok := settings["autoconnect"].Value().(bool); ok {
+		c.AutoConnect = v
+	}
+	if wireless, ok := cfg["802-11-wireless"]; ok {
+		if ssid, ok := wireless["ssid"].Value().([]byte); ok {
+			c.SSID = string(ssid)
+		}
+		c.Mode, _ = wireless["mode"].Value().(string)
+	}
+	return c
+}
+
 // GetDeviceByIpIface looks up a NetworkManager device by its interface name.
 // Takes a D-Bus connection and interface name string as arguments.
 // Returns the D-Bus object path of the device.
@@ -316,7 +462,7 @@ func GetDeviceByIpIface(conn *dbus.Conn, iface string) (dbus.ObjectPath, error)
 		Call("org.freedesktop.NetworkManager.GetDeviceByIpIface", 0, iface).
 		Store(&devPath)
 	if err != nil {
-		return "", fmt.Errorf("GetDeviceByIpIface(%s) failed: %v", iface, err)
+		return "", callError(fmt.Sprintf("GetDeviceByIpIface(%s)", iface), err)
 	}
 
 	return devPath, nil
@@ -358,7 +504,7 @@ func ConfigureSTA(iface string, ssid string, password string, autoconnect bool)
 	err := util.WithConnection(func(conn *dbus.Conn) error {
 		_, err := AddStationConnection(conn, uuid, ssid, password, autoconnect)
 		if err != nil {
-			return fmt.Errorf("failed to create station connection: %v", err)
+			return fmt.Errorf("failed to create station connection: %w", err)
 		}
 		return nil
 	})
@@ -380,7 +526,7 @@ func ConfigureAP(iface string, ssid string, password string, autoconnect bool) (
 	err := util.WithConnection(func(conn *dbus.Conn) error {
 		_, err := AddAccessPointConnection(conn, uuid, ssid, password, autoconnect)
 		if err != nil {
-			return fmt.Errorf("failed to create access point connection: %v", err)
+			return fmt.Errorf("failed to create access point connection: %w", err)
 		}
 		return nil
 	})
@@ -396,8 +542,9 @@ func ConfigureAP(iface string, ssid string, password string, autoconnect bool) (
 // It takes the interface name and UUID as arguments.
 // The connection with the given UUID must exist.
 // The connection will be activated on the specified interface.
+// Waiting for the activation stops once ctx is done.
 // Returns an error if any operation fails.
-func Up(iface string, uuid string) error {
+func Up(ctx context.Context, iface string, uuid string) error {
 	return util.WithConnection(func(conn *dbus.Conn) error {
 		connPath, err := GetConnectionPath(conn, uuid)
 		if err != nil {
@@ -405,7 +552,7 @@ func Up(iface string, uuid string) error {
 		}
 
 		if connPath == "" {
-			return fmt.Errorf("connection with UUID %s not found", uuid)
+			return fmt.Errorf("%w: %s", ErrConnectionNotFound, uuid)
 		}
 
 		log.Printf("Getting device path for interface %s", iface)
@@ -416,7 +563,7 @@ func Up(iface string, uuid string) error {
 		}
 		log.Printf("Got device path %s for interface %s", devPath, iface)
 
-		if err := ActivateConnection(conn, connPath, devPath); err != nil {
+		if err := ActivateConnection(ctx, conn, connPath, devPath); err != nil {
 			return err
 		}
 
@@ -443,8 +590,8 @@ func Down(iface string) error {
 }
 
 // Remove deletes a NetworkManager connection profile with the given UUID.
-// If no connection with the UUID exists, it returns nil.
-// Returns an error if the connection exists but cannot be deleted.
+// Returns ErrConnectionNotFound if no connection with the UUID exists,
+// or an error if the connection exists but cannot be deleted.
 func Remove(uuid string) error {
 	return util.WithConnection(func(conn *dbus.Conn) error {
 		connPath, err := GetConnectionPath(conn, uuid)
@@ -453,7 +600,7 @@ func Remove(uuid string) error {
 		}
 
 		if connPath == "" {
-			return nil
+			return fmt.Errorf("%w: %s", ErrConnectionNotFound, uuid)
 		}
 
 		if err := DeleteConnection(conn, connPath); err != nil {
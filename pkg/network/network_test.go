@@ -3,6 +3,7 @@ package network
 import (
 	"testing"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,3 +25,29 @@ func TestDefaultAPConfig(t *testing.T) {
 	assert.Equal(t, "test", cfg.SSID)
 	assert.Equal(t, true, cfg.AutoConnect)
 }
+
+func TestConnectionFromSettings(t *testing.T) {
+	c := connectionFromSettings(map[string]map[string]dbus.Variant{
+		"connection": {
+			"uuid":           dbus.MakeVariant("7d1c6d8e-0000-4000-8000-000000000000"),
+			"id":             dbus.MakeVariant("home"),
+			"type":           dbus.MakeVariant("802-11-wireless"),
+			"interface-name": dbus.MakeVariant("wlan0"),
+		},
+		"802-11-wireless": {
+			"ssid": dbus.MakeVariant([]byte("HomeWiFi")),
+			"mode": dbus.MakeVariant("infrastructure"),
+		},
+	})
+	assert.Equal(t, "home", c.ID)
+	assert.Equal(t, "wlan0", c.Interface)
+	assert.Equal(t, "HomeWiFi", c.SSID)
+	assert.Equal(t, "infrastructure", c.Mode)
+	assert.True(t, c.AutoConnect, "autoconnect defaults to true")
+
+	c = connectionFromSettings(map[string]map[string]dbus.Variant{
+		"connection": {"type": dbus.MakeVariant("802-3-ethernet"), "autoconnect": dbus.MakeVariant(false)},
+	})
+	assert.False(t, c.AutoConnect)
+	assert.Empty(t, c.SSID)
+}
@@ -0,0 +1,254 @@
+// Package openapi validates requests and responses against the OpenAPI spec in api/rcond.yaml.
+// The schemas of the spec are converted to pkg/schema schemas, objects that list their
+// properties are closed, so unknown fields are rejected.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	spec "github.com/0x1d/rcond/api"
+	"github.com/0x1d/rcond/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth limits the nesting of resolved $ref, deeper references are treated as any value.
+const maxRefDepth = 32
+
+// methods are the operations of a path item, in the order they are listed.
+var methods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch, http.MethodHead, http.MethodOptions}
+
+// schemaKeys are the keywords of a spec schema that are understood by pkg/schema.
+var schemaKeys = []string{"type", "description", "properties", "required", "additionalProperties", "items", "enum", "minLength", "maxLength", "minimum", "maximum", "pattern"}
+
+// Spec holds the operations of an OpenAPI document.
+type Spec struct {
+	data       []byte
+	operations map[string]*Operation
+}
+
+// Operation is a method of a documented path.
+type Operation struct {
+	Method string
+	Path   string
+	// Body is the schema of the JSON request body, nil if the operation takes none.
+	Body         *schema.Schema
+	BodyRequired bool
+	// Responses are the schemas of the JSON responses by status code, "default" included.
+	Responses map[string]*schema.Schema
+}
+
+// Load parses the embedded spec of the rcond API.
+func Load() (*Spec, error) {
+	return Parse(spec.Spec)
+}
+
+// Parse parses a YAML or JSON encoded OpenAPI document.
+func Parse(data []byte) (*Spec, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("invalid spec: no paths")
+	}
+	s := &Spec{data: data, operations: make(map[string]*Operation)}
+	for path, item := range paths {
+		item, _ := resolve(doc, item, 0).(map[string]interface{})
+		for _, method := range methods {
+			raw, ok := item[strings.ToLower(method)].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			op, err := parseOperation(doc, method, path, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid spec: %s %s: %v", method, path, err)
+			}
+			s.operations[method+" "+path] = op
+		}
+	}
+	return s, nil
+}
+
+func parseOperation(doc map[string]interface{}, method, path string, raw map[string]interface{}) (*Operation, error) {
+	op := &Operation{Method: method, Path: path, Responses: make(map[string]*schema.Schema)}
+	if body, ok := resolve(doc, raw["requestBody"], 0).(map[string]interface{}); ok {
+		op.BodyRequired, _ = body["required"].(bool)
+		if raw, ok := jsonSchema(body); ok {
+			s, err := convert(doc, raw)
+			if err != nil {
+				return nil, fmt.Errorf("request body: %v", err)
+			}
+			op.Body = s
+		}
+	}
+	responses, _ := raw["responses"].(map[string]interface{})
+	for code, resp := range responses {
+		resp, _ := resolve(doc, resp, 0).(map[string]interface{})
+		raw, ok := jsonSchema(resp)
+		if !ok {
+			continue
+		}
+		s, err := convert(doc, raw)
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %v", code, err)
+		}
+		op.Responses[code] = s
+	}
+	return op, nil
+}
+
+// jsonSchema returns the schema of the application/json content of a request body or response.
+func jsonSchema(v map[string]interface{}) (interface{}, bool) {
+	content, _ := v["content"].(map[string]interface{})
+	media, _ := content["application/json"].(map[string]interface{})
+	s, ok := media["schema"]
+	return s, ok
+}
+
+// YAML returns the document the spec was parsed from.
+func (s *Spec) YAML() []byte {
+	return s.data
+}
+
+// Operation returns the operation of a method and a path template like /users/{user}/keys,
+// nil if it is not documented.
+func (s *Spec) Operation(method, path string) *Operation {
+	return s.operations[method+" "+path]
+}
+
+// Operations returns every documented operation sorted by path and method.
+func (s *Spec) Operations() []*Operation {
+	ops := make([]*Operation, 0, len(s.operations))
+	for _, op := range s.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// ValidateRequest validates a JSON request body. Returns a *schema.ValidationError if it does not match.
+func (o *Operation) ValidateRequest(body []byte) error {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		if o.BodyRequired {
+			return &schema.ValidationError{Errors: []schema.FieldError{{Message: "request body is required"}}}
+		}
+		return nil
+	}
+	if o.Body == nil {
+		return nil
+	}
+	return o.Body.Validate(body)
+}
+
+// ValidateResponse validates a JSON response body against the response documented for the status code,
+// or the default response. Undocumented status codes and responses without a JSON schema are not checked.
+func (o *Operation) ValidateResponse(status int, body []byte) error {
+	s, ok := o.Responses[strconv.Itoa(status)]
+	if !ok {
+		s = o.Responses["default"]
+	}
+	if s == nil {
+		return nil
+	}
+	return s.Validate(body)
+}
+
+// resolve follows a $ref to the referenced value of the document.
+func resolve(doc map[string]interface{}, v interface{}, depth int) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return v
+	}
+	if depth >= maxRefDepth {
+		return map[string]interface{}{}
+	}
+	var target interface{} = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		node, _ := target.(map[string]interface{})
+		target = node[part]
+	}
+	return resolve(doc, target, depth+1)
+}
+
+// convert converts a spec schema to a pkg/schema schema.
+func convert(doc map[string]interface{}, v interface{}) (*schema.Schema, error) {
+	data, err := json.Marshal(normalize(doc, v, 0))
+	if err != nil {
+		return nil, err
+	}
+	return schema.Parse(data)
+}
+
+// normalize resolves references and merges allOf, keeping only the keywords known to pkg/schema.
+// Objects with properties are closed unless additionalProperties is set. A schema for
+// additionalProperties describes a map, its values are not checked.
+func normalize(doc map[string]interface{}, v interface{}, depth int) map[string]interface{} {
+	out := make(map[string]interface{})
+	if depth > maxRefDepth {
+		return out
+	}
+	m, _ := resolve(doc, v, 0).(map[string]interface{})
+	for _, key := range schemaKeys {
+		if val, ok := m[key]; ok {
+			out[key] = val
+		}
+	}
+	if all, ok := m["allOf"].([]interface{}); ok {
+		props := make(map[string]interface{})
+		var required []interface{}
+		for _, sub := range all {
+			sub := normalize(doc, sub, depth+1)
+			for k, v := range sub {
+				switch k {
+				case "properties":
+					for name, p := range v.(map[string]interface{}) {
+						props[name] = p
+					}
+				case "required":
+					required = append(required, v.([]interface{})...)
+				case "additionalProperties":
+				default:
+					out[k] = v
+				}
+			}
+		}
+		out["properties"] = props
+		if len(required) > 0 {
+			out["required"] = required
+		}
+		delete(out, "additionalProperties")
+	}
+	if props, ok := out["properties"].(map[string]interface{}); ok {
+		normalized := make(map[string]interface{}, len(props))
+		for name, p := range props {
+			normalized[name] = normalize(doc, p, depth+1)
+		}
+		out["properties"] = normalized
+		if _, ok := out["additionalProperties"]; !ok && len(props) > 0 {
+			out["additionalProperties"] = false
+		}
+	}
+	if _, ok := out["additionalProperties"].(bool); !ok {
+		delete(out, "additionalProperties")
+	}
+	if items, ok := out["items"]; ok {
+		out["items"] = normalize(doc, items, depth+1)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/api"
+	"github.com/0x1d/rcond/pkg/cluster"
+	"github.com/0x1d/rcond/pkg/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	s, err := Load()
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.Operations())
+	assert.NotEmpty(t, s.YAML())
+
+	op := s.Operation(http.MethodPost, "/hostname")
+	require.NotNil(t, op)
+	assert.True(t, op.BodyRequired)
+	assert.NotNil(t, op.Body)
+	assert.Nil(t, s.Operation(http.MethodPatch, "/hostname"))
+}
+
+func TestValidateRequest(t *testing.T) {
+	s, err := Load()
+	require.NoError(t, err)
+	op := s.Operation(http.MethodPost, "/network/sta")
+	require.NotNil(t, op)
+
+	assert.NoError(t, op.ValidateRequest([]byte(`{"interface": "wlan0", "ssid": "lab", "password": "secret", "autoconnect": true}`)))
+
+	err = op.ValidateRequest([]byte(`{"interface": "wlan0", "password": 1, "channel": 6}`))
+	var validationErr *schema.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.ElementsMatch(t, []schema.FieldError{
+		{Field: "ssid", Message: "is required"},
+		{Field: "password", Message: "expected string, got number"},
+		{Field: "channel", Message: "unknown field"},
+	}, validationErr.Errors)
+
+	err = op.ValidateRequest(nil)
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "request body is required", validationErr.Errors[0].Message)
+}
+
+func TestValidateRefsAndAllOf(t *testing.T) {
+	s, err := Load()
+	require.NoError(t, err)
+
+	op := s.Operation(http.MethodPost, "/cluster/rolling-restart")
+	require.NotNil(t, op)
+	assert.NoError(t, op.ValidateRequest([]byte(`{"selector": {"tags": {"site": "lab"}}, "batch_size": 2}`)))
+	assert.Error(t, op.ValidateRequest([]byte(`{"selector": {"names": ["rpi-1"]}}`)))
+
+	op = s.Operation(http.MethodPost, "/tokens")
+	require.NotNil(t, op)
+	assert.NoError(t, op.ValidateResponse(http.StatusCreated, []byte(`{"name": "ci", "scopes": ["files:write"], "token": "secret"}`)))
+	assert.Error(t, op.ValidateResponse(http.StatusCreated, []byte(`{"name": "ci", "secret": "secret"}`)))
+	assert.NoError(t, op.ValidateResponse(http.StatusTeapot, []byte(`not checked`)))
+}
+
+// TestRequestTypes checks that the request bodies sent by pkg/client match the spec.
+func TestRequestTypes(t *testing.T) {
+	s, err := Load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPost, "/network/sta", api.ConfigureSTARequest{Interface: "wlan0", SSID: "lab", Password: "secret", Autoconnect: true}},
+		{http.MethodPost, "/network/ap", api.ConfigureAPRequest{Interface: "wlan0", SSID: "lab", Password: "secret", Autoconnect: true}},
+		{http.MethodPut, "/network/interface/{interface}", api.NetworkUpRequest{UUID: "7d706027-727c-4d4c-a816-f0e1b99db8ab"}},
+		{http.MethodPost, "/hostname", api.HostnameRequest{Hostname: "rpi-1"}},
+		{http.MethodPost, "/users/{user}/keys", api.AuthorizedKeyRequest{PubKey: "ssh-ed25519 AAAA test"}},
+		{http.MethodPost, "/system/file", api.FileUploadRequest{Path: "/etc/motd", Content: "aGVsbG8="}},
+		{http.MethodPost, "/tokens", api.CreateTokenRequest{Name: "ci", Scopes: []string{"files:write"}}},
+		{http.MethodPost, "/cluster/join", api.ClusterJoinRequest{Join: []string{"10.0.0.2"}}},
+		{http.MethodPost, "/cluster/event", api.ClusterEventRequest{Name: "printHostname", Payload: json.RawMessage(`{}`)}},
+		{http.MethodPost, "/cluster/keys", api.ClusterKeyRequest{Key: "T9jncgl9mbLus+baTTa7q7nPSUrXwbDi2dhbtqir37s=", Primary: true}},
+		{http.MethodPut, "/cluster/state/{key}", api.ClusterStateRequest{Kind: "hostname", Selector: api.Selector{Nodes: []string{"rpi-1"}}, Value: json.RawMessage(`{"hostname": "rpi-1"}`)}},
+		{http.MethodPost, "/cluster/rolling-restart", cluster.RollingRestartRequest{BatchSize: 1, WaitHealthy: true, Timeout: "5m"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			op := s.Operation(tt.method, tt.path)
+			require.NotNil(t, op)
+			body, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+			assert.NoError(t, op.ValidateRequest(body))
+		})
+	}
+}
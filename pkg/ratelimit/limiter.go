@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often idle keys are removed from a limiter.
+const pruneInterval = time.Minute
+
+// Limiter is a token bucket rate limiter per key, like a client IP or token name.
+// Each key may send burst requests at once and rate requests per second on average.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter that allows rate requests per second with the given burst.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the key.
+// If the bucket is empty, it returns false and the time until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Hour
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Wait returns the time until the bucket of the key has a token, without taking it.
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	tokens := math.Min(l.burst, b.tokens+l.now().Sub(b.last).Seconds()*l.rate)
+	if tokens >= 1 {
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// prune removes the buckets that refilled completely, they are equal to a new bucket.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
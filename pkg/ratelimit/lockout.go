@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Lockout locks out keys after repeated failures, like failed authentication attempts of a client IP.
+// After threshold failures, the key is locked for the base duration, which doubles with every
+// further failure up to max. Failures are only forgotten once max passed without failure, a success
+// does not reset them, so a client can not reset its count by authenticating in between.
+type Lockout struct {
+	threshold int
+	base      time.Duration
+	max       time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*lockoutEntry
+	lastPrune time.Time
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	until       time.Time
+}
+
+// NewLockout creates a lockout that locks keys after threshold failures.
+func NewLockout(threshold int, base, max time.Duration) *Lockout {
+	if max < base {
+		max = base
+	}
+	return &Lockout{
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		now:       time.Now,
+		entries:   map[string]*lockoutEntry{},
+	}
+}
+
+// Locked returns whether the key is locked and the remaining lockout time.
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return false, 0
+	}
+	if remaining := e.until.Sub(l.now()); remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+// Failure records a failure of the key and returns the lockout duration it caused, if any.
+func (l *Lockout) Failure(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.lastFailure) > l.max {
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures < l.threshold {
+		return 0
+	}
+	d := l.base
+	for i := l.threshold; i < e.failures && d < l.max; i++ {
+		d *= 2
+	}
+	if d > l.max {
+		d = l.max
+	}
+	e.until = now.Add(d)
+	return d
+}
+
+func (l *Lockout) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, e := range l.entries {
+		if now.After(e.until) && now.Sub(e.lastFailure) > l.max {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := NewLimiter(2, 3)
+	l.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("10.0.0.1")
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("10.0.0.2")
+	assert.True(t, ok, "keys have separate buckets")
+	assert.Equal(t, 500*time.Millisecond, l.Wait("10.0.0.1"))
+	assert.Zero(t, l.Wait("10.0.0.2"))
+	assert.Zero(t, l.Wait("10.0.0.4"))
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("10.0.0.1")
+	assert.False(t, ok)
+
+	clock.t = clock.t.Add(2 * pruneInterval)
+	l.Allow("10.0.0.3")
+	assert.Len(t, l.buckets, 1, "refilled buckets are pruned")
+}
+
+func TestLockout(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := NewLockout(3, time.Second, 5*time.Second)
+	l.now = clock.now
+
+	assert.Zero(t, l.Failure("10.0.0.1"))
+	assert.Zero(t, l.Failure("10.0.0.1"))
+	locked, _ := l.Locked("10.0.0.1")
+	assert.False(t, locked)
+
+	assert.Equal(t, time.Second, l.Failure("10.0.0.1"))
+	locked, remaining := l.Locked("10.0.0.1")
+	assert.True(t, locked)
+	assert.Equal(t, time.Second, remaining)
+
+	clock.t = clock.t.Add(time.Second)
+	locked, _ = l.Locked("10.0.0.1")
+	assert.False(t, locked)
+	assert.Equal(t, 2*time.Second, l.Failure("10.0.0.1"), "lockout doubles")
+	assert.Equal(t, 4*time.Second, l.Failure("10.0.0.1"))
+	assert.Equal(t, 5*time.Second, l.Failure("10.0.0.1"), "lockout is capped")
+
+	clock.t = clock.t.Add(5 * time.Second)
+	locked, _ = l.Locked("10.0.0.1")
+	assert.False(t, locked)
+	assert.Equal(t, 5*time.Second, l.Failure("10.0.0.1"), "failures are kept until max passed without failure")
+
+	clock.t = clock.t.Add(10 * time.Second)
+	l.Failure("10.0.0.2")
+	l.Failure("10.0.0.2")
+	clock.t = clock.t.Add(6 * time.Second)
+	assert.Zero(t, l.Failure("10.0.0.2"), "old failures are forgotten")
+}
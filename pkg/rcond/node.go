@@ -16,10 +16,11 @@ type Node struct {
 }
 
 func NewNode(appConfig *config.Config) *Node {
+	api := Api(appConfig)
 	return &Node{
 		Config:       appConfig,
-		HttpApi:      Api(appConfig),
-		ClusterAgent: Cluster(&appConfig.Cluster),
+		HttpApi:      api,
+		ClusterAgent: Cluster(clusterConfig(appConfig), &appConfig.Rcond.TLS, api.Power()),
 	}
 }
 
@@ -39,19 +40,25 @@ func Api(appConfig *config.Config) *http.Server {
 	return srv
 }
 
-func Cluster(clusterConfig *config.ClusterConfig) *cluster.Agent {
-	if clusterConfig.Enabled {
-		log.Printf("[INFO] Starting cluster agent on %s:%d", clusterConfig.BindAddr, clusterConfig.BindPort)
-		clusterAgent, err := cluster.NewAgent(clusterConfig, cluster.ClusterEventsMap())
-		if err != nil {
-			log.Print(err)
-			return nil
-		}
-		// join nodes in the cluster if the join addresses are provided
-		if len(clusterConfig.Join) > 0 {
-			clusterAgent.Join(clusterConfig.Join, true)
-		}
-		return clusterAgent
+func Cluster(clusterConfig *config.ClusterConfig, tlsConfig *config.TLSConfig, power *system.Power) *cluster.Agent {
+	clusterAgent, err := cluster.Up(clusterConfig, tlsConfig, power)
+	if err != nil {
+		return nil
 	}
-	return nil
+	return clusterAgent
+}
+
+// clusterConfig returns the cluster configuration with the API address added to the member tags,
+// so other nodes can check the health of this node.
+func clusterConfig(appConfig *config.Config) *config.ClusterConfig {
+	clusterConfig := appConfig.Cluster
+	scheme := "http://"
+	if appConfig.Rcond.TLS.Enabled {
+		scheme = "https://"
+	}
+	clusterConfig.Tags = map[string]string{cluster.TagAPIAddr: scheme + appConfig.Rcond.Addr}
+	for key, value := range appConfig.Cluster.Tags {
+		clusterConfig.Tags[key] = value
+	}
+	return &clusterConfig
 }
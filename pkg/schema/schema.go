@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a subset of JSON Schema that is sufficient to describe
+// the request and event payloads used by rcond.
+type Schema struct {
+	Type                 string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty" yaml:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// FieldError describes a single validation failure at a JSON path.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a document does not match a schema.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			msgs = append(msgs, fe.Message)
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Parse parses a JSON encoded schema.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &s, nil
+}
+
+// MustParse parses a JSON encoded schema and panics on error.
+// It is meant for schemas that are defined as constants in code.
+func MustParse(data string) *Schema {
+	s, err := Parse([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate decodes the given JSON document and validates it against the schema.
+// Returns a *ValidationError if the document does not match.
+func (s *Schema) Validate(data []byte) error {
+	var doc interface{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		doc = nil
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return &ValidationError{Errors: []FieldError{{Message: fmt.Sprintf("invalid JSON: %v", err)}}}
+		}
+	}
+	return s.ValidateValue(doc)
+}
+
+// ValidateValue validates an already decoded JSON value against the schema.
+func (s *Schema) ValidateValue(doc interface{}) error {
+	var errs []FieldError
+	s.validate("", doc, &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *[]FieldError) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !matchesType(s.Type, v) {
+		fail("expected %s, got %s", s.Type, typeOf(v))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("value is not one of %v", s.Enum)
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, FieldError{Field: join(path, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(join(path, name), val[name], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Field: join(path, name), Message: "unknown field"})
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case string:
+		if s.MinLength != nil && len(val) < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && len(val) > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				fail("invalid pattern %q in schema", s.Pattern)
+			} else if !re.MatchString(val) {
+				fail("does not match pattern %q", s.Pattern)
+			}
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func matchesType(t string, v interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		return isNumber(v)
+	case "integer":
+		switch n := v.(type) {
+		case json.Number:
+			_, err := n.Int64()
+			return err == nil
+		case float64:
+			return n == float64(int64(n))
+		case int, int64:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case json.Number, float64, int, int64:
+		return true
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number, float64, int, int64:
+		return "number"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	s := MustParse(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"count": {"type": "integer", "minimum": 0},
+			"mode": {"type": "string", "enum": ["ap", "infrastructure"]}
+		}
+	}`)
+
+	assert.NoError(t, s.Validate([]byte(`{"name": "test", "count": 1, "mode": "ap"}`)))
+
+	err := s.Validate([]byte(`{"count": -1, "mode": "mesh", "extra": true}`))
+	assert.Error(t, err)
+	validationErr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "count", Message: "must be >= 0"},
+		{Field: "mode", Message: "value is not one of [ap infrastructure]"},
+		{Field: "extra", Message: "unknown field"},
+	}, validationErr.Errors)
+}
+
+func TestValidateType(t *testing.T) {
+	s := MustParse(`{"type": "array", "items": {"type": "string"}}`)
+	assert.NoError(t, s.Validate([]byte(`["a", "b"]`)))
+	assert.Error(t, s.Validate([]byte(`["a", 1]`)))
+	assert.Error(t, s.Validate([]byte(`{}`)))
+	assert.Error(t, s.Validate([]byte(`not json`)))
+}
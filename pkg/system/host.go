@@ -0,0 +1,124 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Roots of the proc and sys file systems and of the configuration files, replaced in tests.
+var (
+	procPath = "/proc"
+	sysPath  = "/sys"
+	etcPath  = "/etc"
+)
+
+// LoadAverage is the number of runnable processes averaged over 1, 5 and 15 minutes.
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// Memory is the memory of the host in bytes.
+type Memory struct {
+	Total     uint64 `json:"total"`
+	Available uint64 `json:"available"`
+	Free      uint64 `json:"free"`
+}
+
+// Uptime returns the time since the host booted.
+func Uptime() (time.Duration, error) {
+	fields, err := readFields(filepath.Join(procPath, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Load returns the load average of the host.
+func Load() (LoadAverage, error) {
+	fields, err := readFields(filepath.Join(procPath, "loadavg"))
+	if err != nil {
+		return LoadAverage{}, err
+	}
+	if len(fields) < 3 {
+		return LoadAverage{}, fmt.Errorf("invalid load average: %q", strings.Join(fields, " "))
+	}
+	var load [3]float64
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return LoadAverage{}, fmt.Errorf("invalid load average: %w", err)
+		}
+	}
+	return LoadAverage{Load1: load[0], Load5: load[1], Load15: load[2]}, nil
+}
+
+// MemoryInfo returns the total, available and free memory of the host.
+func MemoryInfo() (Memory, error) {
+	f, err := os.Open(filepath.Join(procPath, "meminfo"))
+	if err != nil {
+		return Memory{}, err
+	}
+	defer f.Close()
+
+	var mem Memory
+	fields := map[string]*uint64{
+		"MemTotal:":     &mem.Total,
+		"MemAvailable:": &mem.Available,
+		"MemFree:":      &mem.Free,
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 2 {
+			continue
+		}
+		field, ok := fields[line[0]]
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(line[1], 10, 64)
+		if err != nil {
+			return Memory{}, fmt.Errorf("invalid %s %w", line[0], err)
+		}
+		*field = kb * 1024
+	}
+	return mem, scanner.Err()
+}
+
+// Temperature returns the temperature of the first thermal zone in degrees Celsius,
+// the SoC temperature on a Raspberry Pi. Returns an error wrapping os.ErrNotExist
+// if the host has no thermal zone.
+func Temperature() (float64, error) {
+	fields, err := readFields(filepath.Join(sysPath, "class", "thermal", "thermal_zone0", "temp"))
+	if err != nil {
+		return 0, err
+	}
+	millis, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature: %w", err)
+	}
+	return millis / 1000, nil
+}
+
+// readFields returns the whitespace separated fields of a file, at least one.
+func readFields(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return fields, nil
+}
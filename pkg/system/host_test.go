@@ -0,0 +1,48 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestHost(t *testing.T) {
+	dir := t.TempDir()
+	procPath = filepath.Join(dir, "proc")
+	sysPath = filepath.Join(dir, "sys")
+	t.Cleanup(func() { procPath, sysPath = "/proc", "/sys" })
+
+	_, err := Temperature()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	writeFile(t, filepath.Join(procPath, "uptime"), "3804.25 3100.14\n")
+	writeFile(t, filepath.Join(procPath, "loadavg"), "0.35 0.38 0.24 2/72 26393\n")
+	writeFile(t, filepath.Join(procPath, "meminfo"), "MemTotal:        6158152 kB\nMemFree:         4210316 kB\nMemAvailable:    5597368 kB\nBuffers:           85148 kB\n")
+	writeFile(t, filepath.Join(sysPath, "class/thermal/thermal_zone0/temp"), "48312\n")
+
+	uptime, err := Uptime()
+	require.NoError(t, err)
+	assert.Equal(t, 3804250*time.Millisecond, uptime)
+
+	load, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, LoadAverage{Load1: 0.35, Load5: 0.38, Load15: 0.24}, load)
+
+	mem, err := MemoryInfo()
+	require.NoError(t, err)
+	assert.Equal(t, Memory{Total: 6158152 * 1024, Available: 5597368 * 1024, Free: 4210316 * 1024}, mem)
+
+	temp, err := Temperature()
+	require.NoError(t, err)
+	assert.InDelta(t, 48.312, temp, 0.0001)
+}
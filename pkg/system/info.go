@@ -0,0 +1,193 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/0x1d/rcond/pkg/version"
+)
+
+// Info describes the host and the running rcond.
+type Info struct {
+	Hostname string    `json:"hostname"`
+	OS       OSRelease `json:"os"`
+	Kernel   string    `json:"kernel"`
+	Arch     string    `json:"arch"`
+	CPU      CPU       `json:"cpu"`
+	Memory   Memory    `json:"memory"`
+	Disks    []Disk    `json:"disks"`
+	// Uptime is the time since the host booted in seconds.
+	Uptime float64 `json:"uptime_seconds"`
+	// Board is read from the device tree, it is nil on hosts without one.
+	Board *Board       `json:"board,omitempty"`
+	Rcond version.Info `json:"rcond"`
+}
+
+// OSRelease identifies the operating system, read from /etc/os-release.
+type OSRelease struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	VersionID  string `json:"version_id,omitempty"`
+	PrettyName string `json:"pretty_name"`
+}
+
+// CPU describes the processor of the host.
+type CPU struct {
+	Model string `json:"model"`
+	Cores int    `json:"cores"`
+}
+
+// Disk is the usage of the file system mounted at Path, in bytes.
+// Available is the space available to unprivileged users.
+type Disk struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Available   uint64  `json:"available"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Board identifies a single board computer like a Raspberry Pi.
+type Board struct {
+	Model  string `json:"model"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// GetInfo returns the information about the host with the usage of the disks mounted at diskPaths.
+// Values that can not be read are left empty.
+func GetInfo(diskPaths []string) Info {
+	info := Info{
+		Arch:  runtime.GOARCH,
+		Disks: []Disk{},
+		Rcond: version.Get(),
+	}
+	info.Hostname, _ = os.Hostname()
+	info.OS, _ = ReadOSRelease()
+	if fields, err := readFields(filepath.Join(procPath, "sys", "kernel", "osrelease")); err == nil {
+		info.Kernel = fields[0]
+	}
+	info.CPU = CPU{Model: cpuModel(), Cores: runtime.NumCPU()}
+	info.Memory, _ = MemoryInfo()
+	for _, path := range diskPaths {
+		if disk, err := DiskUsage(path); err == nil {
+			info.Disks = append(info.Disks, disk)
+		}
+	}
+	if uptime, err := Uptime(); err == nil {
+		info.Uptime = uptime.Seconds()
+	}
+	if board, err := ReadBoard(); err == nil {
+		info.Board = &board
+	}
+	return info
+}
+
+// ReadOSRelease parses /etc/os-release.
+func ReadOSRelease() (OSRelease, error) {
+	f, err := os.Open(filepath.Join(etcPath, "os-release"))
+	if err != nil {
+		return OSRelease{}, err
+	}
+	defer f.Close()
+
+	var release OSRelease
+	fields := map[string]*string{
+		"ID":          &release.ID,
+		"NAME":        &release.Name,
+		"VERSION":     &release.Version,
+		"VERSION_ID":  &release.VersionID,
+		"PRETTY_NAME": &release.PrettyName,
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		if field, ok := fields[key]; ok {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, `'`)
+			}
+			*field = value
+		}
+	}
+	return release, scanner.Err()
+}
+
+// cpuModel returns the model name of the first processor in /proc/cpuinfo,
+// or the hardware name on ARM kernels that do not report one.
+func cpuModel() string {
+	f, err := os.Open(filepath.Join(procPath, "cpuinfo"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var hardware string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "model name":
+			return strings.TrimSpace(value)
+		case "Hardware":
+			hardware = strings.TrimSpace(value)
+		}
+	}
+	return hardware
+}
+
+// ReadBoard returns the model and serial number of the board from the device tree.
+// Returns an error wrapping os.ErrNotExist if the host has no device tree.
+func ReadBoard() (Board, error) {
+	model, err := readDeviceTree("model")
+	if err != nil {
+		return Board{}, err
+	}
+	serial, err := readDeviceTree("serial-number")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Board{}, err
+	}
+	return Board{Model: model, Serial: serial}, nil
+}
+
+// readDeviceTree reads a string property of the device tree, which is terminated by a NUL byte.
+func readDeviceTree(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(procPath, "device-tree", name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00")), nil
+}
+
+// DiskUsage returns the usage of the file system mounted at path.
+func DiskUsage(path string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Disk{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	disk := Disk{
+		Path:      path,
+		Total:     st.Blocks * bsize,
+		Free:      st.Bfree * bsize,
+		Available: st.Bavail * bsize,
+	}
+	// Used space relative to the space usable by unprivileged users, like df.
+	if usable := disk.Total - disk.Free + disk.Available; usable > 0 {
+		disk.UsedPercent = float64(disk.Total-disk.Free) / float64(usable) * 100
+	}
+	return disk, nil
+}
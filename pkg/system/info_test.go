@@ -0,0 +1,46 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	procPath = filepath.Join(dir, "proc")
+	etcPath = filepath.Join(dir, "etc")
+	t.Cleanup(func() { procPath, etcPath = "/proc", "/etc" })
+
+	_, err := ReadBoard()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	writeFile(t, filepath.Join(etcPath, "os-release"), `PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+NAME="Debian GNU/Linux"
+VERSION_ID="12"
+VERSION="12 (bookworm)"
+ID=debian
+HOME_URL="https://www.debian.org/"
+`)
+	writeFile(t, filepath.Join(procPath, "sys/kernel/osrelease"), "6.6.51+rpt-rpi-v8\n")
+	writeFile(t, filepath.Join(procPath, "cpuinfo"), "processor\t: 0\nBogoMIPS\t: 108.00\n\nHardware\t: BCM2835\nRevision\t: c03114\nModel\t\t: Raspberry Pi 4 Model B Rev 1.4\n")
+	writeFile(t, filepath.Join(procPath, "device-tree/model"), "Raspberry Pi 4 Model B Rev 1.4\x00")
+	writeFile(t, filepath.Join(procPath, "device-tree/serial-number"), "10000000a1b2c3d4\x00")
+	writeFile(t, filepath.Join(procPath, "uptime"), "3804.25 3100.14\n")
+
+	info := GetInfo([]string{dir, filepath.Join(dir, "missing")})
+	assert.Equal(t, OSRelease{ID: "debian", Name: "Debian GNU/Linux", Version: "12 (bookworm)", VersionID: "12", PrettyName: "Debian GNU/Linux 12 (bookworm)"}, info.OS)
+	assert.Equal(t, "6.6.51+rpt-rpi-v8", info.Kernel)
+	assert.Equal(t, "BCM2835", info.CPU.Model)
+	assert.Equal(t, &Board{Model: "Raspberry Pi 4 Model B Rev 1.4", Serial: "10000000a1b2c3d4"}, info.Board)
+	assert.Equal(t, 3804.25, info.Uptime)
+	require.Len(t, info.Disks, 1)
+	assert.Equal(t, dir, info.Disks[0].Path)
+	assert.NotZero(t, info.Disks[0].Total)
+
+	writeFile(t, filepath.Join(procPath, "cpuinfo"), "processor\t: 0\nmodel name\t: Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz\n")
+	assert.Equal(t, "Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz", cpuModel())
+}
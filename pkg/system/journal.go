@@ -0,0 +1,232 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalctl is the command that reads the journal, replaced in tests.
+var journalctl = "journalctl"
+
+// RcondUnit is the unit name that selects the logs of rcond itself, see LogFilter.
+const RcondUnit = "rcond"
+
+// Errors returned for invalid filters and if the journal can not be read.
+var (
+	ErrInvalidLogFilter   = errors.New("invalid log filter")
+	ErrJournalUnavailable = errors.New("journal unavailable")
+)
+
+// priorities are the syslog priorities accepted by journalctl, by name and number.
+var priorities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// journalCursor matches the cursors of the journal, like s=...;i=...;b=...;m=...;t=...;x=....
+var journalCursor = regexp.MustCompile(`^[a-z]=[0-9a-f]+(;[a-z]=[0-9a-f]+)*$`)
+
+// LogEntry is an entry of the systemd journal.
+// Cursor identifies the entry, entries after it are read with LogFilter.Cursor.
+type LogEntry struct {
+	Time       time.Time `json:"time"`
+	Cursor     string    `json:"cursor"`
+	Unit       string    `json:"unit,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	PID        int       `json:"pid,omitempty"`
+	Priority   int       `json:"priority"`
+	Message    string    `json:"message"`
+}
+
+// LogFilter selects journal entries.
+// Units are unit names, names without a type are services and RcondUnit selects the unit rcond runs in.
+// Priority is the lowest priority to return, like err or 3. Limit selects the newest entries,
+// or with a Cursor the first entries after it.
+type LogFilter struct {
+	Units    []string
+	Priority string
+	Since    time.Time
+	Until    time.Time
+	Cursor   string
+	Limit    int
+}
+
+// Validate checks the units, priority and cursor of the filter.
+func (f *LogFilter) Validate() error {
+	for _, unit := range f.Units {
+		if unit == RcondUnit {
+			continue
+		}
+		if _, err := NormalizeUnit(unit); err != nil || strings.ContainsAny(unit, `*?[`) {
+			return fmt.Errorf("%w: unit %q", ErrInvalidLogFilter, unit)
+		}
+	}
+	if f.Priority != "" {
+		if _, ok := priorities[f.Priority]; !ok {
+			if n, err := strconv.Atoi(f.Priority); err != nil || n < 0 || n > 7 {
+				return fmt.Errorf("%w: priority %q", ErrInvalidLogFilter, f.Priority)
+			}
+		}
+	}
+	if f.Cursor != "" && !journalCursor.MatchString(f.Cursor) {
+		return fmt.Errorf("%w: cursor %q", ErrInvalidLogFilter, f.Cursor)
+	}
+	if f.Limit < 0 {
+		return fmt.Errorf("%w: limit %d", ErrInvalidLogFilter, f.Limit)
+	}
+	return nil
+}
+
+// args returns the arguments of journalctl to read the entries of the filter.
+func (f *LogFilter) args(follow bool) []string {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	for _, unit := range f.Units {
+		if unit == RcondUnit {
+			unit = ownUnit()
+		}
+		unit, _ = NormalizeUnit(unit)
+		args = append(args, "--unit="+unit)
+	}
+	if f.Priority != "" {
+		args = append(args, "--priority="+f.Priority)
+	}
+	if !f.Since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", f.Since.Unix()))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=@%d", f.Until.Unix()))
+	}
+	if f.Cursor != "" {
+		args = append(args, "--after-cursor="+f.Cursor)
+	} else if f.Limit > 0 {
+		args = append(args, "--lines="+strconv.Itoa(f.Limit))
+	}
+	if follow {
+		args = append(args, "--follow")
+	}
+	return args
+}
+
+// ReadLogs calls fn with the journal entries of the filter in chronological order, until fn returns false.
+// With follow, new entries are passed to fn as they are written until fn returns false or ctx is done.
+func ReadLogs(ctx context.Context, filter LogFilter, follow bool, fn func(LogEntry) bool) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, journalctl, filter.args(follow)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %w", ErrJournalUnavailable, err)
+	}
+
+	stopped := false
+	count := 0
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		entry, err := parseEntry(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		count++
+		// with a cursor, journalctl can not limit the entries after it
+		if !fn(entry) || (!follow && filter.Cursor != "" && filter.Limit > 0 && count >= filter.Limit) {
+			stopped = true
+			break
+		}
+	}
+	if stopped || ctx.Err() != nil {
+		cancel()
+		cmd.Wait()
+		return nil
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", ErrJournalUnavailable, msg)
+		}
+		return fmt.Errorf("%w: %w", ErrJournalUnavailable, err)
+	}
+	return scanner.Err()
+}
+
+// parseEntry parses an entry of journalctl --output=json.
+func parseEntry(line []byte) (LogEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return LogEntry{}, err
+	}
+	entry := LogEntry{
+		Cursor:     journalField(fields, "__CURSOR"),
+		Unit:       journalField(fields, "_SYSTEMD_UNIT"),
+		Identifier: journalField(fields, "SYSLOG_IDENTIFIER"),
+		Message:    journalField(fields, "MESSAGE"),
+		Priority:   6,
+	}
+	if usec, err := strconv.ParseInt(journalField(fields, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		entry.Time = time.UnixMicro(usec).UTC()
+	}
+	if pid, err := strconv.Atoi(journalField(fields, "_PID")); err == nil {
+		entry.PID = pid
+	}
+	if priority, err := strconv.Atoi(journalField(fields, "PRIORITY")); err == nil {
+		entry.Priority = priority
+	}
+	return entry, nil
+}
+
+// journalField returns a field of a JSON journal entry. Fields that are not valid UTF-8
+// are encoded as an array of bytes, fields with multiple values as an array, of which the first is used.
+func journalField(fields map[string]json.RawMessage, name string) string {
+	raw, ok := fields[name]
+	if !ok {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var b []int
+	if json.Unmarshal(raw, &b) == nil {
+		buf := make([]byte, len(b))
+		for i, v := range b {
+			buf[i] = byte(v)
+		}
+		return string(buf)
+	}
+	var values []json.RawMessage
+	if json.Unmarshal(raw, &values) == nil && len(values) > 0 {
+		return journalField(map[string]json.RawMessage{name: values[0]}, name)
+	}
+	return ""
+}
+
+// ownUnit returns the unit rcond runs in, read from its cgroup, or rcond.service.
+func ownUnit() string {
+	data, err := os.ReadFile(filepath.Join(procPath, "self", "cgroup"))
+	if err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if name := path.Base(line); strings.HasSuffix(name, ".service") {
+				return name
+			}
+		}
+	}
+	return "rcond.service"
+}
@@ -0,0 +1,110 @@
+package system
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFilter(t *testing.T) {
+	procPath = t.TempDir()
+	t.Cleanup(func() { procPath = "/proc" })
+	writeFile(t, filepath.Join(procPath, "self/cgroup"), "0::/system.slice/rcond-agent.service\n")
+
+	filter := LogFilter{
+		Units:    []string{"nginx", RcondUnit},
+		Priority: "warning",
+		Since:    time.Unix(1700000000, 0),
+		Limit:    50,
+	}
+	require.NoError(t, filter.Validate())
+	assert.Equal(t, []string{
+		"--output=json", "--no-pager", "--quiet",
+		"--unit=nginx.service", "--unit=rcond-agent.service",
+		"--priority=warning", "--since=@1700000000", "--lines=50", "--follow",
+	}, filter.args(true))
+
+	filter = LogFilter{Cursor: "s=739ad463;i=4ece7", Limit: 5}
+	require.NoError(t, filter.Validate())
+	assert.Equal(t, []string{"--output=json", "--no-pager", "--quiet", "--after-cursor=s=739ad463;i=4ece7"}, filter.args(false))
+
+	for _, filter := range []LogFilter{
+		{Units: []string{"nginx*"}},
+		{Units: []string{"../nginx"}},
+		{Priority: "loud"},
+		{Priority: "8"},
+		{Cursor: "--all"},
+		{Limit: -1},
+	} {
+		assert.ErrorIs(t, filter.Validate(), ErrInvalidLogFilter, "%+v", filter)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	entry, err := parseEntry([]byte(`{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1700000000123456","_SYSTEMD_UNIT":"rcond.service","SYSLOG_IDENTIFIER":"rcond","_PID":"412","PRIORITY":"3","MESSAGE":[104,105,255]}`))
+	require.NoError(t, err)
+	assert.Equal(t, LogEntry{
+		Time:       time.UnixMicro(1700000000123456).UTC(),
+		Cursor:     "s=1;i=2",
+		Unit:       "rcond.service",
+		Identifier: "rcond",
+		PID:        412,
+		Priority:   3,
+		Message:    "hi\xff",
+	}, entry)
+
+	entry, err = parseEntry([]byte(`{"__CURSOR":"s=1;i=3","MESSAGE":["first","second"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "first", entry.Message)
+	assert.Equal(t, 6, entry.Priority)
+
+	_, err = parseEntry([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestReadLogs(t *testing.T) {
+	dir := t.TempDir()
+	journalctl = filepath.Join(dir, "journalctl")
+	t.Cleanup(func() { journalctl = "journalctl" })
+	require.NoError(t, os.WriteFile(journalctl, []byte(`#!/bin/sh
+for arg in "$@"; do
+	[ "$arg" = "--priority=0" ] && { echo "Failed to open journal" >&2; exit 1; }
+done
+echo '{"__CURSOR":"s=1;i=1","MESSAGE":"one"}'
+echo 'garbage'
+echo '{"__CURSOR":"s=1;i=2","MESSAGE":"two"}'
+echo '{"__CURSOR":"s=1;i=3","MESSAGE":"three"}'
+`), 0o755))
+
+	var messages []string
+	collect := func(entry LogEntry) bool {
+		messages = append(messages, entry.Message)
+		return true
+	}
+	require.NoError(t, ReadLogs(context.Background(), LogFilter{}, false, collect))
+	assert.Equal(t, []string{"one", "two", "three"}, messages)
+
+	messages = nil
+	require.NoError(t, ReadLogs(context.Background(), LogFilter{Cursor: "s=1;i=0", Limit: 2}, false, collect))
+	assert.Equal(t, []string{"one", "two"}, messages)
+
+	messages = nil
+	require.NoError(t, ReadLogs(context.Background(), LogFilter{}, false, func(entry LogEntry) bool {
+		collect(entry)
+		return false
+	}))
+	assert.Equal(t, []string{"one"}, messages)
+
+	err := ReadLogs(context.Background(), LogFilter{Priority: "0"}, false, collect)
+	assert.ErrorIs(t, err, ErrJournalUnavailable)
+	assert.ErrorContains(t, err, "Failed to open journal")
+
+	journalctl = filepath.Join(dir, "missing")
+	assert.ErrorIs(t, ReadLogs(context.Background(), LogFilter{}, false, collect), ErrJournalUnavailable)
+	assert.ErrorIs(t, ReadLogs(context.Background(), LogFilter{Priority: "loud"}, false, collect), ErrInvalidLogFilter)
+}
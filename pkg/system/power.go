@@ -0,0 +1,283 @@
+package system
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x1d/rcond/pkg/util"
+	"github.com/godbus/dbus/v5"
+)
+
+// Power actions
+const (
+	PowerReboot   = "reboot"
+	PowerPoweroff = "poweroff"
+)
+
+// maxFailedPowerActions is the number of failed actions kept to be listed.
+const maxFailedPowerActions = 10
+
+// Errors returned when scheduling and canceling power actions.
+var (
+	ErrInvalidPowerAction  = errors.New("invalid power action")
+	ErrPowerInhibited      = errors.New("power action inhibited")
+	ErrPowerActionNotFound = errors.New("power action not found")
+)
+
+var (
+	// powerGrace is the minimum delay of an action, so the response of the request reaches the client first.
+	powerGrace = 2 * time.Second
+	// inhibitRetry is the interval in which an action held back by a block inhibitor is retried.
+	inhibitRetry = 30 * time.Second
+)
+
+// Inhibitor is a lock of logind that blocks or delays shutdown, sleep or idle.
+// What is a colon separated list like shutdown:sleep and Mode is block or delay.
+type Inhibitor struct {
+	What string `json:"what"`
+	Who  string `json:"who"`
+	Why  string `json:"why"`
+	Mode string `json:"mode"`
+	UID  uint32 `json:"uid"`
+	PID  uint32 `json:"pid"`
+}
+
+// PowerAction is a pending or failed reboot or poweroff.
+// InhibitedBy lists the block inhibitors that held the action back when it was due,
+// Error is the reason an action failed to run.
+type PowerAction struct {
+	ID          string      `json:"id"`
+	Action      string      `json:"action"`
+	At          time.Time   `json:"at"`
+	Force       bool        `json:"force,omitempty"`
+	CreatedBy   string      `json:"created_by,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	InhibitedBy []Inhibitor `json:"inhibited_by,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// Power runs reboots and poweroffs at a scheduled time.
+// Actions are kept in memory, pending actions are dropped if rcond stops.
+// The last actions that failed to run are kept, so they can be listed.
+type Power struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAction
+	failed  []PowerAction
+	// execute runs an action and inhibitors lists the inhibitors of logind, replaced in tests.
+	execute    func(action string) error
+	inhibitors func() ([]Inhibitor, error)
+}
+
+type pendingAction struct {
+	action PowerAction
+	timer  *time.Timer
+}
+
+// NewPower returns a scheduler of power actions.
+func NewPower() *Power {
+	return &Power{
+		pending:    make(map[string]*pendingAction),
+		execute:    runPowerAction,
+		inhibitors: Inhibitors,
+	}
+}
+
+// Schedule runs the action at the given time, at least after a short grace period.
+// Actions without a time, or with a time within the grace period or in the past, are immediate: they are rejected
+// with ErrPowerInhibited while a block inhibitor for shutdown is held. Scheduled actions wait for the inhibitors
+// to be released once they are due. Force ignores inhibitors.
+// Pending actions are only kept in memory and are lost when rcond restarts.
+func (p *Power) Schedule(action string, at time.Time, force bool, createdBy string) (PowerAction, error) {
+	if action != PowerReboot && action != PowerPoweroff {
+		return PowerAction{}, fmt.Errorf("%w: %q", ErrInvalidPowerAction, action)
+	}
+	now := time.Now()
+	if earliest := now.Add(powerGrace); at.Before(earliest) {
+		if !force {
+			if blocking := p.blocking(); len(blocking) > 0 {
+				return PowerAction{}, fmt.Errorf("%w by %s", ErrPowerInhibited, describeInhibitors(blocking))
+			}
+		}
+		at = earliest
+	}
+	id, err := newPowerID()
+	if err != nil {
+		return PowerAction{}, err
+	}
+	pa := &pendingAction{action: PowerAction{
+		ID:        id,
+		Action:    action,
+		At:        at.UTC(),
+		Force:     force,
+		CreatedBy: createdBy,
+		CreatedAt: now.UTC(),
+	}}
+	p.mu.Lock()
+	p.pending[id] = pa
+	pa.timer = time.AfterFunc(at.Sub(now), func() { p.run(id) })
+	p.mu.Unlock()
+	log.Printf("[INFO] Scheduled %s %s at %s", action, id, pa.action.At.Format(time.RFC3339))
+	return pa.action, nil
+}
+
+// List returns the pending actions, the next first.
+func (p *Power) List() []PowerAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	actions := make([]PowerAction, 0, len(p.pending))
+	for _, pa := range p.pending {
+		actions = append(actions, pa.action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].At.Before(actions[j].At) })
+	return actions
+}
+
+// Failed returns the last actions that failed to run, the newest first.
+func (p *Power) Failed() []PowerAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	actions := make([]PowerAction, 0, len(p.failed))
+	for i := len(p.failed) - 1; i >= 0; i-- {
+		actions = append(actions, p.failed[i])
+	}
+	return actions
+}
+
+// Cancel cancels a pending action and returns it.
+func (p *Power) Cancel(id string) (PowerAction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pa, ok := p.pending[id]
+	if !ok {
+		return PowerAction{}, fmt.Errorf("%w: %s", ErrPowerActionNotFound, id)
+	}
+	pa.timer.Stop()
+	delete(p.pending, id)
+	log.Printf("[INFO] Canceled %s %s", pa.action.Action, id)
+	return pa.action, nil
+}
+
+// CancelAll cancels all pending actions and returns them.
+func (p *Power) CancelAll() []PowerAction {
+	actions := p.List()
+	for _, action := range actions {
+		p.Cancel(action.ID)
+	}
+	return actions
+}
+
+// Inhibitors returns the inhibitors currently held with logind.
+func (p *Power) Inhibitors() ([]Inhibitor, error) {
+	return p.inhibitors()
+}
+
+// Stop drops the pending actions without running them.
+func (p *Power) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, pa := range p.pending {
+		pa.timer.Stop()
+		delete(p.pending, id)
+		log.Printf("[WARN] Dropped %s %s scheduled at %s", pa.action.Action, id, pa.action.At.Format(time.RFC3339))
+	}
+}
+
+// run runs a due action, or retries it later while a block inhibitor for shutdown is held.
+// Actions that fail to run are kept as failed actions.
+func (p *Power) run(id string) {
+	p.mu.Lock()
+	pa, ok := p.pending[id]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	var blocking []Inhibitor
+	if !pa.action.Force {
+		blocking = p.blocking()
+	}
+
+	p.mu.Lock()
+	if p.pending[id] != pa {
+		// canceled while the inhibitors were read
+		p.mu.Unlock()
+		return
+	}
+	if len(blocking) > 0 {
+		pa.action.InhibitedBy = blocking
+		pa.timer = time.AfterFunc(inhibitRetry, func() { p.run(id) })
+		p.mu.Unlock()
+		log.Printf("[WARN] %s %s inhibited by %s, retrying in %s", pa.action.Action, id, describeInhibitors(blocking), inhibitRetry)
+		return
+	}
+	delete(p.pending, id)
+	p.mu.Unlock()
+
+	log.Printf("[INFO] Running %s %s requested by %s", pa.action.Action, id, pa.action.CreatedBy)
+	if err := p.execute(pa.action.Action); err != nil {
+		log.Printf("[ERROR] Failed to run %s %s: %v", pa.action.Action, id, err)
+		failed := pa.action
+		failed.Error = err.Error()
+		p.mu.Lock()
+		p.failed = append(p.failed, failed)
+		if len(p.failed) > maxFailedPowerActions {
+			p.failed = p.failed[len(p.failed)-maxFailedPowerActions:]
+		}
+		p.mu.Unlock()
+	}
+}
+
+// blocking returns the inhibitors that block shutdown. If logind can not be reached, nothing blocks.
+func (p *Power) blocking() []Inhibitor {
+	inhibitors, err := p.inhibitors()
+	if err != nil {
+		log.Printf("[WARN] Failed to list inhibitors: %v", err)
+		return nil
+	}
+	var blocking []Inhibitor
+	for _, inhibitor := range inhibitors {
+		if inhibitor.Mode == "block" && strings.Contains(":"+inhibitor.What+":", ":shutdown:") {
+			blocking = append(blocking, inhibitor)
+		}
+	}
+	return blocking
+}
+
+func describeInhibitors(inhibitors []Inhibitor) string {
+	names := make([]string, len(inhibitors))
+	for i, inhibitor := range inhibitors {
+		names[i] = fmt.Sprintf("%s (%s)", inhibitor.Who, inhibitor.Why)
+	}
+	return strings.Join(names, ", ")
+}
+
+func newPowerID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate power action id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func runPowerAction(action string) error {
+	if action == PowerPoweroff {
+		return Shutdown()
+	}
+	return Restart()
+}
+
+// Inhibitors returns the inhibitors held with logind.
+func Inhibitors() ([]Inhibitor, error) {
+	var inhibitors []Inhibitor
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		obj := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+		return obj.Call("org.freedesktop.login1.Manager.ListInhibitors", 0).Store(&inhibitors)
+	})
+	return inhibitors, err
+}
@@ -0,0 +1,129 @@
+package system
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePower returns a scheduler that records the executed actions instead of running them.
+func fakePower(t *testing.T, inhibitors *[]Inhibitor) (*Power, func() []string) {
+	powerGrace, inhibitRetry = 10*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() { powerGrace, inhibitRetry = 2*time.Second, 30*time.Second })
+
+	var mu sync.Mutex
+	var executed []string
+	p := NewPower()
+	p.execute = func(action string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		executed = append(executed, action)
+		return nil
+	}
+	p.inhibitors = func() ([]Inhibitor, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return *inhibitors, nil
+	}
+	t.Cleanup(p.Stop)
+	return p, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), executed...)
+	}
+}
+
+func TestPowerSchedule(t *testing.T) {
+	var inhibitors []Inhibitor
+	p, executed := fakePower(t, &inhibitors)
+
+	_, err := p.Schedule("hibernate", time.Time{}, false, "admin")
+	assert.ErrorIs(t, err, ErrInvalidPowerAction)
+
+	later, err := p.Schedule(PowerPoweroff, time.Now().Add(time.Hour), false, "admin")
+	require.NoError(t, err)
+	now, err := p.Schedule(PowerReboot, time.Time{}, false, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", now.CreatedBy)
+	assert.False(t, now.At.Before(now.CreatedAt.Add(powerGrace)))
+
+	pending := p.List()
+	require.Len(t, pending, 2)
+	assert.Equal(t, now.ID, pending[0].ID)
+	assert.Equal(t, later.ID, pending[1].ID)
+
+	assert.Eventually(t, func() bool { return len(executed()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{PowerReboot}, executed())
+	assert.Len(t, p.List(), 1)
+
+	canceled, err := p.Cancel(later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, later.ID, canceled.ID)
+	_, err = p.Cancel(later.ID)
+	assert.ErrorIs(t, err, ErrPowerActionNotFound)
+	assert.Empty(t, p.List())
+}
+
+func TestPowerInhibitors(t *testing.T) {
+	inhibitors := []Inhibitor{
+		{What: "sleep", Who: "GNOME", Why: "idle", Mode: "block"},
+		{What: "shutdown:sleep", Who: "backup", Why: "Backup in progress", Mode: "block"},
+		{What: "shutdown", Who: "ModemManager", Why: "modem reset", Mode: "delay"},
+	}
+	p, executed := fakePower(t, &inhibitors)
+
+	_, err := p.Schedule(PowerReboot, time.Time{}, false, "admin")
+	assert.ErrorIs(t, err, ErrPowerInhibited)
+	assert.ErrorContains(t, err, "backup (Backup in progress)")
+	// a time in the past or without a delay is immediate
+	_, err = p.Schedule(PowerReboot, time.Now().Add(-time.Hour), false, "admin")
+	assert.ErrorIs(t, err, ErrPowerInhibited)
+	_, err = p.Schedule(PowerReboot, time.Now(), false, "admin")
+	assert.ErrorIs(t, err, ErrPowerInhibited)
+
+	// scheduled actions wait for the block inhibitor once due
+	scheduled, err := p.Schedule(PowerReboot, time.Now().Add(50*time.Millisecond), false, "admin")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		pending := p.List()
+		return len(pending) == 1 && len(pending[0].InhibitedBy) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, executed())
+
+	canceled := p.CancelAll()
+	require.Len(t, canceled, 1)
+	assert.Equal(t, scheduled.ID, canceled[0].ID)
+
+	_, err = p.Schedule(PowerPoweroff, time.Time{}, true, "admin")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(executed()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{PowerPoweroff}, executed())
+}
+
+func TestPowerFailed(t *testing.T) {
+	var inhibitors []Inhibitor
+	p, _ := fakePower(t, &inhibitors)
+	p.execute = func(action string) error { return errors.New("access denied") }
+
+	scheduled, err := p.Schedule(PowerReboot, time.Time{}, false, "admin")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(p.Failed()) == 1 }, time.Second, 5*time.Millisecond)
+	failed := p.Failed()[0]
+	assert.Equal(t, scheduled.ID, failed.ID)
+	assert.Equal(t, "access denied", failed.Error)
+	assert.Empty(t, p.List())
+
+	for i := 0; i < maxFailedPowerActions; i++ {
+		_, err := p.Schedule(PowerReboot, time.Time{}, false, "admin")
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return len(p.List()) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		failed := p.Failed()
+		return len(failed) == maxFailedPowerActions && failed[len(failed)-1].ID != scheduled.ID
+	}, time.Second, 5*time.Millisecond)
+}
@@ -9,26 +9,26 @@ import (
 
 // Restart restarts the system.
 func Restart() error {
-	return util.WithConnection(func(conn *dbus.Conn) error {
-		obj := conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
-		log.Println("Rebooting system...")
-		call := obj.Call("org.freedesktop.systemd1.Manager.Reboot", 0)
-		if call.Err != nil {
-			return call.Err
-		}
-		return nil
-	})
+	log.Println("Rebooting system...")
+	return powerCall("Reboot")
 }
 
 // Shutdown shuts down the system.
 func Shutdown() error {
+	log.Println("Shutting down system...")
+	return powerCall("PowerOff")
+}
+
+// powerCall calls Reboot or PowerOff of logind, which waits for delay inhibitors like
+// services finishing their writes, or of systemd if logind is not running.
+func powerCall(method string) error {
 	return util.WithConnection(func(conn *dbus.Conn) error {
-		obj := conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
-		log.Println("Shutting down system...")
-		call := obj.Call("org.freedesktop.systemd1.Manager.PowerOff", 0)
-		if call.Err != nil {
-			return call.Err
+		logind := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+		err := logind.Call("org.freedesktop.login1.Manager."+method, 0, false).Err
+		if name := util.ErrorName(err); name != "org.freedesktop.DBus.Error.ServiceUnknown" && name != "org.freedesktop.DBus.Error.NameHasNoOwner" {
+			return err
 		}
-		return nil
+		obj := conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
+		return obj.Call("org.freedesktop.systemd1.Manager."+method, 0).Err
 	})
 }
@@ -0,0 +1,290 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/0x1d/rcond/pkg/util"
+	"github.com/godbus/dbus/v5"
+)
+
+// Errors returned for unit names that are invalid, not in the allowlist or unknown to systemd,
+// and for actions that are unknown or not applicable to the unit.
+var (
+	ErrInvalidUnit     = errors.New("invalid unit name")
+	ErrUnitNotAllowed  = errors.New("unit is not in the allowlist")
+	ErrUnitNotFound    = errors.New("unit not found")
+	ErrInvalidAction   = errors.New("invalid unit action")
+	ErrActionConflicts = errors.New("action is not applicable to the unit")
+)
+
+// systemdErrors maps the D-Bus errors of systemd to the errors of this package.
+var systemdErrors = map[string]error{
+	"org.freedesktop.systemd1.NoSuchUnit":               ErrUnitNotFound,
+	"org.freedesktop.DBus.Error.FileNotFound":           ErrUnitNotFound,
+	"org.freedesktop.systemd1.LoadFailed":               ErrUnitNotFound,
+	"org.freedesktop.systemd1.UnitMasked":               ErrActionConflicts,
+	"org.freedesktop.systemd1.JobTypeNotApplicable":     ErrActionConflicts,
+	"org.freedesktop.systemd1.OnlyByDependency":         ErrActionConflicts,
+	"org.freedesktop.systemd1.TransactionIsDestructive": ErrActionConflicts,
+}
+
+// Actions that can be run on a unit
+const (
+	UnitStart   = "start"
+	UnitStop    = "stop"
+	UnitRestart = "restart"
+	UnitReload  = "reload"
+	UnitEnable  = "enable"
+	UnitDisable = "disable"
+)
+
+// unitJobs are the systemd manager methods that queue a job for an action.
+var unitJobs = map[string]string{
+	UnitStart:   "StartUnit",
+	UnitStop:    "StopUnit",
+	UnitRestart: "RestartUnit",
+	UnitReload:  "ReloadUnit",
+}
+
+// unitName matches the characters systemd allows in unit names, including glob patterns.
+var unitName = regexp.MustCompile(`^[A-Za-z0-9:_.@\\*?\[\]-]+$`)
+
+// Unit is a systemd unit with its state.
+// UnitFileState is whether the unit is enabled, like enabled, disabled or static,
+// and empty for units without a unit file.
+type Unit struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	LoadState     string `json:"load_state"`
+	ActiveState   string `json:"active_state"`
+	SubState      string `json:"sub_state"`
+	UnitFileState string `json:"unit_file_state,omitempty"`
+}
+
+// unitStatus is an entry of the ListUnits* methods of the systemd manager.
+type unitStatus struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Following   string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// Units reads and controls the systemd units of an allowlist.
+type Units struct {
+	names    []string
+	patterns []string
+}
+
+// NewUnits creates the units of the allowlist. Entries are unit names or glob patterns,
+// names without a type are services.
+func NewUnits(cfg *config.UnitsConfig) (*Units, error) {
+	u := &Units{}
+	for _, entry := range cfg.Allow {
+		name, err := NormalizeUnit(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidUnit, entry)
+		}
+		if strings.ContainsAny(name, `*?[`) {
+			u.patterns = append(u.patterns, name)
+		} else {
+			u.names = append(u.names, name)
+		}
+	}
+	return u, nil
+}
+
+// NormalizeUnit checks the unit name and adds the .service suffix to names without a type.
+func NormalizeUnit(name string) (string, error) {
+	if !unitName.MatchString(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidUnit, name)
+	}
+	if !strings.Contains(name, ".") {
+		name += ".service"
+	}
+	return name, nil
+}
+
+// Allowed reports whether the normalized unit name is in the allowlist.
+func (u *Units) Allowed(name string) bool {
+	for _, allowed := range u.names {
+		if name == allowed {
+			return true
+		}
+	}
+	for _, pattern := range u.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check normalizes the unit name and checks that it is in the allowlist.
+func (u *Units) check(name string) (string, error) {
+	name, err := NormalizeUnit(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(name, `*?[`) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidUnit, name)
+	}
+	if !u.Allowed(name) {
+		return "", fmt.Errorf("%w: %s", ErrUnitNotAllowed, name)
+	}
+	return name, nil
+}
+
+// List returns the units of the allowlist, sorted by name.
+// Units matched by a pattern are only listed if systemd has loaded them.
+func (u *Units) List() ([]Unit, error) {
+	units := []Unit{}
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		manager := systemdManager(conn)
+		seen := map[string]bool{}
+		var statuses []unitStatus
+		if len(u.names) > 0 {
+			if err := manager.Call("org.freedesktop.systemd1.Manager.ListUnitsByNames", 0, u.names).Store(&statuses); err != nil {
+				return unitError("ListUnitsByNames", err)
+			}
+		}
+		if len(u.patterns) > 0 {
+			var matched []unitStatus
+			if err := manager.Call("org.freedesktop.systemd1.Manager.ListUnitsByPatterns", 0, []string{}, u.patterns).Store(&matched); err != nil {
+				return unitError("ListUnitsByPatterns", err)
+			}
+			statuses = append(statuses, matched...)
+		}
+		for _, status := range statuses {
+			if seen[status.Name] || status.LoadState == "not-found" {
+				continue
+			}
+			seen[status.Name] = true
+			units = append(units, toUnit(manager, status))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// Get returns the state of a unit of the allowlist.
+func (u *Units) Get(name string) (*Unit, error) {
+	name, err := u.check(name)
+	if err != nil {
+		return nil, err
+	}
+	return getUnit(name)
+}
+
+// Run runs the action on a unit of the allowlist and returns its state.
+// Start, stop, restart and reload return once the job was queued, enable and disable
+// change the unit file links and reload the systemd configuration.
+func (u *Units) Run(name, action string) (*Unit, error) {
+	name, err := u.check(name)
+	if err != nil {
+		return nil, err
+	}
+	if !validAction(action) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAction, action)
+	}
+	log.Printf("[INFO] Running %s on unit %s", action, name)
+	err = util.WithConnection(func(conn *dbus.Conn) error {
+		manager := systemdManager(conn)
+		if method, ok := unitJobs[action]; ok {
+			if err := manager.Call("org.freedesktop.systemd1.Manager."+method, 0, name, "replace").Err; err != nil {
+				return unitError(method, err)
+			}
+			return nil
+		}
+		switch action {
+		case UnitEnable:
+			if err := manager.Call("org.freedesktop.systemd1.Manager.EnableUnitFiles", 0, []string{name}, false, false).Err; err != nil {
+				return unitError("EnableUnitFiles", err)
+			}
+		case UnitDisable:
+			if err := manager.Call("org.freedesktop.systemd1.Manager.DisableUnitFiles", 0, []string{name}, false).Err; err != nil {
+				return unitError("DisableUnitFiles", err)
+			}
+		}
+		if err := manager.Call("org.freedesktop.systemd1.Manager.Reload", 0).Err; err != nil {
+			return unitError("Reload", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getUnit(name)
+}
+
+// validAction reports whether the action can be run on units.
+func validAction(action string) bool {
+	_, ok := unitJobs[action]
+	return ok || action == UnitEnable || action == UnitDisable
+}
+
+func getUnit(name string) (*Unit, error) {
+	var unit Unit
+	err := util.WithConnection(func(conn *dbus.Conn) error {
+		manager := systemdManager(conn)
+		var statuses []unitStatus
+		if err := manager.Call("org.freedesktop.systemd1.Manager.ListUnitsByNames", 0, []string{name}).Store(&statuses); err != nil {
+			return unitError("ListUnitsByNames", err)
+		}
+		if len(statuses) == 0 || statuses[0].LoadState == "not-found" {
+			return fmt.Errorf("%w: %s", ErrUnitNotFound, name)
+		}
+		unit = toUnit(manager, statuses[0])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &unit, nil
+}
+
+func systemdManager(conn *dbus.Conn) dbus.BusObject {
+	return conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
+}
+
+// toUnit converts a unit status and adds the state of its unit file.
+func toUnit(manager dbus.BusObject, status unitStatus) Unit {
+	unit := Unit{
+		Name:        status.Name,
+		Description: status.Description,
+		LoadState:   status.LoadState,
+		ActiveState: status.ActiveState,
+		SubState:    status.SubState,
+	}
+	// units without a unit file, like devices, have no state
+	manager.Call("org.freedesktop.systemd1.Manager.GetUnitFileState", 0, status.Name).Store(&unit.UnitFileState)
+	return unit
+}
+
+// unitError wraps the error of a failed systemd call,
+// adding the matching error of this package if there is one.
+func unitError(call string, err error) error {
+	if target, ok := systemdErrors[util.ErrorName(err)]; ok {
+		return fmt.Errorf("%s failed: %w: %w", call, target, err)
+	}
+	return fmt.Errorf("%s failed: %w", call, err)
+}
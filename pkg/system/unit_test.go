@@ -0,0 +1,37 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/0x1d/rcond/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnits(t *testing.T) {
+	name, err := NormalizeUnit("nginx")
+	require.NoError(t, err)
+	assert.Equal(t, "nginx.service", name)
+	name, err = NormalizeUnit("getty@tty1.service")
+	require.NoError(t, err)
+	assert.Equal(t, "getty@tty1.service", name)
+	_, err = NormalizeUnit("../nginx service")
+	assert.ErrorIs(t, err, ErrInvalidUnit)
+
+	_, err = NewUnits(&config.UnitsConfig{Allow: []string{"rcond-[.service"}})
+	assert.ErrorIs(t, err, ErrInvalidUnit)
+
+	units, err := NewUnits(&config.UnitsConfig{Allow: []string{"nginx", "rcond-*.timer"}})
+	require.NoError(t, err)
+	assert.True(t, units.Allowed("nginx.service"))
+	assert.True(t, units.Allowed("rcond-backup.timer"))
+	assert.False(t, units.Allowed("rcond-backup.service"))
+	assert.False(t, units.Allowed("ssh.service"))
+
+	_, err = units.Get("ssh")
+	assert.ErrorIs(t, err, ErrUnitNotAllowed)
+	_, err = units.Get("rcond-*.timer")
+	assert.ErrorIs(t, err, ErrInvalidUnit)
+	_, err = units.Run("nginx", "mask")
+	assert.ErrorIs(t, err, ErrInvalidAction)
+}
@@ -1,22 +1,47 @@
 package user
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	osuser "os/user"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// AddAuthorizedKey verifies and adds an SSH public key to /home/<user>/.ssh/authorized_keys
-// if it doesn't already exist. Returns the key's fingerprint.
+// Errors returned for invalid keys, unknown users and keys that already exist or do not exist.
+var (
+	ErrInvalidKey   = errors.New("invalid SSH public key")
+	ErrUserNotFound = errors.New("user not found")
+	ErrKeyExists    = errors.New("key already exists")
+	ErrKeyNotFound  = errors.New("key not found")
+)
+
+// lookupUser returns ErrUserNotFound if the user does not exist.
+func lookupUser(user string) error {
+	if _, err := osuser.Lookup(user); err != nil {
+		var unknown osuser.UnknownUserError
+		if errors.As(err, &unknown) {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, user)
+		}
+		return fmt.Errorf("failed to look up user %s: %v", user, err)
+	}
+	return nil
+}
+
+// AddAuthorizedKey verifies and adds an SSH public key to /home/<user>/.ssh/authorized_keys.
+// Returns the key's fingerprint, and ErrKeyExists with the fingerprint if the key was already added.
 func AddAuthorizedKey(user string, pubKey string) (string, error) {
 	// Verify the public key format and get fingerprint
 	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey))
 	if err != nil {
-		return "", fmt.Errorf("invalid SSH public key: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
 	}
 	fingerprint := ssh.FingerprintSHA256(parsed)
+	if err := lookupUser(user); err != nil {
+		return "", err
+	}
 
 	// Ensure .ssh directory exists
 	sshDir := fmt.Sprintf("/home/%s/.ssh", user)
@@ -41,8 +66,7 @@ func AddAuthorizedKey(user string, pubKey string) (string, error) {
 					continue
 				}
 				if ssh.FingerprintSHA256(parsed) == fingerprint {
-					// Key already exists, return fingerprint
-					return fingerprint, nil
+					return fingerprint, ErrKeyExists
 				}
 			}
 		}
@@ -65,14 +89,27 @@ func AddAuthorizedKey(user string, pubKey string) (string, error) {
 	return fingerprint, nil
 }
 
+// Fingerprint verifies an SSH public key in authorized_keys format and returns its SHA256 fingerprint.
+func Fingerprint(pubKey string) (string, error) {
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return ssh.FingerprintSHA256(parsed), nil
+}
+
 // RemoveAuthorizedKey removes an authorized SSH key from /home/<user>/.ssh/authorized_keys
-// using the key's fingerprint to identify which key to remove
+// using the key's fingerprint to identify which key to remove.
+// Returns ErrKeyNotFound if the user has no key with the fingerprint.
 func RemoveAuthorizedKey(user string, fingerprint string) error {
+	if err := lookupUser(user); err != nil {
+		return err
+	}
 	// Check if authorized_keys file exists
 	keyFile := fmt.Sprintf("/home/%s/.ssh/authorized_keys", user)
 	if _, err := os.Stat(keyFile); err != nil {
 		if os.IsNotExist(err) {
-			return nil // Nothing to remove
+			return ErrKeyNotFound
 		}
 		return fmt.Errorf("failed to check authorized_keys: %v", err)
 	}
@@ -85,6 +122,7 @@ func RemoveAuthorizedKey(user string, fingerprint string) error {
 
 	// Filter out the key with matching fingerprint
 	var newLines []string
+	found := false
 	for _, line := range strings.Split(string(existingKeys), "\n") {
 		if line == "" {
 			continue
@@ -97,8 +135,13 @@ func RemoveAuthorizedKey(user string, fingerprint string) error {
 		}
 		if ssh.FingerprintSHA256(parsed) != fingerprint {
 			newLines = append(newLines, line)
+		} else {
+			found = true
 		}
 	}
+	if !found {
+		return ErrKeyNotFound
+	}
 
 	// Write back the filtered keys
 	err = os.WriteFile(keyFile, []byte(strings.Join(newLines, "\n")+"\n"), 0600)
@@ -1,23 +1,70 @@
 package util
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
+	"github.com/0x1d/rcond/pkg/metrics"
 	"github.com/godbus/dbus/v5"
 )
 
+// dbusErrors counts the failed D-Bus calls by error name.
+var dbusErrors = metrics.Default.NewCounterVec("rcond_dbus_errors_total", "Failed D-Bus calls by error name, connect for failed connections to the system bus.", "error")
+
+// ErrUnavailable is returned when the system bus or the called service can not be reached.
+var ErrUnavailable = errors.New("d-bus service unavailable")
+
+// unavailableErrors are the names of D-Bus errors returned when a service is not running or not responding.
+var unavailableErrors = map[string]bool{
+	"org.freedesktop.DBus.Error.ServiceUnknown": true,
+	"org.freedesktop.DBus.Error.NameHasNoOwner": true,
+	"org.freedesktop.DBus.Error.NoReply":        true,
+	"org.freedesktop.DBus.Error.Disconnected":   true,
+	"org.freedesktop.DBus.Error.TimedOut":       true,
+}
+
 // WithConnection executes the given function with a D-Bus system connection
-// and handles any connection errors
+// and handles any connection errors. Errors of D-Bus calls are counted by their name.
+// Errors of an unreachable bus or service wrap ErrUnavailable.
 func WithConnection(fn func(*dbus.Conn) error) error {
 	conn, err := dbus.SystemBus()
 	if err != nil {
 		log.Printf("[ERROR] Failed to connect to system bus: %v", err)
-		return err
+		dbusErrors.Inc("connect")
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
 	}
 	if err := fn(conn); err != nil {
 		log.Printf("[ERROR] Failed to execute D-Bus function: %s", err)
+		name := ErrorName(err)
+		if name != "" {
+			dbusErrors.Inc(name)
+		}
+		if unavailableErrors[name] {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
 		return err
 	}
 	conn.Close()
 	return nil
 }
+
+// ErrorName returns the name of the D-Bus error in the chain of err, empty if there is none.
+func ErrorName(err error) string {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr.Name
+	}
+	var dbusErrPtr *dbus.Error
+	if errors.As(err, &dbusErrPtr) {
+		return dbusErrPtr.Name
+	}
+	return ""
+}
+
+// Ping checks that the system bus is reachable.
+func Ping() error {
+	return WithConnection(func(conn *dbus.Conn) error {
+		return conn.BusObject().Call("org.freedesktop.DBus.Peer.Ping", 0).Err
+	})
+}
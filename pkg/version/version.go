@@ -0,0 +1,40 @@
+// Package version holds the version of the rcond build.
+// Version, Commit and BuildDate are set at build time with
+// -ldflags "-X github.com/0x1d/rcond/pkg/version.Version=...".
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes the rcond build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the version of the build. The commit and build date fall back to the
+// VCS information embedded by the Go toolchain if they were not set at build time.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}